@@ -2,10 +2,13 @@ package controllers
 
 import (
 	"encoding/json"
+	"fmt"
+	"log"
 	"net/http"
 	"strings"
 
 	"chatbot/models"
+	"chatbot/services"
 )
 
 // ChatHandler processes chat requests using the chatbot service
@@ -38,16 +41,206 @@ func (c *Controller) ChatHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !validateSessionID(w, req.SessionID) || !c.validatePersona(w, req.Persona) || !c.validateOptions(w, req.Options) || !validateSearchMode(w, req.Search) {
+		return
+	}
+
 	// Generate session ID if not provided
 	if req.SessionID == "" {
 		req.SessionID = c.generateSessionID()
 	}
 
 	// Process message through chatbot service
-	response := c.chatbot.ProcessMessage(req.Message, req.SessionID, req.History)
+	response := c.chatbot.ProcessMessage(req.Message, req.SessionID, req.History, chatParams(req))
 
 	// Return JSON response
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(response)
 }
+
+// ChatStreamHandler processes chat requests and streams the response as Server-Sent Events.
+// Each fragment is sent as a "token" event and the final ChatResponse as a "done" event.
+func (c *Controller) ChatStreamHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req models.ChatRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(models.ChatResponse{
+			Message: "Invalid JSON format",
+			Status:  "error",
+		})
+		return
+	}
+
+	// Validate message
+	if strings.TrimSpace(req.Message) == "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(models.ChatResponse{
+			Message: "Message cannot be empty",
+			Status:  "error",
+		})
+		return
+	}
+
+	if !validateSessionID(w, req.SessionID) || !c.validatePersona(w, req.Persona) || !c.validateOptions(w, req.Options) || !validateSearchMode(w, req.Search) {
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	// Generate session ID if not provided
+	if req.SessionID == "" {
+		req.SessionID = c.generateSessionID()
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no") // Disable proxy buffering (nginx)
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	response := c.chatbot.ProcessMessageStream(r.Context(), req.Message, req.SessionID, req.History, chatParams(req), func(token string) error {
+		if err := writeSSEEvent(w, "token", models.ChatStreamToken{Token: token}); err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	})
+
+	if err := writeSSEEvent(w, "done", response); err != nil {
+		log.Printf("Failed to send final stream event: %v", err)
+		return
+	}
+	flusher.Flush()
+}
+
+// validatePersona rejects requests naming a persona that doesn't exist
+func (c *Controller) validatePersona(w http.ResponseWriter, persona string) bool {
+	if persona == "" || c.chatbot.HasPersona(persona) {
+		return true
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(models.ChatResponse{
+		Message: fmt.Sprintf("Unknown persona: %s", persona),
+		Status:  "error",
+	})
+	return false
+}
+
+// validateSessionID rejects session IDs reserved for Discord conversations
+func validateSessionID(w http.ResponseWriter, sessionID string) bool {
+	if !strings.HasPrefix(sessionID, services.DiscordSessionPrefix) {
+		return true
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(models.ChatResponse{
+		Message: fmt.Sprintf("Session IDs starting with %q are reserved", services.DiscordSessionPrefix),
+		Status:  "error",
+	})
+	return false
+}
+
+// validateOptions rejects generation options the answering provider can't accept
+func (c *Controller) validateOptions(w http.ResponseWriter, options *models.GenerationOptions) bool {
+	err := c.chatbot.ValidateOptions(options)
+	if err == nil {
+		return true
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(models.ChatResponse{
+		Message: err.Error(),
+		Status:  "error",
+	})
+	return false
+}
+
+// validateSearchMode rejects search modes other than auto, always and never
+func validateSearchMode(w http.ResponseWriter, mode string) bool {
+	_, err := services.ParseSearchMode(mode)
+	if err == nil {
+		return true
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(models.ChatResponse{
+		Message: err.Error(),
+		Status:  "error",
+	})
+	return false
+}
+
+// splitConversation splits a client-side conversation into the new user message, the
+// earlier history and any system instructions, for APIs that send the whole conversation
+func splitConversation(messages []models.ChatMessage) (string, []models.ChatMessage, string, error) {
+	if len(messages) == 0 {
+		return "", nil, "", fmt.Errorf("messages must not be empty")
+	}
+	last := messages[len(messages)-1]
+	if last.Role != "user" || strings.TrimSpace(last.Content) == "" {
+		return "", nil, "", fmt.Errorf("the last message must be a non-empty user message")
+	}
+
+	var history []models.ChatMessage
+	var instructions []string
+	for _, msg := range messages[:len(messages)-1] {
+		content := strings.TrimSpace(msg.Content)
+		switch msg.Role {
+		case "system", "developer":
+			instructions = append(instructions, content)
+		case "user", "assistant":
+			history = append(history, models.ChatMessage{Role: msg.Role, Content: content})
+		}
+	}
+
+	return strings.TrimSpace(last.Content), history, strings.Join(instructions, "\n\n"), nil
+}
+
+// modelOverride returns the model a client asked for, or "" if it is the current model
+func (c *Controller) modelOverride(model string) string {
+	if model == c.chatbot.CurrentModel() {
+		return ""
+	}
+	return model
+}
+
+// chatParams returns the per-request chat settings; the search mode has been validated
+func chatParams(req models.ChatRequest) services.ChatParams {
+	search, _ := services.ParseSearchMode(req.Search)
+	return services.ChatParams{
+		Persona: req.Persona,
+		User:    req.User,
+		Options: req.Options,
+		Search:  search,
+	}
+}
+
+// writeSSEEvent writes a single Server-Sent Event with a JSON payload
+func writeSSEEvent(w http.ResponseWriter, event string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload)
+	return err
+}
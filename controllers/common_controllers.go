@@ -1,11 +1,16 @@
 package controllers
 
 import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
 	"fmt"
 	"html/template"
 	"log"
 	"net/http"
+	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"chatbot/services"
@@ -15,6 +20,7 @@ import (
 type Controller struct {
 	chatbot        *services.Chatbot
 	discordService *services.DiscordService
+	adminToken     string
 }
 
 // NewController creates a new controller instance
@@ -28,6 +34,26 @@ func NewController(llmProvider services.LLMProvider, enableSearch bool, enableRA
 	return &Controller{
 		chatbot:        chatbot,
 		discordService: discordService,
+		adminToken:     os.Getenv("ADMIN_TOKEN"),
+	}
+}
+
+// RequireAdmin allows a request only with "Authorization: Bearer <ADMIN_TOKEN>".
+// Admin endpoints are disabled when ADMIN_TOKEN is not set.
+func (c *Controller) RequireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if c.adminToken == "" {
+			http.Error(w, "Admin API disabled: set ADMIN_TOKEN to enable it", http.StatusForbidden)
+			return
+		}
+
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(c.adminToken)) != 1 {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		next(w, r)
 	}
 }
 
@@ -50,6 +76,10 @@ func (c *Controller) StartServices(enableDiscord bool) error {
 
 // StopServices stops all background services
 func (c *Controller) StopServices() error {
+	if err := c.chatbot.Close(); err != nil {
+		log.Printf("Failed to stop chatbot: %v", err)
+	}
+
 	if c.discordService != nil {
 		return c.discordService.Stop()
 	}
@@ -85,8 +115,17 @@ func (c *Controller) renderTemplate(w http.ResponseWriter, templatePath string,
 	}
 }
 
-// generateSessionID creates a simple session ID
+// generateSessionID creates a random session ID; IDs must be hard to guess since they unlock stored history
 func (c *Controller) generateSessionID() string {
-	// Simple session ID generation - in production, use proper UUID
-	return fmt.Sprintf("sess_%d", time.Now().UnixNano())
+	return randomID("sess_")
+}
+
+// randomID returns the prefix followed by 32 random hex digits
+func randomID(prefix string) string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		// Fall back to a time-based ID if the random source fails
+		return fmt.Sprintf("%s%d", prefix, time.Now().UnixNano())
+	}
+	return prefix + hex.EncodeToString(buf)
 }
@@ -0,0 +1,222 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"chatbot/models"
+	"chatbot/services"
+	"chatbot/utils"
+
+	"github.com/gorilla/mux"
+)
+
+// IndexDocumentsHandler indexes a path, a list of files, or the whole data folder
+func (c *Controller) IndexDocumentsHandler(w http.ResponseWriter, r *http.Request) {
+	ragService, err := c.chatbot.GetRAGService()
+	if err != nil {
+		writeIndexError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+
+	var req models.DocumentIndexRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeIndexError(w, http.StatusBadRequest, "Invalid JSON format")
+		return
+	}
+
+	var paths []string
+	if req.Path != "" {
+		paths = append(paths, req.Path)
+	}
+	paths = append(paths, req.Files...)
+
+	resolved := make([]string, 0, len(paths))
+	for _, path := range paths {
+		resolvedPath, err := ragService.ResolvePath(path)
+		if err != nil {
+			writeIndexError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		resolved = append(resolved, resolvedPath)
+	}
+
+	if req.Tags != nil {
+		tagPaths := resolved
+		if len(tagPaths) == 0 {
+			tagPaths = []string{ragService.DataPath()}
+		}
+		if err := ragService.TagFiles(tagPaths, req.Tags); err != nil {
+			writeIndexError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	var result *models.DocumentIndexResponse
+	if len(resolved) == 0 {
+		// Nothing specified: sync the whole data folder
+		result, err = ragService.Reindex(req.Force)
+	} else {
+		result, err = ragService.IndexFiles(resolved, req.Recursive, req.Force)
+	}
+
+	if err != nil {
+		log.Printf("Indexing failed: %v", err)
+		writeIndexError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(result)
+}
+
+// UploadDocumentsHandler stores multipart-uploaded files in the data folder and indexes them.
+// Files are sent in the "file" field; an optional "path" field selects a subfolder and
+// "tags" fields of the form key=value tag the uploaded files.
+func (c *Controller) UploadDocumentsHandler(w http.ResponseWriter, r *http.Request) {
+	ragService, err := c.chatbot.GetRAGService()
+	if err != nil {
+		writeIndexError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+
+	maxUpload := int64(utils.GetEnvInt("RAG_MAX_UPLOAD_MB", 20)) << 20
+	r.Body = http.MaxBytesReader(w, r.Body, maxUpload)
+	if err := r.ParseMultipartForm(maxUpload); err != nil {
+		writeIndexError(w, http.StatusBadRequest, "Invalid multipart upload: "+err.Error())
+		return
+	}
+
+	tags, err := parseTags(r.MultipartForm.Value["tags"])
+	if err != nil {
+		writeIndexError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	fileHeaders := r.MultipartForm.File["file"]
+	if len(fileHeaders) == 0 {
+		writeIndexError(w, http.StatusBadRequest, "No files in the \"file\" field")
+		return
+	}
+
+	var saved []string
+	for _, header := range fileHeaders {
+		file, err := header.Open()
+		if err != nil {
+			writeIndexError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		path, err := ragService.SaveDocument(r.FormValue("path"), header.Filename, file)
+		file.Close()
+		if err != nil {
+			writeIndexError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		saved = append(saved, path)
+	}
+
+	if tags != nil {
+		if err := ragService.TagFiles(saved, tags); err != nil {
+			writeIndexError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	result, err := ragService.IndexFiles(saved, false, r.FormValue("force") == "true")
+	if err != nil {
+		log.Printf("Indexing uploaded files failed: %v", err)
+		writeIndexError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(result)
+}
+
+// ListDocumentsHandler lists indexed sources with their chunk counts
+func (c *Controller) ListDocumentsHandler(w http.ResponseWriter, r *http.Request) {
+	ragService, err := c.chatbot.GetRAGService()
+	if err != nil {
+		writeIndexError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+
+	documents := ragService.ListDocuments()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(models.DocumentListResponse{
+		BaseResponse: models.BaseResponse{
+			Status:    models.StatusSuccess,
+			Timestamp: time.Now(),
+		},
+		Documents: documents,
+		Total:     len(documents),
+	})
+}
+
+// DeleteDocumentHandler removes a source from the index and the data folder
+func (c *Controller) DeleteDocumentHandler(w http.ResponseWriter, r *http.Request) {
+	ragService, err := c.chatbot.GetRAGService()
+	if err != nil {
+		writeIndexError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+
+	result, err := ragService.DeleteDocument(mux.Vars(r)["source"])
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrDocumentNotFound) {
+			status = http.StatusNotFound
+		}
+		writeIndexError(w, status, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(result)
+}
+
+// parseTags reads key=value pairs from form values, each holding one or more comma-separated pairs
+func parseTags(values []string) (map[string]string, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+
+	tags := make(map[string]string)
+	for _, value := range values {
+		for _, pair := range strings.Split(value, ",") {
+			if strings.TrimSpace(pair) == "" {
+				continue
+			}
+			key, tagValue, found := strings.Cut(pair, "=")
+			if !found {
+				return nil, fmt.Errorf("invalid tag %q, expected key=value", pair)
+			}
+			tags[strings.TrimSpace(key)] = strings.TrimSpace(tagValue)
+		}
+	}
+	return tags, services.ValidateTags(tags)
+}
+
+// writeIndexError writes a DocumentIndexResponse describing the error
+func writeIndexError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(models.DocumentIndexResponse{
+		BaseResponse: models.BaseResponse{
+			Status:    models.StatusError,
+			Error:     message,
+			Timestamp: time.Now(),
+		},
+	})
+}
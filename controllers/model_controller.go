@@ -0,0 +1,99 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"chatbot/models"
+	"chatbot/services"
+)
+
+// ListModelsHandler lists the current and available models of every configured backend
+func (c *Controller) ListModelsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(models.ModelsResponse{
+		BaseResponse: models.BaseResponse{
+			Status:    models.StatusSuccess,
+			Timestamp: time.Now(),
+		},
+		Provider:  string(c.chatbot.GetCurrentProvider()),
+		Providers: c.chatbot.ListModels(),
+	})
+}
+
+// SetActiveModelHandler switches the default model of a provider without a restart
+func (c *Controller) SetActiveModelHandler(w http.ResponseWriter, r *http.Request) {
+	var req models.SetModelRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.Model) == "" {
+		writeModelError(w, http.StatusBadRequest, "Request must be JSON with a model name")
+		return
+	}
+
+	previous, model, err := c.chatbot.SetActiveModel(services.LLMProvider(req.Provider), strings.TrimSpace(req.Model))
+	if err != nil {
+		status := http.StatusBadGateway
+		if errors.Is(err, services.ErrUnknownProvider) || errors.Is(err, services.ErrUnknownModel) {
+			status = http.StatusBadRequest
+		}
+		writeModelError(w, status, err.Error())
+		return
+	}
+
+	provider := req.Provider
+	if provider == "" {
+		provider = string(c.chatbot.GetCurrentProvider())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(models.SetModelResponse{
+		BaseResponse: models.BaseResponse{
+			Status:    models.StatusSuccess,
+			Timestamp: time.Now(),
+		},
+		Provider:      provider,
+		Model:         model,
+		PreviousModel: previous,
+	})
+}
+
+// servedModels lists every model the configured backends can serve, once each
+func (c *Controller) servedModels() []models.ProviderModels {
+	var served []models.ProviderModels
+	seen := make(map[string]bool)
+	add := func(model string, provider string) {
+		if model == "" || seen[model] {
+			return
+		}
+		seen[model] = true
+		served = append(served, models.ProviderModels{Provider: provider, Model: model})
+	}
+
+	for _, provider := range c.chatbot.ListModels() {
+		for _, model := range provider.Available {
+			add(model, provider.Provider)
+		}
+		// The current model may be configured without Ollama's ":latest" tag
+		if !seen[provider.Model+":latest"] {
+			add(provider.Model, provider.Provider)
+		}
+	}
+	return served
+}
+
+// writeModelError writes a model API error response
+func writeModelError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(models.SetModelResponse{
+		BaseResponse: models.BaseResponse{
+			Status:    models.StatusError,
+			Error:     message,
+			Timestamp: time.Now(),
+		},
+	})
+}
@@ -0,0 +1,171 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"chatbot/models"
+	"chatbot/services"
+)
+
+// ollamaCompatVersion is the Ollama API version reported to clients that check it
+const ollamaCompatVersion = "0.5.0"
+
+// ollamaRenderer builds a generate or chat reply line from a text fragment and its stats
+type ollamaRenderer func(model string, text string, stats models.OllamaStats) interface{}
+
+// OllamaGenerateHandler answers Ollama /api/generate requests through the chatbot, so
+// Ollama clients get the same RAG and search augmentation as /chat
+func (c *Controller) OllamaGenerateHandler(w http.ResponseWriter, r *http.Request) {
+	var req models.OllamaGenerateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeOllamaError(w, http.StatusBadRequest, fmt.Sprintf("invalid JSON: %v", err))
+		return
+	}
+	if strings.TrimSpace(req.Prompt) == "" {
+		writeOllamaError(w, http.StatusBadRequest, "prompt is required")
+		return
+	}
+
+	c.serveOllama(w, r, req.Model, req.Format, req.Stream, req.Options, strings.TrimSpace(req.Prompt), nil, req.System,
+		func(model string, text string, stats models.OllamaStats) interface{} {
+			return models.OllamaGenerateResponse{
+				Model:       model,
+				CreatedAt:   time.Now().UTC(),
+				Response:    text,
+				OllamaStats: stats,
+			}
+		})
+}
+
+// OllamaChatHandler answers Ollama /api/chat requests through the chatbot
+func (c *Controller) OllamaChatHandler(w http.ResponseWriter, r *http.Request) {
+	var req models.OllamaChatRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeOllamaError(w, http.StatusBadRequest, fmt.Sprintf("invalid JSON: %v", err))
+		return
+	}
+
+	messages := make([]models.ChatMessage, len(req.Messages))
+	for i, msg := range req.Messages {
+		messages[i] = models.ChatMessage{Role: msg.Role, Content: msg.Content}
+	}
+	message, history, instructions, err := splitConversation(messages)
+	if err != nil {
+		writeOllamaError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	c.serveOllama(w, r, req.Model, req.Format, req.Stream, req.Options, message, history, instructions,
+		func(model string, text string, stats models.OllamaStats) interface{} {
+			return models.OllamaChatResponse{
+				Model:       model,
+				CreatedAt:   time.Now().UTC(),
+				Message:     models.OllamaMessage{Role: "assistant", Content: text},
+				OllamaStats: stats,
+			}
+		})
+}
+
+// OllamaTagsHandler lists the models of every configured backend in the Ollama format
+func (c *Controller) OllamaTagsHandler(w http.ResponseWriter, r *http.Request) {
+	tags := models.OllamaTagsResponse{Models: []models.OllamaModel{}}
+	for _, model := range c.servedModels() {
+		tags.Models = append(tags.Models, models.OllamaModel{Name: model.Model, Model: model.Model})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(tags)
+}
+
+// OllamaVersionHandler reports the Ollama API version for clients that check it on connect
+func (c *Controller) OllamaVersionHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"version": ollamaCompatVersion})
+}
+
+// serveOllama runs a message through the chatbot and writes the reply as a single JSON
+// object, or as NDJSON lines when streaming, which Ollama does by default
+func (c *Controller) serveOllama(w http.ResponseWriter, r *http.Request, model string, format string, stream *bool, ollamaOptions *models.OllamaOptions, message string, history []models.ChatMessage, instructions string, render ollamaRenderer) {
+	options := &models.GenerationOptions{Model: c.modelOverride(model), Format: format}
+	if ollamaOptions != nil {
+		options.Temperature = ollamaOptions.Temperature
+		options.TopP = ollamaOptions.TopP
+		options.MaxTokens = ollamaOptions.NumPredict
+		options.Seed = ollamaOptions.Seed
+		options.Stop = ollamaOptions.Stop
+	}
+	if err := c.chatbot.ValidateOptions(options); err != nil {
+		writeOllamaError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// The client sends the whole conversation each time, so nothing is stored in a session
+	params := services.ChatParams{Options: options, Instructions: instructions}
+	if model == "" {
+		model = c.chatbot.CurrentModel()
+	}
+	start := time.Now()
+
+	if stream != nil && !*stream {
+		response := c.chatbot.ProcessMessage(message, "", history, params)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(render(model, response.Message, ollamaStats(response, start, message, history)))
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeOllamaError(w, http.StatusInternalServerError, "streaming not supported")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // Disable proxy buffering (nginx)
+	w.WriteHeader(http.StatusOK)
+	encoder := json.NewEncoder(w)
+
+	response := c.chatbot.ProcessMessageStream(r.Context(), message, "", history, params, func(token string) error {
+		if err := encoder.Encode(render(model, token, models.OllamaStats{})); err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	})
+
+	if response.Status == models.StatusError {
+		log.Printf("Ollama stream failed: %s", response.Error)
+		encoder.Encode(models.OllamaErrorResponse{Error: response.Error})
+	} else {
+		encoder.Encode(render(model, "", ollamaStats(response, start, message, history)))
+	}
+	flusher.Flush()
+}
+
+// ollamaStats builds the closing stats of a reply
+func ollamaStats(response models.ChatResponse, start time.Time, message string, history []models.ChatMessage) models.OllamaStats {
+	usage := openAIUsage(response, message, history)
+	return models.OllamaStats{
+		Done:            true,
+		DoneReason:      finishReason(response),
+		TotalDuration:   time.Since(start).Nanoseconds(),
+		PromptEvalCount: usage.PromptTokens,
+		EvalCount:       usage.CompletionTokens,
+		Sources:         response.Sources,
+	}
+}
+
+// writeOllamaError writes an error in the Ollama format
+func writeOllamaError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(models.OllamaErrorResponse{Error: message})
+}
@@ -0,0 +1,230 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"chatbot/models"
+	"chatbot/services"
+)
+
+// OpenAI finish reasons
+const (
+	openAIFinishStop   = "stop"
+	openAIFinishLength = "length"
+)
+
+// OpenAIChatCompletionsHandler answers OpenAI-style chat completion requests through the
+// chatbot, so OpenAI clients get the same RAG and search augmentation as /chat
+func (c *Controller) OpenAIChatCompletionsHandler(w http.ResponseWriter, r *http.Request) {
+	var req models.OpenAIChatRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", fmt.Sprintf("Invalid JSON: %v", err))
+		return
+	}
+
+	message, history, instructions, err := openAIConversation(req.Messages)
+	if err != nil {
+		writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", err.Error())
+		return
+	}
+
+	options := &models.GenerationOptions{
+		Temperature: req.Temperature,
+		TopP:        req.TopP,
+		MaxTokens:   req.MaxTokens,
+		Seed:        req.Seed,
+		Stop:        req.Stop,
+		Model:       c.modelOverride(req.Model),
+	}
+	if req.ResponseFormat != nil {
+		switch req.ResponseFormat.Type {
+		case "json_object":
+			options.Format = "json"
+		case "text", "":
+		default:
+			writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", "response_format must be text or json_object")
+			return
+		}
+	}
+	if err := c.chatbot.ValidateOptions(options); err != nil {
+		writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", err.Error())
+		return
+	}
+
+	params := services.ChatParams{
+		User:         req.User,
+		Options:      options,
+		Instructions: instructions,
+	}
+	// The client sends the whole conversation each time, so nothing is stored in a session
+	id := randomID("chatcmpl-")
+	created := time.Now().Unix()
+
+	if req.Stream {
+		c.streamOpenAIChat(w, r, req, id, created, message, history, params)
+		return
+	}
+
+	response := c.chatbot.ProcessMessage(message, "", history, params)
+
+	finish := finishReason(response)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(models.OpenAIChatResponse{
+		ID:      id,
+		Object:  "chat.completion",
+		Created: created,
+		Model:   responseModel(response),
+		Choices: []models.OpenAIChoice{{
+			Message:      &models.OpenAIReply{Role: "assistant", Content: response.Message},
+			FinishReason: &finish,
+		}},
+		Usage:   openAIUsage(response, message, history),
+		Sources: response.Sources,
+	})
+}
+
+// streamOpenAIChat sends the reply as OpenAI chat.completion.chunk events, ending with [DONE]
+func (c *Controller) streamOpenAIChat(w http.ResponseWriter, r *http.Request, req models.OpenAIChatRequest, id string, created int64, message string, history []models.ChatMessage, params services.ChatParams) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeOpenAIError(w, http.StatusInternalServerError, "server_error", "Streaming not supported")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no") // Disable proxy buffering (nginx)
+	w.WriteHeader(http.StatusOK)
+
+	model := req.Model
+	if model == "" {
+		model = c.chatbot.CurrentModel()
+	}
+	chunk := func(delta models.OpenAIReply, finish *string) models.OpenAIChatResponse {
+		return models.OpenAIChatResponse{
+			ID:      id,
+			Object:  "chat.completion.chunk",
+			Created: created,
+			Model:   model,
+			Choices: []models.OpenAIChoice{{Delta: &delta, FinishReason: finish}},
+		}
+	}
+
+	if err := writeOpenAIChunk(w, chunk(models.OpenAIReply{Role: "assistant"}, nil)); err != nil {
+		return
+	}
+	flusher.Flush()
+
+	response := c.chatbot.ProcessMessageStream(r.Context(), message, "", history, params, func(token string) error {
+		if err := writeOpenAIChunk(w, chunk(models.OpenAIReply{Content: token}, nil)); err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	})
+
+	if response.Status == models.StatusError {
+		log.Printf("OpenAI stream %s failed: %s", id, response.Error)
+		writeOpenAIChunk(w, models.OpenAIErrorResponse{Error: models.OpenAIError{
+			Message: response.Error,
+			Type:    "server_error",
+		}})
+	} else {
+		finish := finishReason(response)
+		last := chunk(models.OpenAIReply{}, &finish)
+		last.Sources = response.Sources
+		writeOpenAIChunk(w, last)
+
+		if req.StreamOptions != nil && req.StreamOptions.IncludeUsage {
+			usage := chunk(models.OpenAIReply{}, nil)
+			usage.Choices = []models.OpenAIChoice{}
+			usage.Usage = openAIUsage(response, message, history)
+			writeOpenAIChunk(w, usage)
+		}
+	}
+
+	fmt.Fprint(w, "data: [DONE]\n\n")
+	flusher.Flush()
+}
+
+// OpenAIModelsHandler lists the models of every configured backend in the OpenAI format
+func (c *Controller) OpenAIModelsHandler(w http.ResponseWriter, r *http.Request) {
+	list := models.OpenAIModelList{Object: "list", Data: []models.OpenAIModel{}}
+	for _, model := range c.servedModels() {
+		list.Data = append(list.Data, models.OpenAIModel{ID: model.Model, Object: "model", OwnedBy: model.Provider})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(list)
+}
+
+// openAIConversation converts OpenAI messages and splits them into the new user message,
+// the earlier history and any system instructions
+func openAIConversation(messages []models.OpenAIMessage) (string, []models.ChatMessage, string, error) {
+	converted := make([]models.ChatMessage, len(messages))
+	for i, msg := range messages {
+		converted[i] = models.ChatMessage{Role: msg.Role, Content: string(msg.Content)}
+	}
+	return splitConversation(converted)
+}
+
+// responseModel returns the model that produced a response
+func responseModel(response models.ChatResponse) string {
+	if response.Metadata == nil {
+		return ""
+	}
+	if response.Metadata.Model != "" {
+		return response.Metadata.Model
+	}
+	return response.Metadata.Provider
+}
+
+// finishReason reports "length" for replies cut to the response policy, as OpenAI and Ollama do
+func finishReason(response models.ChatResponse) string {
+	if response.Truncated {
+		return openAIFinishLength
+	}
+	return openAIFinishStop
+}
+
+// openAIUsage estimates token usage, preferring the prompt builder's count of the prompt
+func openAIUsage(response models.ChatResponse, message string, history []models.ChatMessage) *models.OpenAIUsage {
+	usage := &models.OpenAIUsage{CompletionTokens: services.EstimateTokens(response.Message)}
+	if response.Metadata != nil && response.Metadata.Prompt != nil {
+		usage.PromptTokens = response.Metadata.Prompt.Used
+	} else {
+		usage.PromptTokens = services.EstimateTokens(message)
+		for _, msg := range history {
+			usage.PromptTokens += services.EstimateTokens(msg.Content)
+		}
+	}
+	usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	return usage
+}
+
+// writeOpenAIChunk writes one server-sent event in the OpenAI streaming format
+func writeOpenAIChunk(w http.ResponseWriter, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "data: %s\n\n", payload)
+	return err
+}
+
+// writeOpenAIError writes an error in the OpenAI format
+func writeOpenAIError(w http.ResponseWriter, status int, errType string, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(models.OpenAIErrorResponse{Error: models.OpenAIError{
+		Message: message,
+		Type:    errType,
+	}})
+}
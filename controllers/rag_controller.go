@@ -2,6 +2,7 @@ package controllers
 
 import (
 	"chatbot/models"
+	"chatbot/services"
 	"encoding/json"
 	"net/http"
 	"strings"
@@ -35,13 +36,42 @@ func (c *Controller) RAGHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Validate fusion weights
+	if (req.VectorWeight != nil && *req.VectorWeight < 0) || (req.KeywordWeight != nil && *req.KeywordWeight < 0) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "vector_weight and keyword_weight must not be negative",
+		})
+		return
+	}
+
+	// Validate filter
+	if err := services.ValidateRAGFilter(req.Filter); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": err.Error(),
+		})
+		return
+	}
+
 	// Set default limit
 	if req.Limit <= 0 {
 		req.Limit = 5
 	}
 
 	// Process query through chatbot service (which will use RAG if enabled)
-	ragResponse := c.chatbot.ProcessRAGQuery(req.Query, req.ChannelID, req.Limit)
+	ragResponse := c.chatbot.ProcessRAGQuery(r.Context(), models.RAGQuery{
+		Query:         req.Query,
+		ChannelID:     req.ChannelID,
+		Limit:         req.Limit,
+		Threshold:     req.Threshold,
+		VectorWeight:  req.VectorWeight,
+		KeywordWeight: req.KeywordWeight,
+		Filter:        req.Filter,
+		Rerank:        req.Rerank,
+	})
 
 	// Return JSON response
 	w.Header().Set("Content-Type", "application/json")
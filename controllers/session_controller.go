@@ -0,0 +1,73 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"chatbot/models"
+	"chatbot/services"
+
+	"github.com/gorilla/mux"
+)
+
+// GetSessionHandler returns the stored conversation history for a session
+func (c *Controller) GetSessionHandler(w http.ResponseWriter, r *http.Request) {
+	sessionID := mux.Vars(r)["id"]
+
+	session, err := c.chatbot.GetSession(sessionID)
+	if err != nil {
+		writeSessionError(w, sessionID, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(models.SessionResponse{
+		BaseResponse: models.BaseResponse{
+			Status:    models.StatusSuccess,
+			Timestamp: time.Now(),
+		},
+		Session: session,
+	})
+}
+
+// DeleteSessionHandler removes the stored conversation history for a session
+func (c *Controller) DeleteSessionHandler(w http.ResponseWriter, r *http.Request) {
+	sessionID := mux.Vars(r)["id"]
+
+	if err := c.chatbot.DeleteSession(sessionID); err != nil {
+		writeSessionError(w, sessionID, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(models.SessionResponse{
+		BaseResponse: models.BaseResponse{
+			Status:    models.StatusSuccess,
+			Timestamp: time.Now(),
+		},
+	})
+}
+
+// writeSessionError writes a 404 for missing sessions and a 500 for store failures
+func writeSessionError(w http.ResponseWriter, sessionID string, err error) {
+	status := http.StatusNotFound
+	if !errors.Is(err, services.ErrSessionNotFound) {
+		log.Printf("Session store error for %s: %v", sessionID, err)
+		status = http.StatusInternalServerError
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(models.SessionResponse{
+		BaseResponse: models.BaseResponse{
+			Status:    models.StatusError,
+			Error:     err.Error(),
+			Timestamp: time.Now(),
+		},
+	})
+}
@@ -19,11 +19,20 @@ func (c *Controller) HealthHandler(w http.ResponseWriter, r *http.Request) {
 	chatbotStatus := c.chatbot.GetStatus()
 	discordStatus := c.discordService.GetStatus()
 
+	endpoints := []string{
+		"/", "/chat", "/chat/stream", "/health", "/sessions/{id}", "/models", "/models/active",
+		"/v1/chat/completions", "/v1/models",
+		"/api/generate", "/api/chat", "/api/tags", "/api/version",
+	}
+	if _, err := c.chatbot.GetRAGService(); err == nil {
+		endpoints = append(endpoints, "/rag", "/rag/index", "/rag/documents", "/rag/documents/{source}")
+	}
+
 	health := map[string]interface{}{
 		"status":    "healthy",
 		"phase":     "3+",
 		"component": "mvc-with-chatbot-and-discord",
-		"endpoints": []string{"/", "/chat", "/health"},
+		"endpoints": endpoints,
 		"chatbot":   chatbotStatus,
 		"discord":   discordStatus,
 	}
@@ -4,13 +4,16 @@ go 1.21
 
 require (
 	github.com/bwmarrin/discordgo v0.28.1
+	github.com/fsnotify/fsnotify v1.7.0
 	github.com/gorilla/mux v1.8.1
+	github.com/ledongthuc/pdf v0.0.0-20220302134840-0c2507a12d80
 	github.com/philippgille/chromem-go v0.7.0
 	github.com/rs/cors v1.11.1
+	golang.org/x/net v0.17.0
 )
 
 require (
 	github.com/gorilla/websocket v1.4.2 // indirect
-	golang.org/x/crypto v0.0.0-20210421170649-83a5a9bb288b // indirect
-	golang.org/x/sys v0.0.0-20201119102817-f84b799fce68 // indirect
+	golang.org/x/crypto v0.14.0 // indirect
+	golang.org/x/sys v0.13.0 // indirect
 )
@@ -62,9 +62,28 @@ func (s *Server) setupRoutes() {
 
 	// API routes
 	s.router.HandleFunc("/chat", s.controller.ChatHandler).Methods("POST")
+	s.router.HandleFunc("/chat/stream", s.controller.ChatStreamHandler).Methods("POST")
 	s.router.HandleFunc("/health", s.controller.HealthHandler).Methods("GET")
+	s.router.HandleFunc("/sessions/{id}", s.controller.RequireAdmin(s.controller.GetSessionHandler)).Methods("GET")
+	s.router.HandleFunc("/sessions/{id}", s.controller.RequireAdmin(s.controller.DeleteSessionHandler)).Methods("DELETE")
+	s.router.HandleFunc("/models", s.controller.ListModelsHandler).Methods("GET")
+	s.router.HandleFunc("/models/active", s.controller.RequireAdmin(s.controller.SetActiveModelHandler)).Methods("PUT")
+
+	// OpenAI-compatible API, so OpenAI clients can use the chatbot by changing their base URL
+	s.router.HandleFunc("/v1/chat/completions", s.controller.OpenAIChatCompletionsHandler).Methods("POST")
+	s.router.HandleFunc("/v1/models", s.controller.OpenAIModelsHandler).Methods("GET")
+
+	// Ollama-compatible API, so Ollama clients such as Open WebUI can use the chatbot
+	s.router.HandleFunc("/api/generate", s.controller.OllamaGenerateHandler).Methods("POST")
+	s.router.HandleFunc("/api/chat", s.controller.OllamaChatHandler).Methods("POST")
+	s.router.HandleFunc("/api/tags", s.controller.OllamaTagsHandler).Methods("GET")
+	s.router.HandleFunc("/api/version", s.controller.OllamaVersionHandler).Methods("GET")
 	if s.enableRAG {
 		s.router.HandleFunc("/rag", s.controller.RAGHandler).Methods("POST")
+		s.router.HandleFunc("/rag/index", s.controller.RequireAdmin(s.controller.IndexDocumentsHandler)).Methods("POST")
+		s.router.HandleFunc("/rag/documents", s.controller.RequireAdmin(s.controller.UploadDocumentsHandler)).Methods("POST")
+		s.router.HandleFunc("/rag/documents", s.controller.ListDocumentsHandler).Methods("GET")
+		s.router.HandleFunc("/rag/documents/{source:.+}", s.controller.RequireAdmin(s.controller.DeleteDocumentHandler)).Methods("DELETE")
 	}
 }
 
@@ -80,7 +99,7 @@ func (s *Server) Start() error {
 	// Setup CORS for future frontend integration
 	c := cors.New(cors.Options{
 		AllowedOrigins:   []string{"*"},
-		AllowedMethods:   []string{"GET", "POST", "OPTIONS"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
 		AllowedHeaders:   []string{"*"},
 		AllowCredentials: true,
 	})
@@ -90,6 +109,10 @@ func (s *Server) Start() error {
 	log.Printf("🚀 Starting RAG Chatbot Server (Phase 3+ - Multi-Service) on port %s", s.port)
 	log.Printf("📱 Web interface: http://localhost%s", s.port)
 	log.Printf("💬 Chat API: http://localhost%s/chat", s.port)
+	log.Printf("📡 Streaming Chat API: http://localhost%s/chat/stream", s.port)
+	log.Printf("🧠 Models API: http://localhost%s/models", s.port)
+	log.Printf("🔌 OpenAI-compatible API: http://localhost%s/v1", s.port)
+	log.Printf("🦙 Ollama-compatible API: http://localhost%s/api", s.port)
 	log.Printf("❤️  Health check: http://localhost%s/health", s.port)
 
 	if s.enableDiscord {
@@ -207,7 +230,7 @@ func main() {
 		enableDiscord = flag.Bool("discord", false, "Enable Discord bot service")
 		useChatGPT    = flag.Bool("chatgpt", false, "Use ChatGPT instead of local LLM")
 		useLocal      = flag.Bool("local", false, "Force use of local LLM (Ollama)")
-		enableSearch  = flag.Bool("search", false, "Enable web search for ChatGPT (requires Brave Search API)")
+		enableSearch  = flag.Bool("search", false, "Enable web search (requires Brave Search API)")
 		enableHTTPS   = flag.Bool("https", false, "Enable HTTPS server (requires SSL_CERT_FILE and SSL_KEY_FILE)")
 		enableRAG     = flag.Bool("rag", false, "Enable RAG (Retrieval-Augmented Generation) with document indexing")
 		showHelp      = flag.Bool("help", false, "Show help information")
@@ -359,7 +382,7 @@ func showUsage() {
 	log.Printf("  --discord          Enable Discord bot service (default false)")
 	log.Printf("  --chatgpt          Use ChatGPT as primary LLM provider (default false)")
 	log.Printf("  --local            Force use of local LLM/Ollama (default false)")
-	log.Printf("  --search           Enable web search for ChatGPT (default false)")
+	log.Printf("  --search           Enable web search (default false)")
 	log.Printf("  --https            Enable HTTPS server (default false)")
 	log.Printf("  --rag              Enable RAG with document indexing (default false)")
 	log.Printf("  --help             Show this help information")
@@ -376,12 +399,46 @@ func showUsage() {
 	log.Printf("  SSL_KEY_FILE            Path to SSL private key file (required for HTTPS)")
 	log.Printf("  DISCORD_BOT_TOKEN       Discord bot token (required for Discord)")
 	log.Printf("  DISCORD_COMMAND_PREFIX  Discord command prefix (default \"!chat \")")
+	log.Printf("  DISCORD_CHANNEL_PERSONAS  Persona per Discord channel (e.g., \"123456=support,789012=casual\")")
+	log.Printf("  PERSONA_DIR             Folder of persona templates (default \"./personas\")")
+	log.Printf("  PERSONA_DEFAULT         Persona used when none is selected (default \"default\")")
 	log.Printf("  OPENAI_API_KEY          OpenAI API key (required for ChatGPT)")
 	log.Printf("  OPENAI_MODEL            OpenAI model (default \"gpt-3.5-turbo\")")
 	log.Printf("  OPENAI_BASE_URL         OpenAI API URL (default \"https://api.openai.com/v1\")")
+	log.Printf("  OPENAI_CONTEXT_WINDOW   Prompt and reply token limit (default: known size of OPENAI_MODEL)")
 	log.Printf("  BRAVE_SEARCH_API_KEY    Brave Search API key (required for web search)")
 	log.Printf("  LLM_BASE_URL           Local LLM URL (default \"http://localhost:11434\")")
 	log.Printf("  LLM_MODEL              Local LLM model (default \"tinyllama\")")
+	log.Printf("  LLM_NUM_CTX            Context window requested from the local LLM (default 1024)")
+	log.Printf("  LLM_BACKENDS           Backends to initialize in auto-detect mode (e.g., \"local,chatgpt\")")
+	log.Printf("  LLM_FALLBACK_CHAIN     Order in which providers are tried (e.g., \"local,chatgpt,dummy\")")
+	log.Printf("  CIRCUIT_BREAKER_THRESHOLD  Consecutive failures before a provider is skipped (default 3)")
+	log.Printf("  CIRCUIT_BREAKER_COOLDOWN   Time before a failed provider is retried (default \"30s\")")
+	log.Printf("  PROVIDER_CHECK_INTERVAL    How often provider availability is re-checked (default \"1m\")")
+	log.Printf("  RAG_DATA_PATH          Folder of documents to index (default \"./data\")")
+	log.Printf("  RAG_COLLECTION         Vector collection name (default \"chatbot_knowledge\")")
+	log.Printf("  RAG_PERSIST_PATH       Store the RAG index on disk here so it survives restarts")
+	log.Printf("  RAG_EMBEDDING_PROVIDER Embeddings: auto, openai, ollama, openai-compat or hash (default auto)")
+	log.Printf("  RAG_EMBEDDING_MODEL    Embedding model (ollama default \"nomic-embed-text\")")
+	log.Printf("  RAG_EMBEDDING_URL      Embedding API URL (ollama defaults to LLM_BASE_URL)")
+	log.Printf("  RAG_VECTOR_WEIGHT      Weight of vector search in hybrid ranking (default 1)")
+	log.Printf("  RAG_KEYWORD_WEIGHT     Weight of BM25 keyword search in hybrid ranking (default 1)")
+	log.Printf("  RAG_THRESHOLD          Minimum similarity for RAG results, also in chat context (default 0)")
+	log.Printf("  RAG_RERANKER           Re-ranking stages, comma-separated: llm, lexical, mmr (default none)")
+	log.Printf("  RAG_RERANK_CANDIDATES  Chunks retrieved for re-ranking (default 20)")
+	log.Printf("  RAG_MMR_LAMBDA         Relevance vs. diversity for mmr re-ranking, 0 to 1 (default 0.7)")
+	log.Printf("  RAG_CHUNKER            Chunking strategy: auto, recursive, markdown or code (default auto)")
+	log.Printf("  RAG_CHUNK_SIZE         Chunk size in tokens (default 256)")
+	log.Printf("  RAG_CHUNK_OVERLAP      Tokens repeated between neighbouring chunks (default 32)")
+	log.Printf("  RAG_MAX_UPLOAD_MB      Size limit for document uploads (default 20)")
+	log.Printf("  RAG_WATCH              Re-index documents as files in the data folder change (\"true\" to enable)")
+	log.Printf("  RAG_WATCH_MODE         \"auto\", \"fsnotify\" or \"poll\" (default \"auto\")")
+	log.Printf("  RAG_WATCH_DEBOUNCE     Quiet period before a re-index pass (default \"2s\")")
+	log.Printf("  RAG_WATCH_POLL_INTERVAL  Scan interval in poll mode (default \"10s\")")
+	log.Printf("  SESSION_STORE          Conversation history store: \"memory\" or \"file\" (default \"memory\")")
+	log.Printf("  SESSION_DIR            Directory for the file session store (default \"./sessions\")")
+	log.Printf("  SESSION_TTL            Idle time before a session expires (default \"30m\")")
+	log.Printf("  SESSION_MAX_MESSAGES   Messages kept per session (default 50)")
 	log.Printf("")
 	log.Printf(".env File Setup:")
 	log.Printf("  Create a .env file in the project root with:")
@@ -1,6 +1,9 @@
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 // HelloRequest represents the hello endpoint request
 type HelloRequest struct {
@@ -17,8 +20,23 @@ type HelloResponse struct {
 // ChatRequest represents an incoming chat request
 type ChatRequest struct {
 	BaseRequest
-	Message string        `json:"message"`
-	History []ChatMessage `json:"history,omitempty"`
+	Message string             `json:"message"`
+	History []ChatMessage      `json:"history,omitempty"`
+	Persona string             `json:"persona,omitempty"` // System prompt template; empty uses the default
+	User    string             `json:"user,omitempty"`    // Name of the person asking, for persona templates
+	Options *GenerationOptions `json:"options,omitempty"`
+	Search  string             `json:"search,omitempty"` // "auto" (default), "always" or "never"
+}
+
+// GenerationOptions override the provider's sampling settings for one request
+type GenerationOptions struct {
+	Temperature *float64 `json:"temperature,omitempty"`
+	MaxTokens   *int     `json:"max_tokens,omitempty"`
+	TopP        *float64 `json:"top_p,omitempty"`
+	Seed        *int     `json:"seed,omitempty"` // Fixed seed for reproducible replies
+	Stop        []string `json:"stop,omitempty"`
+	Model       string   `json:"model,omitempty"`  // Model to use instead of the provider's configured one
+	Format      string   `json:"format,omitempty"` // "json" asks for a JSON reply
 }
 
 // ChatMessage represents a single message in conversation history
@@ -31,12 +49,78 @@ type ChatMessage struct {
 // ChatResponse represents the response from the chatbot
 type ChatResponse struct {
 	BaseResponse
-	Message   string    `json:"message"`
-	SessionID string    `json:"session_id"`
-	Context   []string  `json:"context,omitempty"` // Retrieved document snippets
-	Sources   []string  `json:"sources,omitempty"` // Source document names
-	Status    string    `json:"status"`            // "success" or "error",
-	Timestamp time.Time `json:"timestamp"`         // Response timestamp
+	Message   string            `json:"message"`
+	SessionID string            `json:"session_id"`
+	Context   []string          `json:"context,omitempty"`    // Numbered context blocks given to the model
+	Sources   []Citation        `json:"sources,omitempty"`    // Where each context block came from
+	Truncated bool              `json:"truncated"`            // The reply was cut to the response policy's length limit
+	ToolCalls []ToolInvocation  `json:"tool_calls,omitempty"` // Tools the model called while answering
+	Status    string            `json:"status"`               // "success" or "error",
+	Timestamp time.Time         `json:"timestamp"`            // Response timestamp
+	Metadata  *ResponseMetadata `json:"metadata,omitempty"`   // How the response was produced
+}
+
+// ToolInvocation records one tool call made by the model
+type ToolInvocation struct {
+	Name       string          `json:"name"`
+	Arguments  json.RawMessage `json:"arguments"`
+	Result     string          `json:"result,omitempty"` // Output given to the model
+	Error      string          `json:"error,omitempty"`
+	Round      int             `json:"round"` // Agent loop iteration, starting at 1
+	DurationMs int64           `json:"duration_ms"`
+}
+
+// ResponseMetadata describes which model answered and how its prompt was assembled
+type ResponseMetadata struct {
+	Provider  string        `json:"provider"`
+	Model     string        `json:"model,omitempty"`
+	Persona   string        `json:"persona,omitempty"`
+	MaxTokens int           `json:"max_tokens,omitempty"` // Reply length requested from the model
+	Prompt    *PromptReport `json:"prompt,omitempty"`
+}
+
+// PromptReport shows how the prompt was fitted into the model's context window
+type PromptReport struct {
+	ContextWindow int            `json:"context_window"` // Tokens the model accepts
+	OutputReserve int            `json:"output_reserve"` // Tokens kept free for the reply
+	Budget        int            `json:"budget"`         // Tokens available for the prompt
+	Used          int            `json:"used"`           // Estimated prompt tokens
+	Allocations   map[string]int `json:"allocations"`    // Tokens allotted to each section
+	Dropped       []PromptDrop   `json:"dropped,omitempty"`
+}
+
+// PromptDrop records a part of the prompt that was trimmed, summarized or left out to fit the budget
+type PromptDrop struct {
+	Section  string `json:"section"`            // "documents", "search", "history" or "message"
+	Citation int    `json:"citation,omitempty"` // Number of the context block, if any
+	Count    int    `json:"count,omitempty"`    // Number of messages affected
+	Action   string `json:"action"`             // "trimmed", "summarized" or "dropped"
+	Tokens   int    `json:"tokens"`             // Estimated tokens removed
+}
+
+// Citation types
+const (
+	CitationDocument = "document"
+	CitationWeb      = "web"
+)
+
+// Citation describes the source of a numbered context block. The model cites a block
+// with its number in brackets, e.g. [1].
+type Citation struct {
+	Number     int     `json:"number"`
+	Type       string  `json:"type"`                  // "document" or "web"
+	File       string  `json:"file,omitempty"`        // Path relative to the data folder
+	ChunkIndex *int    `json:"chunk_index,omitempty"` // Chunk within the file
+	Page       int     `json:"page,omitempty"`
+	Title      string  `json:"title,omitempty"` // Section heading or web page title
+	URL        string  `json:"url,omitempty"`
+	Score      float32 `json:"score,omitempty"` // Retrieval score
+	Cited      bool    `json:"cited"`           // Whether the response refers to this block
+}
+
+// ChatStreamToken represents a single streamed fragment of a chat response
+type ChatStreamToken struct {
+	Token string `json:"token"`
 }
 
 // LLMProvider represents the type of LLM provider
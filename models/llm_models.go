@@ -0,0 +1,30 @@
+package models
+
+// ProviderModels lists the models of one LLM backend
+type ProviderModels struct {
+	Provider  string   `json:"provider"`
+	Model     string   `json:"model"`               // Model used by requests that don't name one
+	Available []string `json:"available,omitempty"` // Models the provider can serve
+	Error     string   `json:"error,omitempty"`     // Why the list couldn't be fetched
+}
+
+// ModelsResponse lists the models of every configured backend
+type ModelsResponse struct {
+	BaseResponse
+	Provider  string           `json:"provider"` // Provider currently answering requests
+	Providers []ProviderModels `json:"providers"`
+}
+
+// SetModelRequest switches the default model of a provider
+type SetModelRequest struct {
+	Provider string `json:"provider,omitempty"` // Empty selects the provider currently answering
+	Model    string `json:"model"`
+}
+
+// SetModelResponse reports a model switch
+type SetModelResponse struct {
+	BaseResponse
+	Provider      string `json:"provider,omitempty"`
+	Model         string `json:"model,omitempty"`
+	PreviousModel string `json:"previous_model,omitempty"`
+}
@@ -0,0 +1,83 @@
+package models
+
+import "time"
+
+// OllamaOptions are the Ollama sampling options the chatbot passes on; others are ignored
+type OllamaOptions struct {
+	Temperature *float64 `json:"temperature,omitempty"`
+	TopP        *float64 `json:"top_p,omitempty"`
+	NumPredict  *int     `json:"num_predict,omitempty"`
+	Seed        *int     `json:"seed,omitempty"`
+	Stop        []string `json:"stop,omitempty"`
+}
+
+// OllamaGenerateRequest is a request to the Ollama-compatible generate endpoint
+type OllamaGenerateRequest struct {
+	Model   string         `json:"model"`
+	Prompt  string         `json:"prompt"`
+	System  string         `json:"system,omitempty"`
+	Format  string         `json:"format,omitempty"` // Only "json" is supported
+	Stream  *bool          `json:"stream,omitempty"` // Ollama streams unless this is false
+	Options *OllamaOptions `json:"options,omitempty"`
+}
+
+// OllamaChatRequest is a request to the Ollama-compatible chat endpoint
+type OllamaChatRequest struct {
+	Model    string          `json:"model"`
+	Messages []OllamaMessage `json:"messages"`
+	Format   string          `json:"format,omitempty"` // Only "json" is supported
+	Stream   *bool           `json:"stream,omitempty"` // Ollama streams unless this is false
+	Options  *OllamaOptions  `json:"options,omitempty"`
+}
+
+// OllamaMessage is one message of an Ollama conversation
+type OllamaMessage struct {
+	Role    string `json:"role"` // "system", "user" or "assistant"
+	Content string `json:"content"`
+}
+
+// OllamaGenerateResponse is a generate reply, or one line of a streamed reply
+type OllamaGenerateResponse struct {
+	Model     string    `json:"model"`
+	CreatedAt time.Time `json:"created_at"`
+	Response  string    `json:"response"`
+	OllamaStats
+}
+
+// OllamaChatResponse is a chat reply, or one line of a streamed reply
+type OllamaChatResponse struct {
+	Model     string        `json:"model"`
+	CreatedAt time.Time     `json:"created_at"`
+	Message   OllamaMessage `json:"message"`
+	OllamaStats
+}
+
+// OllamaStats closes a reply; only the last line of a stream has Done set
+type OllamaStats struct {
+	Done            bool       `json:"done"`
+	DoneReason      string     `json:"done_reason,omitempty"`       // "stop" or "length"
+	TotalDuration   int64      `json:"total_duration,omitempty"`    // Nanoseconds
+	PromptEvalCount int        `json:"prompt_eval_count,omitempty"` // Estimated
+	EvalCount       int        `json:"eval_count,omitempty"`        // Estimated
+	Sources         []Citation `json:"sources,omitempty"`           // Context blocks behind the answer; not part of the Ollama format
+}
+
+// OllamaTagsResponse lists the models available through the Ollama-compatible API
+type OllamaTagsResponse struct {
+	Models []OllamaModel `json:"models"`
+}
+
+// OllamaModel describes one model in the Ollama format
+type OllamaModel struct {
+	Name       string    `json:"name"`
+	Model      string    `json:"model"`
+	ModifiedAt time.Time `json:"modified_at"`
+	Size       int64     `json:"size"`
+	Digest     string    `json:"digest"`
+	Details    struct{}  `json:"details"`
+}
+
+// OllamaErrorResponse is an error in the Ollama format
+type OllamaErrorResponse struct {
+	Error string `json:"error"`
+}
@@ -0,0 +1,144 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// OpenAIChatRequest is a request to the OpenAI-compatible chat completions endpoint
+type OpenAIChatRequest struct {
+	Model          string                `json:"model"`
+	Messages       []OpenAIMessage       `json:"messages"`
+	Stream         bool                  `json:"stream,omitempty"`
+	StreamOptions  *OpenAIStreamOptions  `json:"stream_options,omitempty"`
+	Temperature    *float64              `json:"temperature,omitempty"`
+	TopP           *float64              `json:"top_p,omitempty"`
+	MaxTokens      *int                  `json:"max_tokens,omitempty"`
+	Seed           *int                  `json:"seed,omitempty"`
+	Stop           OpenAIStop            `json:"stop,omitempty"`
+	User           string                `json:"user,omitempty"`
+	ResponseFormat *OpenAIResponseFormat `json:"response_format,omitempty"`
+}
+
+// OpenAIResponseFormat asks for a structured reply; only "text" and "json_object" are supported
+type OpenAIResponseFormat struct {
+	Type string `json:"type"`
+}
+
+// OpenAIStreamOptions controls extra chunks in a streamed completion
+type OpenAIStreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+// OpenAIMessage is one message of an OpenAI conversation
+type OpenAIMessage struct {
+	Role    string        `json:"role"` // "system", "developer", "user" or "assistant"
+	Content OpenAIContent `json:"content"`
+}
+
+// OpenAIContent is message text, sent either as a string or as a list of content parts.
+// Only text parts are kept.
+type OpenAIContent string
+
+// UnmarshalJSON accepts both content forms
+func (c *OpenAIContent) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		*c = OpenAIContent(text)
+		return nil
+	}
+
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(data, &parts); err != nil {
+		return fmt.Errorf("content must be a string or a list of content parts")
+	}
+	var texts []string
+	for _, part := range parts {
+		if part.Type == "text" {
+			texts = append(texts, part.Text)
+		}
+	}
+	*c = OpenAIContent(strings.Join(texts, "\n"))
+	return nil
+}
+
+// OpenAIStop is a stop sequence, sent either as a string or as a list
+type OpenAIStop []string
+
+// UnmarshalJSON accepts both stop forms
+func (s *OpenAIStop) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*s = OpenAIStop{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("stop must be a string or a list of strings")
+	}
+	*s = list
+	return nil
+}
+
+// OpenAIChatResponse is a chat completion in the OpenAI format
+type OpenAIChatResponse struct {
+	ID      string         `json:"id"`
+	Object  string         `json:"object"` // "chat.completion"
+	Created int64          `json:"created"`
+	Model   string         `json:"model"`
+	Choices []OpenAIChoice `json:"choices"`
+	Usage   *OpenAIUsage   `json:"usage,omitempty"`
+	Sources []Citation     `json:"sources,omitempty"` // Context blocks behind the answer; not part of the OpenAI format
+}
+
+// OpenAIChoice is one generated reply
+type OpenAIChoice struct {
+	Index        int          `json:"index"`
+	Message      *OpenAIReply `json:"message,omitempty"`
+	Delta        *OpenAIReply `json:"delta,omitempty"`
+	FinishReason *string      `json:"finish_reason"` // "stop" or "length"; null while streaming
+}
+
+// OpenAIReply is the assistant message of a choice, or its fragment when streaming
+type OpenAIReply struct {
+	Role    string `json:"role,omitempty"`
+	Content string `json:"content,omitempty"`
+}
+
+// OpenAIUsage reports estimated token counts
+type OpenAIUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// OpenAIModelList is the response of the OpenAI-compatible models endpoint
+type OpenAIModelList struct {
+	Object string        `json:"object"` // "list"
+	Data   []OpenAIModel `json:"data"`
+}
+
+// OpenAIModel describes one model in the OpenAI format
+type OpenAIModel struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"` // "model"
+	Created int64  `json:"created"`
+	OwnedBy string `json:"owned_by"` // Provider serving the model
+}
+
+// OpenAIErrorResponse is an error in the OpenAI format
+type OpenAIErrorResponse struct {
+	Error OpenAIError `json:"error"`
+}
+
+// OpenAIError describes what went wrong
+type OpenAIError struct {
+	Message string  `json:"message"`
+	Type    string  `json:"type"`
+	Param   *string `json:"param"`
+	Code    *string `json:"code"`
+}
@@ -0,0 +1,67 @@
+package models
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestOpenAIContentUnmarshal(t *testing.T) {
+	tests := []struct {
+		name    string
+		json    string
+		want    OpenAIContent
+		wantErr bool
+	}{
+		{"string", `"Hello"`, "Hello", false},
+		{"null", `null`, "", false},
+		{"text parts", `[{"type": "text", "text": "Hello"}, {"type": "text", "text": "world"}]`, "Hello\nworld", false},
+		{"non-text parts dropped", `[{"type": "image_url", "image_url": {"url": "x"}}, {"type": "text", "text": "Describe it"}]`, "Describe it", false},
+		{"number", `42`, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var message OpenAIMessage
+			err := json.Unmarshal([]byte(`{"role": "user", "content": `+tt.json+`}`), &message)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && message.Content != tt.want {
+				t.Errorf("content = %q, want %q", message.Content, tt.want)
+			}
+		})
+	}
+}
+
+func TestOpenAIStopUnmarshal(t *testing.T) {
+	tests := []struct {
+		name    string
+		json    string
+		want    OpenAIStop
+		wantErr bool
+	}{
+		{"string", `"\n\n"`, OpenAIStop{"\n\n"}, false},
+		{"list", `["END", "STOP"]`, OpenAIStop{"END", "STOP"}, false},
+		{"missing", ``, nil, false},
+		{"object", `{"a": 1}`, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := `{"model": "m", "messages": []}`
+			if tt.json != "" {
+				body = `{"model": "m", "messages": [], "stop": ` + tt.json + `}`
+			}
+
+			var request OpenAIChatRequest
+			err := json.Unmarshal([]byte(body), &request)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(request.Stop, tt.want) {
+				t.Errorf("stop = %q, want %q", request.Stop, tt.want)
+			}
+		})
+	}
+}
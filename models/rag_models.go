@@ -1,32 +1,85 @@
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 // RAGDocument represents a document chunk stored in the vector database
 type RAGDocument struct {
-	ID       string   `json:"id"`
-	Content  string   `json:"content"`
-	Source   string   `json:"source"`
-	Metadata Metadata `json:"metadata"`
-	Score    float32  `json:"score,omitempty"` // Similarity score
+	ID       string           `json:"id"`
+	Content  string           `json:"content"`
+	Source   string           `json:"source"`
+	Metadata Metadata         `json:"metadata"`
+	Score    float32          `json:"score,omitempty"`  // Fused relevance score, 1.0 for the top result of every retriever
+	Scores   *RetrievalScores `json:"scores,omitempty"` // Component scores behind Score
+}
+
+// RetrievalScores breaks a hybrid search score down into its vector and keyword parts.
+// Ranks are 1-based and zero when the retriever didn't return the chunk.
+type RetrievalScores struct {
+	Vector      float32 `json:"vector"` // Cosine similarity
+	VectorRank  int     `json:"vector_rank,omitempty"`
+	Keyword     float64 `json:"keyword"` // BM25 score
+	KeywordRank int     `json:"keyword_rank,omitempty"`
+	Fused       float64 `json:"fused"`            // Weighted reciprocal-rank fusion score
+	Rerank      float64 `json:"rerank,omitempty"` // Score from the re-ranking stage
 }
 
 // RAGQuery represents a query to the RAG system
 type RAGQuery struct {
-	Query     string   `json:"query"`
-	Context   []string `json:"context,omitempty"`
-	ChannelID string   `json:"channel_id,omitempty"`
-	Limit     int      `json:"limit,omitempty"`
-	Threshold float64  `json:"threshold,omitempty"` // Minimum similarity score
+	Query         string     `json:"query"`
+	Context       []string   `json:"context,omitempty"`
+	ChannelID     string     `json:"channel_id,omitempty"`
+	Limit         int        `json:"limit,omitempty"`
+	Threshold     *float64   `json:"threshold,omitempty"`      // Minimum similarity score, nil for the default; 0 keeps every chunk
+	VectorWeight  *float64   `json:"vector_weight,omitempty"`  // Weight of vector results in fusion, nil for the default
+	KeywordWeight *float64   `json:"keyword_weight,omitempty"` // Weight of keyword results in fusion, nil for the default
+	Filter        *RAGFilter `json:"filter,omitempty"`
+	Rerank        *bool      `json:"rerank,omitempty"` // Set to false to skip the configured reranker
+}
+
+// RAGFilter restricts a search to chunks whose source and content match every set field
+type RAGFilter struct {
+	FileType      StringList        `json:"file_type,omitempty"`      // Extensions such as "pdf" or ".md"
+	FileName      string            `json:"file_name,omitempty"`      // Glob on the file name, or on the relative path if it contains "/"
+	IndexedAfter  *time.Time        `json:"indexed_after,omitempty"`  // RFC 3339
+	IndexedBefore *time.Time        `json:"indexed_before,omitempty"` // RFC 3339
+	Tags          map[string]string `json:"tags,omitempty"`           // Custom tags given when the document was indexed
+	Contains      string            `json:"contains,omitempty"`       // Text the chunk must contain
+	NotContains   string            `json:"not_contains,omitempty"`   // Text the chunk must not contain
+}
+
+// StringList accepts either a single JSON string or an array of strings
+type StringList []string
+
+// UnmarshalJSON decodes a string or an array of strings
+func (l *StringList) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*l = StringList{single}
+		return nil
+	}
+
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*l = list
+	return nil
 }
 
 // RAGRequest represents a request to the RAG system
 type RAGRequest struct {
 	BaseRequest
-	Query     string  `json:"query"`
-	ChannelID string  `json:"channel_id,omitempty"`
-	Limit     int     `json:"limit,omitempty"`
-	Threshold float64 `json:"threshold,omitempty"`
+	Query         string     `json:"query"`
+	ChannelID     string     `json:"channel_id,omitempty"`
+	Limit         int        `json:"limit,omitempty"`
+	Threshold     *float64   `json:"threshold,omitempty"`      // 0 disables the default threshold
+	VectorWeight  *float64   `json:"vector_weight,omitempty"`  // 0 disables vector search
+	KeywordWeight *float64   `json:"keyword_weight,omitempty"` // 0 disables keyword search
+	Filter        *RAGFilter `json:"filter,omitempty"`
+	Rerank        *bool      `json:"rerank,omitempty"`
 }
 
 // RAGResponse represents the response from RAG system
@@ -41,12 +94,18 @@ type RAGResponse struct {
 
 // RAGConfig represents RAG service configuration
 type RAGConfig struct {
-	Enabled          bool   `json:"enabled"`
-	DataPath         string `json:"data_path"`
-	CollectionName   string `json:"collection_name"`
-	EmbeddingEnabled bool   `json:"embedding_enabled"`
-	ChunkSize        int    `json:"chunk_size"`
-	ChunkOverlap     int    `json:"chunk_overlap"`
+	Enabled             bool   `json:"enabled"`
+	DataPath            string `json:"data_path"`
+	CollectionName      string `json:"collection_name"`
+	EmbeddingEnabled    bool   `json:"embedding_enabled"`
+	EmbeddingProvider   string `json:"embedding_provider"` // auto, openai, ollama, openai-compat or hash
+	EmbeddingModel      string `json:"embedding_model,omitempty"`
+	EmbeddingURL        string `json:"embedding_url,omitempty"`
+	EmbeddingDimensions int    `json:"embedding_dimensions,omitempty"` // Vector size of the hash embedder
+	Chunker             string `json:"chunker"`                        // auto, recursive, markdown or code
+	ChunkSize           int    `json:"chunk_size"`                     // In estimated tokens
+	ChunkOverlap        int    `json:"chunk_overlap"`                  // In estimated tokens
+	PersistPath         string `json:"persist_path,omitempty"`         // Empty keeps the index in memory only
 }
 
 // RAGStatus represents RAG service status
@@ -70,10 +129,11 @@ type DiscordRAGStatus struct {
 // DocumentIndexRequest represents a request to index documents
 type DocumentIndexRequest struct {
 	BaseRequest
-	Path      string   `json:"path,omitempty"`
-	Files     []string `json:"files,omitempty"`
-	Recursive bool     `json:"recursive"`
-	Force     bool     `json:"force"` // Force reindexing
+	Path      string            `json:"path,omitempty"`
+	Files     []string          `json:"files,omitempty"`
+	Recursive bool              `json:"recursive"`
+	Force     bool              `json:"force"`          // Force reindexing
+	Tags      map[string]string `json:"tags,omitempty"` // Custom tags stored on every chunk, usable in search filters
 }
 
 // DocumentIndexResponse represents the response from document indexing
@@ -82,6 +142,23 @@ type DocumentIndexResponse struct {
 	IndexedCount int      `json:"indexed_count"`
 	SkippedCount int      `json:"skipped_count"`
 	ErrorCount   int      `json:"error_count"`
+	DeletedCount int      `json:"deleted_count"`
 	Files        []string `json:"files,omitempty"`
 	Duration     string   `json:"duration"`
 }
+
+// DocumentInfo describes an indexed source document
+type DocumentInfo struct {
+	Source     string            `json:"source"` // Path relative to the data folder
+	ChunkCount int               `json:"chunk_count"`
+	Hash       string            `json:"hash,omitempty"`
+	IndexedAt  time.Time         `json:"indexed_at"`
+	Tags       map[string]string `json:"tags,omitempty"`
+}
+
+// DocumentListResponse represents the list of indexed documents
+type DocumentListResponse struct {
+	BaseResponse
+	Documents []DocumentInfo `json:"documents"`
+	Total     int            `json:"total"`
+}
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// Session represents a server-side conversation and its message history
+type Session struct {
+	ID        string        `json:"id"`
+	Messages  []ChatMessage `json:"messages"`
+	CreatedAt time.Time     `json:"created_at"`
+	UpdatedAt time.Time     `json:"updated_at"`
+}
+
+// SessionResponse represents the response from the session endpoints
+type SessionResponse struct {
+	BaseResponse
+	Session *Session `json:"session,omitempty"`
+}
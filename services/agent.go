@@ -0,0 +1,123 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"chatbot/models"
+)
+
+// errNoToolBackend is returned when no provider in the fallback chain can call tools
+var errNoToolBackend = errors.New("no provider with tool calling available")
+
+// generateWithTools answers the turn with the agent loop when tools are configured,
+// falling back to a plain reply if no provider can call tools or the loop fails
+func (c *Chatbot) generateWithTools(ctx context.Context, turn *chatTurn) (string, LLMProvider, *BuiltPrompt, []models.ToolInvocation) {
+	if c.tools != nil {
+		response, name, prompt, invocations, err := c.runAgent(ctx, turn)
+		if err == nil {
+			return response, name, prompt, invocations
+		}
+		log.Printf("Answering without tools: %v", err)
+	}
+
+	response, name, prompt := c.generateResponse(ctx, turn)
+	return response, name, prompt, nil
+}
+
+// runAgent walks the fallback chain like generateResponse, using the first provider that
+// can call tools. The model calls tools for up to maxToolRounds rounds, after which it is
+// asked to answer with what it has.
+func (c *Chatbot) runAgent(ctx context.Context, turn *chatTurn) (string, LLMProvider, *BuiltPrompt, []models.ToolInvocation, error) {
+	c.scheduleProviderRefresh()
+
+	for _, name := range c.fallbackChain {
+		if name == ProviderDummy {
+			break
+		}
+
+		caller, ok := c.backends[name].(ToolCallingBackend)
+		if !ok {
+			continue
+		}
+		if err := validateOptions(c.backends[name], turn.options); err != nil {
+			log.Printf("Skipping %v", err)
+			continue
+		}
+		breaker := c.breakers[name]
+		if !breaker.Allow() {
+			continue
+		}
+
+		prompt, request := c.fitPrompt(name, turn)
+		request.Tools = c.tools.Specs()
+
+		response, invocations, err := c.agentLoop(ctx, caller, request)
+		if errors.Is(err, ErrToolsUnsupported) {
+			// The provider works, its model just can't call tools
+			breaker.Release()
+			log.Printf("Skipping %s for tools: %v", name, err)
+			continue
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				breaker.Release()
+			} else {
+				breaker.RecordFailure(err)
+				log.Printf("%s failed (circuit %s): %v", name, breaker.State(), err)
+			}
+			return "", name, prompt, invocations, err
+		}
+
+		breaker.RecordSuccess()
+		c.setCurrentProvider(name)
+		return response, name, prompt, invocations, nil
+	}
+
+	return "", ProviderDummy, unfittedPrompt(turn), nil, errNoToolBackend
+}
+
+// agentLoop sends the request until the model answers without calling tools, running the
+// calls of each round and adding them with their results to the next request
+func (c *Chatbot) agentLoop(ctx context.Context, caller ToolCallingBackend, request GenerateRequest) (string, []models.ToolInvocation, error) {
+	var invocations []models.ToolInvocation
+
+	for round := 1; ; round++ {
+		// The last round offers no tools, so the model has to answer
+		if round > c.maxToolRounds {
+			request.Tools = nil
+		}
+
+		content, calls, err := caller.GenerateToolTurn(ctx, request)
+		if err != nil {
+			return "", invocations, err
+		}
+		if len(calls) == 0 {
+			return content, invocations, nil
+		}
+		if request.Tools == nil {
+			return "", invocations, fmt.Errorf("model kept calling tools after %d rounds", c.maxToolRounds)
+		}
+
+		step := ToolStep{Content: content, Calls: calls}
+		for _, call := range calls {
+			result, invocation := c.tools.Invoke(ctx, call)
+			invocation.Round = round
+			step.Results = append(step.Results, result)
+			invocations = append(invocations, invocation)
+		}
+		request.Steps = append(request.Steps, step)
+		log.Printf("Tool round %d: ran %d tool calls", round, len(calls))
+	}
+}
+
+// RegisterTool makes a tool available to the model, enabling the agent loop if no tools were
+// configured. Tools should be registered before the chatbot serves requests.
+func (c *Chatbot) RegisterTool(tool Tool) {
+	if c.tools == nil {
+		c.tools = NewToolSet(defaultToolTimeout, defaultToolResultChars)
+	}
+	c.tools.Register(tool)
+}
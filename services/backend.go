@@ -0,0 +1,246 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+
+	"chatbot/models"
+	"chatbot/utils"
+)
+
+// LLMBackend is implemented by every language model provider the chatbot can use
+type LLMBackend interface {
+	// Name returns the provider name the backend is registered under
+	Name() LLMProvider
+	// GenerateResponse generates a reply for the message using context and history
+	GenerateResponse(ctx context.Context, request GenerateRequest) (string, error)
+	// IsAvailable checks whether the backend can currently serve requests
+	IsAvailable() bool
+	// GetModel returns the model the backend is configured to use
+	GetModel() string
+	// GetStatus returns backend details for the health endpoint
+	GetStatus() map[string]interface{}
+}
+
+// StreamingBackend is implemented by backends that can stream tokens as they are generated.
+// onToken is called for every fragment; returning an error from it aborts the stream.
+// The returned string is the full response; the chatbot applies the response policy to it.
+type StreamingBackend interface {
+	LLMBackend
+	StreamResponse(ctx context.Context, request GenerateRequest, onToken func(token string) error) (string, error)
+}
+
+// GenerateRequest is everything a backend needs to produce a reply
+type GenerateRequest struct {
+	SystemPrompt string   // Instructions for the model; empty uses the built-in default
+	Message      string   // The user's message
+	Context      []string // Context blocks to list after the system prompt
+	History      []models.ChatMessage
+	MaxTokens    int      // Reply length to request; 0 uses the backend's default policy
+	Stop         []string // Stop sequences for the model; nil uses the backend's default policy
+	Model        string   // Model to use; empty uses the backend's configured model
+	Temperature  *float64 // Sampling settings; nil uses the backend's defaults
+	TopP         *float64
+	Seed         *int
+	Format       string     // Output format; "json" asks for a JSON reply
+	Tools        []ToolSpec // Tools the model may call; only used by GenerateToolTurn
+	Steps        []ToolStep // Tool calls made so far in this turn, with their results
+}
+
+// systemPrompt returns the request's instructions, or the built-in default
+func (r GenerateRequest) systemPrompt() string {
+	if r.SystemPrompt == "" {
+		return assistantInstructions
+	}
+	return r.SystemPrompt
+}
+
+// limits returns the reply length and stop sequences for the request, falling back to policy
+func (r GenerateRequest) limits(policy ResponsePolicy) (int, []string) {
+	maxTokens, stop := r.MaxTokens, r.Stop
+	if maxTokens <= 0 {
+		maxTokens = policy.MaxTokens
+	}
+	if stop == nil {
+		stop = policy.StopPatterns
+	}
+	return maxTokens, stop
+}
+
+// PromptBudgetBackend is implemented by backends that know their prompt limits, so that
+// prompts can be fitted to them. Other backends are sized by their model name and counted
+// with EstimateTokens.
+type PromptBudgetBackend interface {
+	LLMBackend
+	// ContextWindow returns the number of tokens the model accepts, prompt and reply together
+	ContextWindow() int
+	// EstimateTokens counts the tokens a text uses with the model's tokenizer
+	EstimateTokens(text string) int
+}
+
+// PolicyBackend is implemented by backends with their own response policy.
+// Other backends use DefaultResponsePolicy.
+type PolicyBackend interface {
+	LLMBackend
+	ResponsePolicy() ResponsePolicy
+}
+
+// OptionsBackend is implemented by backends that accept per-request generation options.
+// Options for other backends are rejected.
+type OptionsBackend interface {
+	LLMBackend
+	// ValidateOptions checks options against the provider's limits
+	ValidateOptions(options models.GenerationOptions) error
+}
+
+// ModelBackend is implemented by backends that can list their models and switch between them
+type ModelBackend interface {
+	LLMBackend
+	// GetAvailableModels returns the models the provider can serve
+	GetAvailableModels() ([]string, error)
+	// SetModel changes the model used by requests that don't name one; safe while requests are in flight
+	SetModel(model string)
+}
+
+// ToolCallingBackend is implemented by backends whose models can call tools. The chatbot
+// runs the agent loop; the backend only sends one turn of it.
+type ToolCallingBackend interface {
+	LLMBackend
+	// GenerateToolTurn sends the request with its tools and earlier steps, returning either
+	// tool calls to run or, when there are none, the final reply. Models that can't call
+	// tools return ErrToolsUnsupported.
+	GenerateToolTurn(ctx context.Context, request GenerateRequest) (string, []ToolCall, error)
+}
+
+// findModel returns the listed name matching model, accepting Ollama's implicit ":latest" tag,
+// or "" if the model isn't listed
+func findModel(available []string, model string) string {
+	for _, name := range available {
+		if name == model || name == model+":latest" {
+			return name
+		}
+	}
+	return ""
+}
+
+// BackendConfig carries the settings passed to backend factories. Backends currently read
+// their own settings from the environment, so it has no fields yet.
+type BackendConfig struct{}
+
+// BackendFactory creates a backend from the given configuration
+type BackendFactory func(config BackendConfig) (LLMBackend, error)
+
+// backendRegistry holds the known backend factories in registration order
+type backendRegistry struct {
+	mu        sync.RWMutex
+	factories map[LLMProvider]BackendFactory
+	order     []LLMProvider
+}
+
+// Ensure the built-in services satisfy the backend interfaces
+var (
+	_ StreamingBackend = (*LLMService)(nil)
+	_ StreamingBackend = (*ChatGPTService)(nil)
+
+	_ PromptBudgetBackend = (*LLMService)(nil)
+	_ PromptBudgetBackend = (*ChatGPTService)(nil)
+
+	_ PolicyBackend = (*LLMService)(nil)
+	_ PolicyBackend = (*ChatGPTService)(nil)
+
+	_ OptionsBackend = (*LLMService)(nil)
+	_ OptionsBackend = (*ChatGPTService)(nil)
+
+	_ ModelBackend = (*LLMService)(nil)
+	_ ModelBackend = (*ChatGPTService)(nil)
+
+	_ ToolCallingBackend = (*LLMService)(nil)
+	_ ToolCallingBackend = (*ChatGPTService)(nil)
+)
+
+var registry = &backendRegistry{
+	factories: make(map[LLMProvider]BackendFactory),
+}
+
+func init() {
+	RegisterBackend(ProviderLocal, func(config BackendConfig) (LLMBackend, error) {
+		return NewLLMService("", ""), nil
+	})
+	RegisterBackend(ProviderChatGPT, func(config BackendConfig) (LLMBackend, error) {
+		return NewChatGPTService(), nil
+	})
+}
+
+// RegisterBackend makes a backend factory available under the given provider name.
+// Registering the same name twice replaces the earlier factory.
+func RegisterBackend(name LLMProvider, factory BackendFactory) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+
+	if _, exists := registry.factories[name]; !exists {
+		registry.order = append(registry.order, name)
+	}
+	registry.factories[name] = factory
+}
+
+// RegisteredBackends returns the registered provider names in registration order
+func RegisteredBackends() []LLMProvider {
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+
+	names := make([]LLMProvider, len(registry.order))
+	copy(names, registry.order)
+	return names
+}
+
+// NewBackend creates a backend using the factory registered under name
+func NewBackend(name LLMProvider, config BackendConfig) (LLMBackend, error) {
+	registry.mu.RLock()
+	factory, exists := registry.factories[name]
+	registry.mu.RUnlock()
+
+	if !exists {
+		return nil, fmt.Errorf("unknown LLM backend: %s", name)
+	}
+	return factory(config)
+}
+
+// configuredBackends returns the provider names to initialize for the preferred provider.
+// Forced modes only use their own backend; auto-detect uses LLM_BACKENDS if set,
+// otherwise every registered backend.
+func configuredBackends(preferredProvider LLMProvider) []LLMProvider {
+	if preferredProvider != "" {
+		return []LLMProvider{preferredProvider}
+	}
+
+	envBackends := utils.GetEnvList("LLM_BACKENDS")
+	if len(envBackends) == 0 {
+		return RegisteredBackends()
+	}
+
+	names := make([]LLMProvider, 0, len(envBackends))
+	for _, name := range envBackends {
+		names = append(names, LLMProvider(name))
+	}
+	return names
+}
+
+// buildBackends initializes the configured backends, skipping any that fail to build
+func buildBackends(names []LLMProvider, config BackendConfig) (map[LLMProvider]LLMBackend, []LLMProvider) {
+	backends := make(map[LLMProvider]LLMBackend)
+	var order []LLMProvider
+
+	for _, name := range names {
+		backend, err := NewBackend(name, config)
+		if err != nil {
+			log.Printf("Failed to initialize LLM backend %s: %v", name, err)
+			continue
+		}
+		backends[name] = backend
+		order = append(order, name)
+	}
+
+	return backends, order
+}
@@ -0,0 +1,201 @@
+package services
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// BM25 parameters; these are the usual defaults
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// KeywordHit is a chunk matched by the keyword index
+type KeywordHit struct {
+	ID       string
+	Content  string
+	Metadata map[string]string
+	Score    float64
+}
+
+// bm25Document is a chunk in the keyword index
+type bm25Document struct {
+	content  string
+	metadata map[string]string
+	terms    map[string]int
+	length   int
+}
+
+// BM25Index is an in-memory inverted index that ranks chunks with Okapi BM25. It finds
+// exact identifiers, error codes and product names that embeddings tend to blur.
+type BM25Index struct {
+	mu          sync.RWMutex
+	documents   map[string]*bm25Document
+	postings    map[string]map[string]int // term -> chunk ID -> term frequency
+	totalLength int
+}
+
+// NewBM25Index creates an empty keyword index
+func NewBM25Index() *BM25Index {
+	return &BM25Index{
+		documents: make(map[string]*bm25Document),
+		postings:  make(map[string]map[string]int),
+	}
+}
+
+// Add indexes a chunk, replacing any chunk with the same ID
+func (idx *BM25Index) Add(id string, content string, metadata map[string]string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.remove(id)
+
+	terms := make(map[string]int)
+	tokens := keywordTokenize(content)
+	for _, token := range tokens {
+		terms[token]++
+	}
+
+	idx.documents[id] = &bm25Document{
+		content:  content,
+		metadata: metadata,
+		terms:    terms,
+		length:   len(tokens),
+	}
+	idx.totalLength += len(tokens)
+
+	for term, count := range terms {
+		if idx.postings[term] == nil {
+			idx.postings[term] = make(map[string]int)
+		}
+		idx.postings[term][id] = count
+	}
+}
+
+// Remove drops chunks from the index
+func (idx *BM25Index) Remove(ids ...string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	for _, id := range ids {
+		idx.remove(id)
+	}
+}
+
+// remove drops a chunk; the caller must hold the lock
+func (idx *BM25Index) remove(id string) {
+	doc, exists := idx.documents[id]
+	if !exists {
+		return
+	}
+
+	for term := range doc.terms {
+		delete(idx.postings[term], id)
+		if len(idx.postings[term]) == 0 {
+			delete(idx.postings, term)
+		}
+	}
+	idx.totalLength -= doc.length
+	delete(idx.documents, id)
+}
+
+// Len returns the number of indexed chunks
+func (idx *BM25Index) Len() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return len(idx.documents)
+}
+
+// Search returns up to limit chunks ranked by BM25 score. Chunks for which accept
+// returns false are skipped; a nil accept keeps everything.
+func (idx *BM25Index) Search(query string, limit int, accept func(content string, metadata map[string]string) bool) []KeywordHit {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	if len(idx.documents) == 0 || limit <= 0 {
+		return nil
+	}
+
+	docCount := float64(len(idx.documents))
+	avgLength := float64(idx.totalLength) / docCount
+	scores := make(map[string]float64)
+
+	seen := make(map[string]bool)
+	for _, term := range keywordTokenize(query) {
+		if seen[term] {
+			continue
+		}
+		seen[term] = true
+
+		postings := idx.postings[term]
+		if len(postings) == 0 {
+			continue
+		}
+
+		// Lucene's IDF, which stays positive for terms found in most chunks
+		df := float64(len(postings))
+		idf := math.Log(1 + (docCount-df+0.5)/(df+0.5))
+
+		for id, tf := range postings {
+			doc := idx.documents[id]
+			freq := float64(tf)
+			norm := freq + bm25K1*(1-bm25B+bm25B*float64(doc.length)/avgLength)
+			scores[id] += idf * freq * (bm25K1 + 1) / norm
+		}
+	}
+
+	hits := make([]KeywordHit, 0, len(scores))
+	for id, score := range scores {
+		doc := idx.documents[id]
+		if accept != nil && !accept(doc.content, doc.metadata) {
+			continue
+		}
+		hits = append(hits, KeywordHit{
+			ID:       id,
+			Content:  doc.content,
+			Metadata: doc.metadata,
+			Score:    score,
+		})
+	}
+
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].ID < hits[j].ID
+	})
+
+	if len(hits) > limit {
+		hits = hits[:limit]
+	}
+	return hits
+}
+
+// keywordTokenize lowercases text and splits it into terms. Identifiers such as
+// "ERR_CONN-42" or "v1.2.3" are kept whole and also indexed by their parts.
+func keywordTokenize(text string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' && r != '-' && r != '.'
+	})
+
+	var tokens []string
+	for _, field := range fields {
+		field = strings.Trim(field, "_-.")
+		if field == "" {
+			continue
+		}
+		tokens = append(tokens, field)
+
+		parts := strings.FieldsFunc(field, func(r rune) bool {
+			return r == '_' || r == '-' || r == '.'
+		})
+		if len(parts) > 1 {
+			tokens = append(tokens, parts...)
+		}
+	}
+	return tokens
+}
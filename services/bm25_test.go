@@ -0,0 +1,67 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestKeywordTokenizeKeepsIdentifiers(t *testing.T) {
+	got := keywordTokenize("Error ERR_CONN-42 in v1.2.3.")
+	want := []string{"error", "err_conn-42", "err", "conn", "42", "in", "v1.2.3", "v1", "2", "3"}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("keywordTokenize = %q, want %q", got, want)
+	}
+}
+
+func TestBM25IndexRanksRareTermsHigher(t *testing.T) {
+	idx := NewBM25Index()
+	idx.Add("a", "the server failed with ERR_CONN-42 on startup", nil)
+	idx.Add("b", "the server started and the server is healthy", nil)
+	idx.Add("c", "the client retried the request", nil)
+
+	hits := idx.Search("server ERR_CONN-42", 10, nil)
+	if len(hits) != 2 {
+		t.Fatalf("got %d hits, want 2", len(hits))
+	}
+	if hits[0].ID != "a" {
+		t.Errorf("the chunk with the error code should rank first, got %s", hits[0].ID)
+	}
+	if hits[0].Score <= hits[1].Score {
+		t.Errorf("scores should be descending: %f, %f", hits[0].Score, hits[1].Score)
+	}
+}
+
+func TestBM25IndexReplaceAndRemove(t *testing.T) {
+	idx := NewBM25Index()
+	idx.Add("a", "alpha beta", nil)
+	idx.Add("a", "gamma delta", nil)
+
+	if idx.Len() != 1 {
+		t.Fatalf("Len = %d, want 1", idx.Len())
+	}
+	if hits := idx.Search("alpha", 10, nil); len(hits) != 0 {
+		t.Errorf("replaced content should not match, got %v", hits)
+	}
+
+	idx.Remove("a", "missing")
+	if idx.Len() != 0 || idx.totalLength != 0 || len(idx.postings) != 0 {
+		t.Errorf("index should be empty after removal: %d documents, %d postings", idx.Len(), len(idx.postings))
+	}
+}
+
+func TestBM25IndexSearchFilterAndLimit(t *testing.T) {
+	idx := NewBM25Index()
+	idx.Add("a", "install guide", map[string]string{"file_type": ".md"})
+	idx.Add("b", "install notes", map[string]string{"file_type": ".txt"})
+	idx.Add("c", "install faq", map[string]string{"file_type": ".md"})
+
+	accept := func(_ string, metadata map[string]string) bool {
+		return metadata["file_type"] == ".md"
+	}
+	hits := idx.Search("install", 1, accept)
+
+	if len(hits) != 1 || hits[0].Metadata["file_type"] != ".md" {
+		t.Errorf("expected one markdown hit, got %v", hits)
+	}
+}
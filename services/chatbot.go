@@ -1,14 +1,19 @@
 package services
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"math/rand"
-	"path/filepath"
+	"os"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"chatbot/models"
+	"chatbot/utils"
 )
 
 // LLMProvider represents the type of LLM provider
@@ -20,317 +25,782 @@ const (
 	ProviderDummy   LLMProvider = "dummy"
 )
 
+var (
+	// ErrUnknownProvider is returned for providers that aren't configured or can't do what was asked
+	ErrUnknownProvider = errors.New("unknown provider")
+	// ErrUnknownModel is returned for models a provider doesn't list
+	ErrUnknownModel = errors.New("unknown model")
+)
+
 // Chatbot handles chat processing and response generation
 type Chatbot struct {
 	initialized        bool
 	startTime          time.Time
-	llmService         *LLMService
-	chatgptService     *ChatGPTService
+	backends           map[LLMProvider]LLMBackend
+	backendOrder       []LLMProvider
 	currentProvider    LLMProvider
 	preferredProvider  LLMProvider
 	lastProviderCheck  time.Time
 	providerCheckCache map[LLMProvider]bool
+	fallbackChain      []LLMProvider
+	breakers           map[LLMProvider]*CircuitBreaker
+	checkInterval      time.Duration
+	refreshing         atomic.Bool
+	mu                 sync.RWMutex
 	ragService         *RAGService
 	enableRAG          bool
+	sessions           SessionStore
+	stopJanitor        chan struct{}
+	watcher            *DocumentWatcher
+	search             *SearchService
+	searchDecider      SearchDecider
+	personas           *PersonaStore
+	tools              *ToolSet // Tools for the agent loop; nil answers without tools
+	maxToolRounds      int
+}
+
+// ChatParams carries per-request settings for a chat message
+type ChatParams struct {
+	Persona string // Persona name; empty selects the default persona
+	User    string // Name of the person asking, for persona templates
+	Channel string // Channel the message came from, for persona templates
+	Options *models.GenerationOptions
+	Search  SearchMode // When to search the web; empty lets the search decider choose
+	// Instructions from the client, added after the persona's system prompt
+	Instructions string
+}
+
+// chatTurn is a message prepared for generation
+type chatTurn struct {
+	sections PromptSections
+	persona  *Persona
+	data     PromptData
+	options  *models.GenerationOptions
+	// instructions are added after the rendered persona prompt
+	instructions string
+}
+
+// systemPrompt adds the client's instructions to a rendered persona prompt
+func (t *chatTurn) systemPrompt(rendered string) string {
+	if t.instructions == "" {
+		return rendered
+	}
+	return rendered + "\n\n" + t.instructions
 }
 
 // NewChatbot creates a new chatbot instance with specified provider preference
 func NewChatbot(preferredProvider LLMProvider, enableSearch bool, enableRAG bool) *Chatbot {
-	var llmService *LLMService
-	var chatgptService *ChatGPTService
-	var currentProvider LLMProvider
+	// Only initialize backends we might actually use
+	backends, backendOrder := buildBackends(configuredBackends(preferredProvider), BackendConfig{})
 
-	// Initialize provider cache
+	// Initialize provider cache and pick the first available backend (registration order prefers local)
 	providerCache := make(map[LLMProvider]bool)
+	currentProvider := ProviderDummy
 
-	// Only initialize services we might actually use
-	switch preferredProvider {
-	case ProviderChatGPT:
-		// ChatGPT-only mode: Skip Ollama entirely
-		chatgptService = NewChatGPTService(enableSearch)
-
-		if chatgptService.IsAvailable() {
-			currentProvider = ProviderChatGPT
-			providerCache[ProviderChatGPT] = true
-			providerCache[ProviderLocal] = false
-			searchStatus := "disabled"
-			if enableSearch && chatgptService.searchService != nil && chatgptService.searchService.IsEnabled() {
-				searchStatus = "enabled"
-			}
-			log.Printf("ChatGPT-only mode: Using model %s, search %s", chatgptService.GetModel(), searchStatus)
-		} else {
-			currentProvider = ProviderDummy
-			providerCache[ProviderChatGPT] = false
-			providerCache[ProviderLocal] = false
-			log.Printf("ChatGPT not available (missing OPENAI_API_KEY), using dummy responses")
-			log.Printf("No fallback to local LLM in ChatGPT-only mode")
-		}
+	for _, name := range backendOrder {
+		available := backends[name].IsAvailable()
+		providerCache[name] = available
 
-	case ProviderLocal:
-		// Local-only mode: Skip ChatGPT entirely
-		llmService = NewLLMService("", "")
-
-		if llmService.IsAvailable() {
-			currentProvider = ProviderLocal
-			providerCache[ProviderLocal] = true
-			providerCache[ProviderChatGPT] = false
-			log.Printf("Local LLM-only mode: Using model %s", llmService.GetModel())
-			if enableSearch {
-				log.Printf("Note: Search not available in Local LLM-only mode")
-			}
-		} else {
-			currentProvider = ProviderDummy
-			providerCache[ProviderLocal] = false
-			providerCache[ProviderChatGPT] = false
-			log.Printf("Local LLM not available, using dummy responses")
-			log.Printf("No fallback to ChatGPT in Local LLM-only mode")
+		if available && currentProvider == ProviderDummy {
+			currentProvider = name
 		}
+	}
 
-	default:
-		// Auto-detect: Initialize both services
-		llmService = NewLLMService("", "")
-		chatgptService = NewChatGPTService(enableSearch)
-
-		localAvailable := llmService.IsAvailable()
-		chatgptAvailable := chatgptService.IsAvailable()
-
-		providerCache[ProviderLocal] = localAvailable
-		providerCache[ProviderChatGPT] = chatgptAvailable
-
-		// Prefer local for speed in auto-detect mode
-		if localAvailable {
-			currentProvider = ProviderLocal
-			log.Printf("Auto-detected local LLM: %s", llmService.GetModel())
-		} else if chatgptAvailable {
-			currentProvider = ProviderChatGPT
-			searchStatus := "disabled"
-			if enableSearch && chatgptService.searchService != nil && chatgptService.searchService.IsEnabled() {
-				searchStatus = "enabled"
-			}
-			log.Printf("Auto-detected ChatGPT: %s, search %s", chatgptService.GetModel(), searchStatus)
+	if currentProvider != ProviderDummy {
+		model := backends[currentProvider].GetModel()
+		if preferredProvider != "" {
+			log.Printf("%s-only mode: Using model %s, search enabled: %v", currentProvider, model, enableSearch)
 		} else {
-			currentProvider = ProviderDummy
-			log.Printf("No LLM services available, using dummy responses")
+			log.Printf("Auto-detected %s: %s, search enabled: %v", currentProvider, model, enableSearch)
 		}
+	} else if preferredProvider != "" {
+		log.Printf("%s not available, using dummy responses", preferredProvider)
+		log.Printf("No fallback to other providers in %s-only mode", preferredProvider)
+	} else {
+		log.Printf("No LLM services available, using dummy responses")
 	}
 
 	var ragService *RAGService
 	if enableRAG {
-		ragService = NewRAGService("./data", "chatbot_knowledge", true)
+		ragService = NewRAGService(NewRAGConfigFromEnv())
 		if err := ragService.Initialize(); err != nil {
 			log.Printf("Failed to initialize RAG service: %v", err)
 			ragService = nil
 			enableRAG = false
 		} else {
-			// Index documents on startup
+			// Sync the index on startup; unchanged files in a persisted index are skipped
 			if err := ragService.IndexDocuments(); err != nil {
 				log.Printf("Failed to index documents: %v", err)
 			}
 		}
 	}
 
-	log.Printf("Chatbot initialized: provider=%s, preferred=%s", currentProvider, preferredProvider)
+	// Optionally keep the index in sync with the data folder while running
+	var watcher *DocumentWatcher
+	if ragService != nil && strings.EqualFold(os.Getenv("RAG_WATCH"), "true") {
+		watcher = NewDocumentWatcher(ragService,
+			strings.ToLower(os.Getenv("RAG_WATCH_MODE")),
+			utils.GetEnvDuration("RAG_WATCH_DEBOUNCE", defaultWatchDebounce),
+			utils.GetEnvDuration("RAG_WATCH_POLL_INTERVAL", defaultWatchPollInterval))
+		if err := watcher.Start(); err != nil {
+			log.Printf("Failed to start document watcher: %v", err)
+			watcher = nil
+		}
+	}
+
+	// Web search results are added to the context for every backend so they can be cited
+	var search *SearchService
+	if enableSearch {
+		search = NewSearchService()
+	}
+
+	// Every backend gets its own circuit breaker
+	failureThreshold := utils.GetEnvInt("CIRCUIT_BREAKER_THRESHOLD", 3)
+	cooldown := utils.GetEnvDuration("CIRCUIT_BREAKER_COOLDOWN", 30*time.Second)
+	breakers := make(map[LLMProvider]*CircuitBreaker)
+	for _, name := range backendOrder {
+		breakers[name] = NewCircuitBreaker(failureThreshold, cooldown)
+	}
+
+	fallbackChain := buildFallbackChain(backends, backendOrder)
 
-	return &Chatbot{
+	sessions, err := NewSessionStoreFromEnv()
+	if err != nil {
+		log.Printf("Failed to initialize session store, using memory: %v", err)
+		sessions = NewMemorySessionStore(30*time.Minute, 50)
+	}
+
+	tools, err := NewToolSetFromEnv(ragService, search)
+	if err != nil {
+		log.Printf("Failed to set up tools, tool calling disabled: %v", err)
+	} else if tools != nil {
+		log.Printf("Tool calling enabled: %v", tools.Names())
+	}
+
+	log.Printf("Chatbot initialized: provider=%s, preferred=%s, backends=%v", currentProvider, preferredProvider, backendOrder)
+	log.Printf("Fallback chain: %v (circuit breaker: %d failures, %s cooldown)", fallbackChain, failureThreshold, cooldown)
+
+	chatbot := &Chatbot{
 		initialized:        true,
 		startTime:          time.Now(),
-		llmService:         llmService,
-		chatgptService:     chatgptService,
+		backends:           backends,
+		backendOrder:       backendOrder,
 		currentProvider:    currentProvider,
 		preferredProvider:  preferredProvider,
 		lastProviderCheck:  time.Now(),
 		providerCheckCache: providerCache,
+		fallbackChain:      fallbackChain,
+		breakers:           breakers,
+		checkInterval:      utils.GetEnvDuration("PROVIDER_CHECK_INTERVAL", time.Minute),
 		ragService:         ragService,
 		enableRAG:          enableRAG,
+		sessions:           sessions,
+		stopJanitor:        make(chan struct{}),
+		watcher:            watcher,
+		search:             search,
+		personas:           NewPersonaStoreFromEnv(),
+		tools:              tools,
+		maxToolRounds:      utils.GetEnvInt("AGENT_MAX_ITERATIONS", 4),
 	}
+
+	// Optionally re-rank retrieved chunks before they reach the prompt
+	if ragService != nil {
+		reranker, err := NewRerankerFromEnv(chatbot.completePrompt)
+		if err != nil {
+			log.Printf("Failed to set up reranker, re-ranking disabled: %v", err)
+		} else if reranker != nil {
+			ragService.SetReranker(reranker)
+			log.Printf("RAG re-ranking enabled: %s", reranker.Name())
+		}
+	}
+
+	// Decide which messages need web search; the llm decider asks the current model
+	if search != nil {
+		decider, err := NewSearchDeciderFromEnv(chatbot.completePrompt)
+		if err != nil {
+			log.Printf("Failed to set up search decider, using keywords: %v", err)
+			decider = NewKeywordSearchDecider()
+		}
+		chatbot.searchDecider = decider
+		log.Printf("Web search decider: %s", decider.Name())
+	}
+
+	go chatbot.runSessionJanitor(utils.GetEnvDuration("SESSION_CLEANUP_INTERVAL", defaultSessionCleanupInterval))
+
+	return chatbot
 }
 
 // ProcessMessage processes a user message and returns a response
-func (c *Chatbot) ProcessMessage(message string, sessionID string, history []models.ChatMessage) models.ChatResponse {
+func (c *Chatbot) ProcessMessage(message string, sessionID string, history []models.ChatMessage, params ChatParams) models.ChatResponse {
 	// Clean the input message
 	message = strings.TrimSpace(message)
+	history = c.resolveHistory(sessionID, history)
 
-	context := c.generateContextWithHistory(message, sessionID, history)
-
-	// Try to generate response using available providers
-	response, usedProvider := c.generateResponse(message, context, history)
+	sections, citations := c.generateContextWithHistory(context.Background(), message, sessionID, history, params.Search)
+	turn := c.prepareTurn(sections, params)
 
-	// Create response with context and sources
-	sources := c.generateDummySources()
-
-	chatResponse := models.ChatResponse{
-		Message:   response,
-		SessionID: sessionID,
-		Context:   context,
-		Sources:   sources,
-		Status:    "success",
-		Timestamp: time.Now(),
-	}
+	// Try to generate response using available providers, calling tools if configured
+	response, usedProvider, prompt, toolCalls := c.generateWithTools(context.Background(), turn)
 
 	// Log which provider was used
 	log.Printf("Response generated using provider: %s", usedProvider)
 
+	response, truncated := prompt.Policy.Apply(response)
+	c.recordExchange(sessionID, message, response)
+
+	chatResponse := c.buildChatResponse(response, truncated, sessionID, usedProvider, prompt, citations)
+	chatResponse.ToolCalls = toolCalls
 	return chatResponse
 }
 
-// generateResponse attempts to generate a response using the current provider (optimized)
-func (c *Chatbot) generateResponse(message string, context []string, history []models.ChatMessage) (string, LLMProvider) {
-	// Use current provider directly - no fallback checking to reduce latency
-	switch c.currentProvider {
-	case ProviderChatGPT:
-		if c.chatgptService == nil {
-			log.Printf("ChatGPT service not initialized")
-			return c.generateDummyResponse(message, len(history)), ProviderDummy
+// ProcessMessageStream processes a user message like ProcessMessage, passing response
+// fragments to onToken as they are generated. Providers without streaming support
+// deliver their whole response as a single fragment, as does the agent loop when tools
+// are configured. Fragments are sent as generated; the response policy only applies to
+// the returned message.
+func (c *Chatbot) ProcessMessageStream(ctx context.Context, message string, sessionID string, history []models.ChatMessage, params ChatParams, onToken func(token string) error) models.ChatResponse {
+	message = strings.TrimSpace(message)
+	history = c.resolveHistory(sessionID, history)
+
+	sections, citations := c.generateContextWithHistory(ctx, message, sessionID, history, params.Search)
+	turn := c.prepareTurn(sections, params)
+
+	var response string
+	var usedProvider LLMProvider
+	var prompt *BuiltPrompt
+	var toolCalls []models.ToolInvocation
+	var err error
+
+	// Tool calls are resolved before the answer is known, so the agent's reply is sent whole
+	if c.tools != nil {
+		response, usedProvider, prompt, toolCalls, err = c.runAgent(ctx, turn)
+		if err == nil {
+			err = onToken(response)
+		} else if ctx.Err() == nil {
+			log.Printf("Answering without tools: %v", err)
+			response, usedProvider, prompt, err = c.generateStreamingResponse(ctx, turn, onToken)
+			toolCalls = nil
 		}
+	} else {
+		response, usedProvider, prompt, err = c.generateStreamingResponse(ctx, turn, onToken)
+	}
 
-		if response, err := c.chatgptService.GenerateResponse(message, context, history); err == nil {
-			return response, ProviderChatGPT
-		} else {
-			log.Printf("ChatGPT failed: %v", err)
-			// In forced ChatGPT mode, don't try other providers
-			if c.preferredProvider == ProviderChatGPT {
-				log.Printf("ChatGPT-only mode: using dummy response (no fallback)")
-				return c.generateDummyResponse(message, len(history)), ProviderDummy
-			}
-		}
+	log.Printf("Streamed response generated using provider: %s", usedProvider)
 
-	case ProviderLocal:
-		if c.llmService == nil {
-			log.Printf("Local LLM service not initialized")
-			return c.generateDummyResponse(message, len(history)), ProviderDummy
+	response, truncated := prompt.Policy.Apply(response)
+	chatResponse := c.buildChatResponse(response, truncated, sessionID, usedProvider, prompt, citations)
+	chatResponse.ToolCalls = toolCalls
+	if err != nil {
+		chatResponse.Status = models.StatusError
+		chatResponse.Error = err.Error()
+	} else {
+		c.recordExchange(sessionID, message, response)
+	}
+
+	return chatResponse
+}
+
+// resolveHistory falls back to the stored session history when the client sends none
+func (c *Chatbot) resolveHistory(sessionID string, history []models.ChatMessage) []models.ChatMessage {
+	if len(history) > 0 || sessionID == "" {
+		return history
+	}
+
+	session, err := c.sessions.Get(sessionID)
+	if err != nil {
+		if !errors.Is(err, ErrSessionNotFound) {
+			log.Printf("Failed to load session %s: %v", sessionID, err)
 		}
+		return history
+	}
 
-		if response, err := c.llmService.GenerateResponse(message, context, history); err == nil {
-			return response, ProviderLocal
-		} else {
-			log.Printf("Local LLM failed: %v", err)
-			// In forced local mode, don't try other providers
-			if c.preferredProvider == ProviderLocal {
-				log.Printf("Local LLM-only mode: using dummy response (no fallback)")
-				return c.generateDummyResponse(message, len(history)), ProviderDummy
+	return session.Messages
+}
+
+// recordExchange stores the user message and the reply in the session history
+func (c *Chatbot) recordExchange(sessionID string, message string, response string) {
+	if sessionID == "" {
+		return
+	}
+
+	now := time.Now()
+	err := c.sessions.Append(sessionID,
+		models.ChatMessage{Role: "user", Content: message, Timestamp: now},
+		models.ChatMessage{Role: "assistant", Content: response, Timestamp: now},
+	)
+	if err != nil {
+		log.Printf("Failed to save session %s: %v", sessionID, err)
+	}
+}
+
+// GetSession returns the stored conversation for a session ID
+func (c *Chatbot) GetSession(sessionID string) (*models.Session, error) {
+	return c.sessions.Get(sessionID)
+}
+
+// DeleteSession removes the stored conversation for a session ID
+func (c *Chatbot) DeleteSession(sessionID string) error {
+	return c.sessions.Delete(sessionID)
+}
+
+// defaultSessionCleanupInterval is how often idle sessions are removed unless
+// SESSION_CLEANUP_INTERVAL is set
+const defaultSessionCleanupInterval = 5 * time.Minute
+
+// runSessionJanitor periodically removes idle sessions until Close is called
+func (c *Chatbot) runSessionJanitor(interval time.Duration) {
+	if interval <= 0 {
+		log.Printf("Invalid SESSION_CLEANUP_INTERVAL %s, using %s", interval, defaultSessionCleanupInterval)
+		interval = defaultSessionCleanupInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if removed := c.sessions.PruneExpired(); removed > 0 {
+				log.Printf("Removed %d expired sessions", removed)
 			}
+		case <-c.stopJanitor:
+			return
 		}
 	}
-
-	// Fast fallback to dummy - no provider switching during normal operation
-	return c.generateDummyResponse(message, len(history)), ProviderDummy
 }
 
-// generateDummyResponse creates a dummy response based on the user message (fallback)
-func (c *Chatbot) generateDummyResponse(message string, historyLength int) string {
-	message = strings.ToLower(message)
+// Close stops background work started by the chatbot
+func (c *Chatbot) Close() error {
+	close(c.stopJanitor)
+	if c.watcher != nil {
+		c.watcher.Stop()
+	}
+	return nil
+}
 
-	// Response patterns based on message content
-	if strings.Contains(message, "hello") || strings.Contains(message, "hi") || strings.Contains(message, "hey") {
-		greetings := []string{
-			"Hello! I'm your RAG chatbot. I can use local LLM or ChatGPT when available!",
-			"Hi there! I'm powered by AI when possible, with smart fallbacks.",
-			"Hey! I'm in Phase 3+ development - now with multiple LLM providers!",
+// buildChatResponse creates the response with the context the model saw and the citations it refers to
+func (c *Chatbot) buildChatResponse(response string, truncated bool, sessionID string, provider LLMProvider, prompt *BuiltPrompt, citations []models.Citation) models.ChatResponse {
+	// Blocks left out of the prompt can't be sources of the answer
+	var used []models.Citation
+	for _, citation := range citations {
+		if !prompt.dropped(citation.Number) {
+			used = append(used, citation)
 		}
-		return greetings[rand.Intn(len(greetings))]
 	}
 
-	if strings.Contains(message, "llm") || strings.Contains(message, "model") || strings.Contains(message, "ai") {
-		return fmt.Sprintf("I can use multiple AI providers: Local LLM (Ollama), ChatGPT, or smart dummy responses. Currently using: %s", c.currentProvider)
+	metadata := &models.ResponseMetadata{
+		Provider:  string(provider),
+		Persona:   prompt.Persona,
+		MaxTokens: prompt.Policy.MaxTokens,
+		Prompt:    prompt.Report,
+	}
+	if prompt.Model != "" {
+		metadata.Model = prompt.Model
+	} else if backend, exists := c.backends[provider]; exists {
+		metadata.Model = backend.GetModel()
 	}
 
-	if strings.Contains(message, "chatgpt") || strings.Contains(message, "openai") {
-		if c.chatgptService != nil && c.chatgptService.IsAvailable() {
-			return "ChatGPT is available! I can use it for high-quality responses via the OpenAI API."
-		} else {
-			return "ChatGPT is not configured (missing OPENAI_API_KEY) or not initialized in this mode."
+	return models.ChatResponse{
+		Message:   response,
+		SessionID: sessionID,
+		Context:   prompt.Context,
+		Sources:   resolveCitations(response, used),
+		Truncated: truncated,
+		Status:    "success",
+		Timestamp: time.Now(),
+		Metadata:  metadata,
+	}
+}
+
+// ValidateOptions checks per-request generation options against the providers in the
+// fallback chain. The options are accepted if any provider can honour them, since the
+// others are skipped when the request is answered; otherwise the first provider's
+// error is returned.
+func (c *Chatbot) ValidateOptions(options *models.GenerationOptions) error {
+	var firstErr error
+	for _, name := range c.fallbackChain {
+		backend, exists := c.backends[name]
+		if !exists {
+			continue
+		}
+		err := validateOptions(backend, options)
+		if err == nil {
+			return nil
+		}
+		if firstErr == nil {
+			firstErr = err
 		}
 	}
+	return firstErr
+}
 
-	if strings.Contains(message, "document") || strings.Contains(message, "file") || strings.Contains(message, "search") {
-		return "I'm designed for document search and RAG! Right now I'm using dummy context, but I'll soon be able to search through your actual documents and use that information with my AI."
+// HasPersona reports whether a persona name can be used in a request
+func (c *Chatbot) HasPersona(name string) bool {
+	_, err := c.personas.Get(name)
+	return err == nil
+}
+
+// prepareTurn selects the persona and renders its system prompt. The context is rendered
+// into the prompt later, once it has been fitted to the backend.
+func (c *Chatbot) prepareTurn(sections PromptSections, params ChatParams) *chatTurn {
+	persona, err := c.personas.Get(params.Persona)
+	if err != nil {
+		log.Printf("%v, using the default persona", err)
+		persona, _ = c.personas.Get("")
 	}
 
-	if strings.Contains(message, "rag") || strings.Contains(message, "retrieval") {
-		return "RAG (Retrieval-Augmented Generation) is my specialty! I combine document search with AI generation. Currently using simulated retrieval, but real document processing is coming in Phase 4!"
+	turn := &chatTurn{
+		sections: sections,
+		persona:  persona,
+		data:     newPromptData(persona.Name, params.Channel, params.User),
+		options:  params.Options,
+
+		instructions: strings.TrimSpace(params.Instructions),
 	}
 
-	// Default response with provider status
-	return fmt.Sprintf("I received: \"%s\". Currently using %s provider. I support local LLM, ChatGPT, and smart fallbacks!", message, c.currentProvider)
+	system, err := persona.Render(turn.data)
+	if err != nil {
+		log.Printf("%v, using the built-in instructions", err)
+		system = assistantInstructions
+	}
+	turn.sections.System = turn.systemPrompt(system)
+	return turn
 }
 
-// generateDummyContext creates dummy context snippets (Phase 4 will replace with real search)
-func (c *Chatbot) generateDummyContext(message string) []string {
-	contexts := []string{
-		"[Dummy Context] This would normally be a relevant snippet from your documents...",
-		"[Mock Context] In the future, this will contain actual text from files that match your query.",
-		"[Placeholder Context] Document processing will extract relevant passages here.",
+// responsePolicy returns a backend's response policy with the persona's changes applied
+func responsePolicy(backend LLMBackend, persona *Persona) ResponsePolicy {
+	policy := DefaultResponsePolicy()
+	if withPolicy, ok := backend.(PolicyBackend); ok {
+		policy = withPolicy.ResponsePolicy()
 	}
+	return policy.With(persona.policy)
+}
 
-	// Sometimes return empty context to simulate no matches
-	if rand.Float64() < 0.3 {
-		return []string{}
+// fitPrompt fits the turn into the context window of a backend and builds its request
+func (c *Chatbot) fitPrompt(name LLMProvider, turn *chatTurn) (*BuiltPrompt, GenerateRequest) {
+	policy := responsePolicy(c.backends[name], turn.persona)
+	options := models.GenerationOptions{}
+	if turn.options != nil {
+		options = *turn.options
+	}
+	if options.MaxTokens != nil {
+		policy.MaxTokens = *options.MaxTokens
+	}
+	if options.Stop != nil {
+		policy.StopPatterns = options.Stop
 	}
 
-	// Usually return 1-2 context snippets
-	numContexts := rand.Intn(2) + 1
-	if numContexts > len(contexts) {
-		numContexts = len(contexts)
+	prompt := PromptBuilderFor(c.backends[name], policy.MaxTokens).Build(turn.sections)
+	prompt.Persona = turn.persona.Name
+	prompt.Policy = policy
+	prompt.Model = options.Model
+	if len(prompt.Report.Dropped) > 0 {
+		log.Printf("Prompt for %s exceeded its %d token budget, cut %d parts", name, prompt.Report.Budget, len(prompt.Report.Dropped))
 	}
 
-	return contexts[:numContexts]
+	request := GenerateRequest{
+		SystemPrompt: turn.sections.System,
+		Message:      prompt.Message,
+		Context:      prompt.Context,
+		History:      prompt.History,
+		MaxTokens:    policy.MaxTokens,
+		Stop:         policy.StopPatterns,
+		Model:        options.Model,
+		Temperature:  options.Temperature,
+		TopP:         options.TopP,
+		Seed:         options.Seed,
+		Format:       options.Format,
+	}
+
+	// Personas that place the context themselves get it rendered into the system prompt
+	if turn.persona.embedsContext {
+		data := turn.data
+		data.Context = strings.Join(prompt.Context, "\n")
+		data.HasContext = len(prompt.Context) > 0
+		if system, err := turn.persona.Render(data); err != nil {
+			log.Printf("%v, listing context after the system prompt", err)
+		} else {
+			request.SystemPrompt = turn.systemPrompt(system)
+			request.Context = nil
+		}
+	}
+
+	return prompt, request
+}
+
+// unfittedPrompt returns the turn as it is, for replies that don't use a model
+func unfittedPrompt(turn *chatTurn) *BuiltPrompt {
+	return &BuiltPrompt{
+		Context: turn.sections.flatten(),
+		History: turn.sections.History,
+		Message: turn.sections.Message,
+		Persona: turn.persona.Name,
+		Policy:  DefaultResponsePolicy(),
+	}
 }
 
-// generateDummySources creates dummy source file names (Phase 4 will replace with real files)
-func (c *Chatbot) generateDummySources() []string {
-	sources := []string{
-		"dummy-document-1.txt",
-		"sample-file.md",
-		"mock-content.pdf",
-		"placeholder-doc.txt",
+// buildFallbackChain returns the ordered providers to try for each request.
+// LLM_FALLBACK_CHAIN overrides the default of every initialized backend in order;
+// the dummy provider is always kept as the last resort.
+func buildFallbackChain(backends map[LLMProvider]LLMBackend, backendOrder []LLMProvider) []LLMProvider {
+	var chain []LLMProvider
+
+	configured := utils.GetEnvList("LLM_FALLBACK_CHAIN")
+	if len(configured) == 0 {
+		chain = append(chain, backendOrder...)
+	} else {
+		for _, entry := range configured {
+			name := LLMProvider(entry)
+			if name == ProviderDummy {
+				break
+			}
+			if _, exists := backends[name]; !exists {
+				log.Printf("Ignoring %s in LLM_FALLBACK_CHAIN: backend not initialized", name)
+				continue
+			}
+			chain = append(chain, name)
+		}
 	}
 
-	// Sometimes return no sources
-	if rand.Float64() < 0.3 {
-		return []string{}
+	return append(chain, ProviderDummy)
+}
+
+// generateResponse walks the fallback chain, skipping providers whose circuit is open
+func (c *Chatbot) generateResponse(ctx context.Context, turn *chatTurn) (string, LLMProvider, *BuiltPrompt) {
+	c.scheduleProviderRefresh()
+
+	for _, name := range c.fallbackChain {
+		if name == ProviderDummy {
+			break
+		}
+
+		if err := validateOptions(c.backends[name], turn.options); err != nil {
+			log.Printf("Skipping %v", err)
+			continue
+		}
+		breaker := c.breakers[name]
+		if !breaker.Allow() {
+			continue
+		}
+
+		prompt, request := c.fitPrompt(name, turn)
+		response, err := c.backends[name].GenerateResponse(ctx, request)
+		if err != nil {
+			// A cancelled request says nothing about the provider's health
+			if ctx.Err() != nil {
+				breaker.Release()
+				break
+			}
+			breaker.RecordFailure(err)
+			log.Printf("%s failed (circuit %s): %v", name, breaker.State(), err)
+			continue
+		}
+
+		breaker.RecordSuccess()
+		c.setCurrentProvider(name)
+		return response, name, prompt
 	}
 
-	// Usually return 1-2 sources
-	numSources := rand.Intn(2) + 1
-	if numSources > len(sources) {
-		numSources = len(sources)
+	log.Printf("Fallback chain exhausted, using dummy response")
+	return c.generateDummyResponse(turn.sections.Message, len(turn.sections.History)), ProviderDummy, unfittedPrompt(turn)
+}
+
+// completePrompt sends a standalone request along the fallback chain for internal tasks such
+// as re-ranking, fitting its context blocks into each backend's budget. Unlike
+// generateResponse it returns an error instead of a dummy reply.
+func (c *Chatbot) completePrompt(ctx context.Context, request GenerateRequest) (string, error) {
+	for _, name := range c.fallbackChain {
+		if name == ProviderDummy {
+			break
+		}
+
+		breaker := c.breakers[name]
+		if !breaker.Allow() {
+			continue
+		}
+
+		reserve := request.MaxTokens
+		if reserve <= 0 {
+			reserve = defaultMaxOutputTokens
+		}
+		prompt := PromptBuilderFor(c.backends[name], reserve).Build(PromptSections{
+			System:    request.SystemPrompt,
+			Documents: request.Context,
+			Message:   request.Message,
+		})
+		if len(prompt.Report.Dropped) > 0 {
+			log.Printf("Prompt for %s exceeded its %d token budget, cut %d parts", name, prompt.Report.Budget, len(prompt.Report.Dropped))
+		}
+		fitted := request
+		fitted.Context = prompt.Context
+		fitted.Message = prompt.Message
+
+		response, err := c.backends[name].GenerateResponse(ctx, fitted)
+		if err != nil {
+			// A cancelled request says nothing about the provider's health
+			if ctx.Err() != nil {
+				breaker.Release()
+				return "", err
+			}
+			breaker.RecordFailure(err)
+			log.Printf("%s failed (circuit %s): %v", name, breaker.State(), err)
+			continue
+		}
+
+		breaker.RecordSuccess()
+		return response, nil
 	}
 
-	return sources[:numSources]
+	return "", fmt.Errorf("no language model available")
 }
 
-func (c *Chatbot) generateContext(message string, sessionID string) []string {
-	var context []string
+// generateStreamingResponse walks the fallback chain like generateResponse, streaming from
+// providers that support it. Once fragments have been sent a failure can no longer fall
+// back to the next provider, so the partial response is returned with the error.
+func (c *Chatbot) generateStreamingResponse(ctx context.Context, turn *chatTurn, onToken func(token string) error) (string, LLMProvider, *BuiltPrompt, error) {
+	c.scheduleProviderRefresh()
 
-	// Add RAG context if enabled
-	if c.enableRAG && c.ragService != nil {
-		// Extract channel ID from session ID if it contains discord info
-		channelID := ""
-		if strings.Contains(sessionID, "discord_") {
-			parts := strings.Split(sessionID, "_")
-			if len(parts) >= 3 {
-				channelID = parts[2] // discord_userID_channelID
+	for _, name := range c.fallbackChain {
+		if name == ProviderDummy {
+			break
+		}
+
+		if err := validateOptions(c.backends[name], turn.options); err != nil {
+			log.Printf("Skipping %v", err)
+			continue
+		}
+		breaker := c.breakers[name]
+		if !breaker.Allow() {
+			continue
+		}
+
+		prompt, request := c.fitPrompt(name, turn)
+
+		streamer, canStream := c.backends[name].(StreamingBackend)
+		if !canStream {
+			response, err := c.backends[name].GenerateResponse(ctx, request)
+			if err != nil {
+				// A cancelled request says nothing about the provider's health
+				if ctx.Err() != nil {
+					breaker.Release()
+					return "", name, prompt, err
+				}
+				breaker.RecordFailure(err)
+				log.Printf("%s failed (circuit %s): %v", name, breaker.State(), err)
+				continue
 			}
+
+			breaker.RecordSuccess()
+			c.setCurrentProvider(name)
+			return response, name, prompt, onToken(response)
 		}
 
-		ragResponse, err := c.ragService.Query(message, channelID, 3)
-		if err == nil && len(ragResponse.Documents) > 0 {
-			for _, doc := range ragResponse.Documents {
-				contextEntry := fmt.Sprintf("[RAG Context from %s] %s",
-					filepath.Base(doc.Source), doc.Content)
-				context = append(context, contextEntry)
+		tokensSent := 0
+		response, err := streamer.StreamResponse(ctx, request, func(token string) error {
+			tokensSent++
+			return onToken(token)
+		})
+		if err != nil {
+			// A cancelled request says nothing about the provider's health
+			if ctx.Err() != nil {
+				breaker.Release()
+				return response, name, prompt, err
+			}
+			breaker.RecordFailure(err)
+			log.Printf("%s stream failed (circuit %s): %v", name, breaker.State(), err)
+			if tokensSent > 0 {
+				return response, name, prompt, err
 			}
+			continue
 		}
+
+		breaker.RecordSuccess()
+		c.setCurrentProvider(name)
+		return response, name, prompt, nil
 	}
 
-	// Add existing dummy context for compatibility
-	dummyContext := c.generateDummyContext(message)
-	context = append(context, dummyContext...)
+	log.Printf("Fallback chain exhausted, using dummy response")
+	response := c.generateDummyResponse(turn.sections.Message, len(turn.sections.History))
+	return response, ProviderDummy, unfittedPrompt(turn), onToken(response)
+}
 
-	return context
+// setCurrentProvider records the provider that most recently answered
+func (c *Chatbot) setCurrentProvider(name LLMProvider) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.currentProvider != name {
+		log.Printf("Switched provider: %s -> %s", c.currentProvider, name)
+		c.currentProvider = name
+	}
 }
 
-func (c *Chatbot) ProcessRAGQuery(query string, channelID string, limit int) *models.RAGResponse {
+// scheduleProviderRefresh runs refreshProviderStatus in the background once the check interval has passed
+func (c *Chatbot) scheduleProviderRefresh() {
+	c.mu.RLock()
+	due := time.Since(c.lastProviderCheck) >= c.checkInterval
+	c.mu.RUnlock()
+
+	if !due || !c.refreshing.CompareAndSwap(false, true) {
+		return
+	}
+
+	go func() {
+		defer c.refreshing.Store(false)
+		c.refreshProviderStatus()
+	}()
+}
+
+// generateDummyResponse creates a dummy response based on the user message (fallback)
+func (c *Chatbot) generateDummyResponse(message string, historyLength int) string {
+	message = strings.ToLower(message)
+
+	// Response patterns based on message content
+	if strings.Contains(message, "hello") || strings.Contains(message, "hi") || strings.Contains(message, "hey") {
+		greetings := []string{
+			"Hello! I'm your RAG chatbot. I can use local LLM or ChatGPT when available!",
+			"Hi there! I'm powered by AI when possible, with smart fallbacks.",
+			"Hey! I can answer with a local LLM or ChatGPT and cite the documents I used.",
+		}
+		return greetings[rand.Intn(len(greetings))]
+	}
+
+	if strings.Contains(message, "llm") || strings.Contains(message, "model") || strings.Contains(message, "ai") {
+		return fmt.Sprintf("I can use multiple AI providers: Local LLM (Ollama), ChatGPT, or smart dummy responses. Currently using: %s", c.GetCurrentProvider())
+	}
+
+	if strings.Contains(message, "chatgpt") || strings.Contains(message, "openai") {
+		if backend, exists := c.backends[ProviderChatGPT]; exists && backend.IsAvailable() {
+			return "ChatGPT is available! I can use it for high-quality responses via the OpenAI API."
+		} else {
+			return "ChatGPT is not configured (missing OPENAI_API_KEY) or not initialized in this mode."
+		}
+	}
+
+	if strings.Contains(message, "document") || strings.Contains(message, "file") || strings.Contains(message, "search") {
+		return "I'm designed for document search and RAG! With --rag I search your documents and list the sources I used with each answer."
+	}
+
+	if strings.Contains(message, "rag") || strings.Contains(message, "retrieval") {
+		if c.ragService != nil {
+			return fmt.Sprintf("RAG (Retrieval-Augmented Generation) is enabled: I search %d indexed chunks from your documents and cite the ones I used.", c.ragService.DocumentCount())
+		}
+		return "RAG (Retrieval-Augmented Generation) is not enabled. Start the server with --rag to let me search your documents."
+	}
+
+	// Default response with provider status
+	return fmt.Sprintf("I received: \"%s\". Currently using %s provider. I support local LLM, ChatGPT, and smart fallbacks!", message, c.GetCurrentProvider())
+}
+
+// GetRAGService returns the RAG service, or an error when RAG is not enabled
+func (c *Chatbot) GetRAGService() (*RAGService, error) {
+	if !c.enableRAG || c.ragService == nil {
+		return nil, fmt.Errorf("RAG service not enabled")
+	}
+	return c.ragService, nil
+}
+
+func (c *Chatbot) ProcessRAGQuery(ctx context.Context, query models.RAGQuery) *models.RAGResponse {
 	if !c.enableRAG {
 		return &models.RAGResponse{
 			BaseResponse: models.BaseResponse{
@@ -339,13 +809,13 @@ func (c *Chatbot) ProcessRAGQuery(query string, channelID string, limit int) *mo
 				Timestamp: time.Now(),
 			},
 			Documents: []models.RAGDocument{},
-			Query:     query,
+			Query:     query.Query,
 			Context:   []string{},
 			Total:     0,
 		}
 	}
 
-	response, err := c.ragService.Query(query, channelID, limit)
+	response, err := c.ragService.Query(ctx, query)
 	if err != nil {
 		log.Printf("RAG query failed: %v", err)
 		return &models.RAGResponse{
@@ -355,7 +825,7 @@ func (c *Chatbot) ProcessRAGQuery(query string, channelID string, limit int) *mo
 				Timestamp: time.Now(),
 			},
 			Documents: []models.RAGDocument{},
-			Query:     query,
+			Query:     query.Query,
 			Context:   []string{},
 			Total:     0,
 		}
@@ -364,8 +834,12 @@ func (c *Chatbot) ProcessRAGQuery(query string, channelID string, limit int) *mo
 	return response
 }
 
-func (c *Chatbot) generateContextWithHistory(message string, sessionID string, history []models.ChatMessage) []string {
-	var context []string
+// generateContextWithHistory gathers numbered context blocks from documents and web search,
+// along with a citation for each block. The history is passed on as is; the prompt
+// builder decides how much of it fits.
+func (c *Chatbot) generateContextWithHistory(ctx context.Context, message string, sessionID string, history []models.ChatMessage, searchMode SearchMode) (PromptSections, []models.Citation) {
+	sections := PromptSections{Message: message, History: history}
+	var citations []models.Citation
 
 	// Add RAG context if enabled
 	if c.enableRAG {
@@ -379,36 +853,63 @@ func (c *Chatbot) generateContextWithHistory(message string, sessionID string, h
 		}
 
 		// Get RAG context from documents
-		ragResponse, err := c.ragService.Query(message, channelID, 3)
-		if err == nil && len(ragResponse.Documents) > 0 {
+		ragResponse, err := c.ragService.Query(ctx, models.RAGQuery{Query: message, ChannelID: channelID, Limit: 3})
+		if err != nil {
+			log.Printf("RAG query failed: %v", err)
+		} else {
 			for _, doc := range ragResponse.Documents {
-				contextEntry := fmt.Sprintf("[Document: %s] %s",
-					filepath.Base(doc.Source), doc.Content)
-				context = append(context, contextEntry)
+				citation := documentCitation(len(citations)+1, doc)
+				citations = append(citations, citation)
+				sections.Documents = append(sections.Documents, formatCitedContext(citation, doc.Content))
 			}
 		}
 	}
 
-	// Add Discord message history as context
-	if len(history) > 0 {
-		context = append(context, "[Recent Conversation]")
-		for _, msg := range history {
-			if msg.Role == "assistant" {
-				context = append(context, fmt.Sprintf("Bot: %s", msg.Content))
-			} else {
-				context = append(context, msg.Content) // Already has username
+	// Add web search results when the message asks for current information
+	if query, ok := c.searchQuery(ctx, message, history, searchMode); ok {
+		searchResponse, err := c.search.Search(query, 3)
+		if err != nil {
+			log.Printf("Search failed: %v", err)
+		} else {
+			for _, result := range searchResponse.Results {
+				citation := webCitation(len(citations)+1, result)
+				citations = append(citations, citation)
+				sections.Search = append(sections.Search, formatCitedContext(citation, result.Description))
 			}
+			log.Printf("Added %d search results to context", len(searchResponse.Results))
 		}
 	}
 
-	// Add existing dummy context for compatibility (reduced since we have real context now)
-	if len(context) == 0 {
-		// Only add dummy context if we have no real context
-		dummyContext := c.generateDummyContext(message)
-		context = append(context, dummyContext...)
+	return sections, citations
+}
+
+// searchQuery decides whether to search the web for the message and returns the query to
+// send. If the decider fails, the keyword heuristic decides instead.
+func (c *Chatbot) searchQuery(ctx context.Context, message string, history []models.ChatMessage, mode SearchMode) (string, bool) {
+	if c.search == nil || !c.search.IsEnabled() || mode == SearchNever {
+		return "", false
+	}
+	// With the web_search tool the model searches when it needs to; don't search twice
+	if mode == SearchAuto && c.tools != nil && c.tools.Has(ToolWebSearch) {
+		return "", false
+	}
+
+	decision, err := c.searchDecider.Decide(ctx, message, history)
+	if err != nil {
+		log.Printf("%s search decider failed, using keywords: %v", c.searchDecider.Name(), err)
+		decision = SearchDecision{Search: c.search.ShouldSearch(message), Query: message}
+	}
+	if mode == SearchAlways {
+		decision.Search = true
+	}
+	if decision.Query == "" {
+		decision.Query = message
 	}
 
-	return context
+	if decision.Search && decision.Query != message {
+		log.Printf("Searching the web for %q", decision.Query)
+	}
+	return decision.Query, decision.Search
 }
 
 // GetStatus returns the current status of the chatbot
@@ -419,35 +920,37 @@ func (c *Chatbot) GetStatus() map[string]interface{} {
 		"initialized":        c.initialized,
 		"uptime":             time.Since(c.startTime).String(),
 		"phase":              "3+",
-		"current_provider":   string(c.currentProvider),
+		"current_provider":   string(c.GetCurrentProvider()),
 		"preferred_provider": string(c.preferredProvider),
+		"fallback_chain":     c.getFallbackChainStatus(),
 	}
 
 	// Add provider-specific status (only for initialized services)
 	providers := make(map[string]interface{})
 
-	if c.llmService != nil {
-		providers["local"] = c.llmService.GetStatus()
-	} else {
-		providers["local"] = map[string]interface{}{
-			"status": "not_initialized",
-			"note":   "Skipped in ChatGPT-only mode",
-		}
+	for _, name := range c.backendOrder {
+		providers[string(name)] = c.backends[name].GetStatus()
 	}
 
-	if c.chatgptService != nil {
-		providers["chatgpt"] = c.chatgptService.GetStatus()
-	} else {
-		providers["chatgpt"] = map[string]interface{}{
+	for _, name := range RegisteredBackends() {
+		if _, exists := c.backends[name]; exists {
+			continue
+		}
+
+		note := "Not listed in LLM_BACKENDS"
+		if c.preferredProvider != "" {
+			note = fmt.Sprintf("Skipped in %s-only mode", c.preferredProvider)
+		}
+		providers[string(name)] = map[string]interface{}{
 			"status": "not_initialized",
-			"note":   "Skipped in Local LLM-only mode",
+			"note":   note,
 		}
 	}
 
 	status["providers"] = providers
 
 	// Set capabilities based on what's actually available
-	capabilities := []string{"conversation_tracking", "context_simulation"}
+	capabilities := []string{"conversation_tracking", "source_citations"}
 
 	switch c.preferredProvider {
 	case ProviderChatGPT:
@@ -459,8 +962,13 @@ func (c *Chatbot) GetStatus() map[string]interface{} {
 	}
 
 	if c.ragService != nil {
-		status["rag"] = c.ragService.GetStatus()
+		ragStatus := c.ragService.GetStatus()
+		if c.watcher != nil {
+			ragStatus["watcher"] = c.watcher.GetStatus()
+		}
+		status["rag"] = ragStatus
 		status["rag_enabled"] = c.enableRAG
+		capabilities = append(capabilities, "document_retrieval")
 	} else {
 		status["rag"] = map[string]interface{}{
 			"status": "disabled",
@@ -469,13 +977,35 @@ func (c *Chatbot) GetStatus() map[string]interface{} {
 		status["rag_enabled"] = false
 	}
 
-	status["capabilities"] = capabilities
-	status["coming_soon"] = []string{
-		"document_processing",
-		"real_search",
-		"full_rag_pipeline",
+	status["personas"] = c.personas.GetStatus()
+
+	if c.search != nil {
+		searchStatus := c.search.GetStatus()
+		searchStatus["decider"] = c.searchDecider.Name()
+		status["search"] = searchStatus
+		status["search_enabled"] = c.search.IsEnabled()
+		if c.search.IsEnabled() {
+			capabilities = append(capabilities, "web_search")
+		}
+	} else {
+		status["search"] = map[string]interface{}{
+			"status": "disabled",
+			"note":   "Search not enabled for this instance",
+		}
+		status["search_enabled"] = false
 	}
 
+	status["sessions"] = c.sessions.GetStatus()
+
+	if c.tools != nil {
+		tools := c.tools.GetStatus()
+		tools["max_iterations"] = c.maxToolRounds
+		status["tools"] = tools
+		capabilities = append(capabilities, "tool_calling")
+	}
+
+	status["capabilities"] = capabilities
+
 	return status
 }
 
@@ -491,40 +1021,129 @@ func (c *Chatbot) getStatusMode() string {
 	}
 }
 
-// refreshProviderStatus checks provider availability (only in auto-detect mode)
+// getFallbackChainStatus returns each chain entry with its circuit breaker state
+func (c *Chatbot) getFallbackChainStatus() []map[string]interface{} {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	chain := make([]map[string]interface{}, 0, len(c.fallbackChain))
+	for _, name := range c.fallbackChain {
+		entry := map[string]interface{}{
+			"provider": string(name),
+		}
+
+		if breaker, exists := c.breakers[name]; exists {
+			entry["available"] = c.providerCheckCache[name]
+			entry["circuit"] = breaker.GetStatus()
+		} else {
+			entry["available"] = true
+		}
+
+		chain = append(chain, entry)
+	}
+
+	return chain
+}
+
+// refreshProviderStatus checks provider availability and moves the current provider
+// to the first healthy entry of the fallback chain
 func (c *Chatbot) refreshProviderStatus() {
-	// Don't refresh in forced modes - they stick to their provider
-	if c.preferredProvider == ProviderChatGPT || c.preferredProvider == ProviderLocal {
-		return
+	// Quick availability check (only for initialized services), done without holding the lock
+	availability := make(map[LLMProvider]bool)
+	for _, name := range c.backendOrder {
+		availability[name] = c.backends[name].IsAvailable()
 	}
 
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	c.lastProviderCheck = time.Now()
+	for name, available := range availability {
+		c.providerCheckCache[name] = available
+	}
 
-	// Quick availability check (only for initialized services)
-	var localAvailable, chatgptAvailable bool
+	previous := c.currentProvider
+	c.currentProvider = ProviderDummy
+	for _, name := range c.fallbackChain {
+		if name == ProviderDummy {
+			break
+		}
+		if c.providerCheckCache[name] && c.breakers[name].State() != CircuitOpen {
+			c.currentProvider = name
+			break
+		}
+	}
 
-	if c.llmService != nil {
-		localAvailable = c.llmService.IsAvailable()
-		c.providerCheckCache[ProviderLocal] = localAvailable
+	if previous != c.currentProvider {
+		log.Printf("Switched to %s due to %s unavailability", c.currentProvider, previous)
 	}
+}
 
-	if c.chatgptService != nil {
-		chatgptAvailable = c.chatgptService.IsAvailable()
-		c.providerCheckCache[ProviderChatGPT] = chatgptAvailable
+// CurrentModel returns the default model of the provider currently answering
+func (c *Chatbot) CurrentModel() string {
+	provider := c.GetCurrentProvider()
+	if backend, exists := c.backends[provider]; exists {
+		return backend.GetModel()
 	}
+	return string(provider)
+}
 
-	// Only switch if current provider is down and another is available
-	if c.currentProvider == ProviderLocal && !localAvailable && chatgptAvailable {
-		c.currentProvider = ProviderChatGPT
-		log.Printf("Switched to ChatGPT due to local LLM unavailability")
-	} else if c.currentProvider == ProviderChatGPT && !chatgptAvailable && localAvailable {
-		c.currentProvider = ProviderLocal
-		log.Printf("Switched to local LLM due to ChatGPT unavailability")
+// ListModels returns the current and available models of every configured backend
+func (c *Chatbot) ListModels() []models.ProviderModels {
+	list := make([]models.ProviderModels, 0, len(c.backendOrder))
+	for _, name := range c.backendOrder {
+		backend := c.backends[name]
+		entry := models.ProviderModels{
+			Provider: string(name),
+			Model:    backend.GetModel(),
+		}
+		if lister, ok := backend.(ModelBackend); ok {
+			available, err := lister.GetAvailableModels()
+			if err != nil {
+				entry.Error = err.Error()
+			}
+			entry.Available = available
+		}
+		list = append(list, entry)
 	}
+	return list
+}
+
+// SetActiveModel switches the default model of a provider, or of the provider currently
+// answering if none is given. The model must be listed by the provider. Requests in flight
+// finish with the model they started with. It returns the previous and the new model name.
+func (c *Chatbot) SetActiveModel(provider LLMProvider, model string) (string, string, error) {
+	if provider == "" {
+		provider = c.GetCurrentProvider()
+	}
+	backend, exists := c.backends[provider]
+	if !exists {
+		return "", "", fmt.Errorf("%w: %s", ErrUnknownProvider, provider)
+	}
+	switcher, ok := backend.(ModelBackend)
+	if !ok {
+		return "", "", fmt.Errorf("%w: %s can't switch models", ErrUnknownProvider, provider)
+	}
+
+	available, err := switcher.GetAvailableModels()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to list %s models: %w", provider, err)
+	}
+	name := findModel(available, model)
+	if name == "" {
+		return "", "", fmt.Errorf("%w: %s has no model %s", ErrUnknownModel, provider, model)
+	}
+
+	previous := switcher.GetModel()
+	switcher.SetModel(name)
+	log.Printf("Switched %s model from %s to %s", provider, previous, name)
+	return previous, name, nil
 }
 
 // GetCurrentProvider returns the currently active provider
 func (c *Chatbot) GetCurrentProvider() LLMProvider {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 	return c.currentProvider
 }
 
@@ -535,6 +1154,9 @@ func (c *Chatbot) IsReady() bool {
 
 // Reset resets the chatbot state (useful for testing)
 func (c *Chatbot) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	c.startTime = time.Now()
 	c.initialized = true
 	c.lastProviderCheck = time.Now()
@@ -545,51 +1167,29 @@ func (c *Chatbot) Reset() {
 	}
 
 	// Reset provider availability cache based on what's currently initialized
-	if c.llmService != nil {
-		c.providerCheckCache[ProviderLocal] = c.llmService.IsAvailable()
-	} else {
-		c.providerCheckCache[ProviderLocal] = false
+	for _, name := range RegisteredBackends() {
+		if backend, exists := c.backends[name]; exists {
+			c.providerCheckCache[name] = backend.IsAvailable()
+		} else {
+			c.providerCheckCache[name] = false
+		}
 	}
 
-	if c.chatgptService != nil {
-		c.providerCheckCache[ProviderChatGPT] = c.chatgptService.IsAvailable()
-	} else {
-		c.providerCheckCache[ProviderChatGPT] = false
+	// Close every circuit
+	for _, breaker := range c.breakers {
+		breaker.RecordSuccess()
 	}
 
-	log.Printf("Chatbot state reset. Provider: %s, Initialized services: Local=%v, ChatGPT=%v",
+	log.Printf("Chatbot state reset. Provider: %s, Initialized backends: %v",
 		c.currentProvider,
-		c.llmService != nil,
-		c.chatgptService != nil)
+		c.backendOrder)
 }
 
 // RefreshProviders attempts to reconnect to all LLM services and update current provider
 func (c *Chatbot) RefreshProviders() {
-	// Don't refresh in forced provider modes
-	if c.preferredProvider == ProviderChatGPT || c.preferredProvider == ProviderLocal {
-		log.Printf("RefreshProviders skipped in forced provider mode: %s", c.preferredProvider)
-		return
-	}
-
-	// Only check initialized services
-	var localAvailable, chatgptAvailable bool
-
-	if c.llmService != nil {
-		localAvailable = c.llmService.IsAvailable()
-	}
-
-	if c.chatgptService != nil {
-		chatgptAvailable = c.chatgptService.IsAvailable()
-	}
-
-	// Re-evaluate current provider based on availability and preference (auto-detect only)
-	if localAvailable {
-		c.currentProvider = ProviderLocal
-	} else if chatgptAvailable {
-		c.currentProvider = ProviderChatGPT
-	} else {
-		c.currentProvider = ProviderDummy
-	}
+	c.refreshProviderStatus()
 
-	log.Printf("Provider refreshed. Current: %s, Local: %v, ChatGPT: %v", c.currentProvider, localAvailable, chatgptAvailable)
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	log.Printf("Provider refreshed. Current: %s, Availability: %v", c.currentProvider, c.providerCheckCache)
 }
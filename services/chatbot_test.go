@@ -0,0 +1,246 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"chatbot/models"
+)
+
+// fakeBackend is a scripted LLM backend for chatbot tests
+type fakeBackend struct {
+	name    LLMProvider
+	reply   string
+	err     error
+	options error // Returned by ValidateOptions
+	calls   int
+	prompts []string
+}
+
+func (f *fakeBackend) Name() LLMProvider                              { return f.name }
+func (f *fakeBackend) IsAvailable() bool                              { return true }
+func (f *fakeBackend) GetModel() string                               { return "fake" }
+func (f *fakeBackend) GetStatus() map[string]interface{}              { return map[string]interface{}{} }
+func (f *fakeBackend) ValidateOptions(models.GenerationOptions) error { return f.options }
+
+func (f *fakeBackend) GenerateResponse(ctx context.Context, request GenerateRequest) (string, error) {
+	f.calls++
+	f.prompts = append(f.prompts, request.Message)
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	return f.reply, f.err
+}
+
+// fakeToolBackend is a fake backend whose model can't call tools
+type fakeToolBackend struct {
+	fakeBackend
+}
+
+func (f *fakeToolBackend) GenerateToolTurn(context.Context, GenerateRequest) (string, []ToolCall, error) {
+	f.calls++
+	return "", nil, ErrToolsUnsupported
+}
+
+// smallBackend is a fake backend with a small context window that records its requests
+type smallBackend struct {
+	fakeBackend
+	window   int
+	requests []GenerateRequest
+}
+
+func (f *smallBackend) ContextWindow() int             { return f.window }
+func (f *smallBackend) EstimateTokens(text string) int { return EstimateTokens(text) }
+
+func (f *smallBackend) GenerateResponse(ctx context.Context, request GenerateRequest) (string, error) {
+	f.requests = append(f.requests, request)
+	return f.fakeBackend.GenerateResponse(ctx, request)
+}
+
+// newTestChatbot creates a chatbot that walks the given backends in order
+func newTestChatbot(backends ...LLMBackend) *Chatbot {
+	c := &Chatbot{
+		backends:           make(map[LLMProvider]LLMBackend),
+		breakers:           make(map[LLMProvider]*CircuitBreaker),
+		providerCheckCache: make(map[LLMProvider]bool),
+		checkInterval:      time.Hour,
+		lastProviderCheck:  time.Now(),
+		maxToolRounds:      2,
+	}
+	for _, backend := range backends {
+		c.backends[backend.Name()] = backend
+		c.breakers[backend.Name()] = NewCircuitBreaker(1, 0)
+		c.fallbackChain = append(c.fallbackChain, backend.Name())
+	}
+	c.fallbackChain = append(c.fallbackChain, ProviderDummy)
+	return c
+}
+
+func newTestTurn(message string) *chatTurn {
+	return &chatTurn{
+		sections: PromptSections{Message: message},
+		persona:  &Persona{Name: "default"},
+	}
+}
+
+// halfOpen puts a provider's circuit into the half-open state
+func halfOpen(c *Chatbot, name LLMProvider) *CircuitBreaker {
+	breaker := c.breakers[name]
+	breaker.RecordFailure(errors.New("down"))
+	return breaker
+}
+
+func TestGenerateResponseFallsBack(t *testing.T) {
+	failing := &fakeBackend{name: ProviderLocal, err: errors.New("connection refused")}
+	working := &fakeBackend{name: ProviderChatGPT, reply: "hello"}
+	c := newTestChatbot(failing, working)
+
+	response, name, _ := c.generateResponse(context.Background(), newTestTurn("hi"))
+	if response != "hello" || name != ProviderChatGPT {
+		t.Fatalf("got %q from %s, want hello from chatgpt", response, name)
+	}
+	if c.breakers[ProviderLocal].State() != CircuitHalfOpen {
+		t.Errorf("the failing provider's circuit should have opened")
+	}
+}
+
+func TestCancelledResponseReleasesTrial(t *testing.T) {
+	backend := &fakeBackend{name: ProviderLocal, reply: "ok"}
+	c := newTestChatbot(backend)
+	breaker := halfOpen(c, ProviderLocal)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, name, _ := c.generateResponse(ctx, newTestTurn("hi"))
+
+	if name != ProviderDummy {
+		t.Fatalf("a cancelled request should not be answered by %s", name)
+	}
+	if breaker.failures != 1 {
+		t.Errorf("a cancelled request should not count as a failure, got %d failures", breaker.failures)
+	}
+	if !breaker.Allow() {
+		t.Error("a cancelled request should release the half-open trial")
+	}
+}
+
+func TestCancelledStreamReleasesTrial(t *testing.T) {
+	backend := &fakeBackend{name: ProviderLocal, reply: "ok"}
+	c := newTestChatbot(backend)
+	breaker := halfOpen(c, ProviderLocal)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, _, _, err := c.generateStreamingResponse(ctx, newTestTurn("hi"), func(string) error { return nil })
+
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want context.Canceled", err)
+	}
+	if breaker.failures != 1 {
+		t.Errorf("a cancelled request should not count as a failure, got %d failures", breaker.failures)
+	}
+	if !breaker.Allow() {
+		t.Error("a cancelled request should release the half-open trial")
+	}
+}
+
+func TestCancelledCompletionReleasesTrial(t *testing.T) {
+	backend := &fakeBackend{name: ProviderLocal, reply: "1: 5"}
+	c := newTestChatbot(backend)
+	breaker := halfOpen(c, ProviderLocal)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := c.completePrompt(ctx, GenerateRequest{Message: "rate these passages"}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want context.Canceled", err)
+	}
+	if !breaker.Allow() {
+		t.Error("a cancelled completion should release the half-open trial")
+	}
+}
+
+func TestInvalidOptionsDontHoldTrial(t *testing.T) {
+	backend := &fakeBackend{name: ProviderLocal, options: ErrInvalidOptions, reply: "ok"}
+	c := newTestChatbot(backend)
+	breaker := halfOpen(c, ProviderLocal)
+
+	turn := newTestTurn("hi")
+	turn.options = &models.GenerationOptions{Model: "missing"}
+	c.generateResponse(context.Background(), turn)
+
+	if backend.calls != 0 {
+		t.Fatal("a provider rejecting the options should not be called")
+	}
+	if !breaker.Allow() {
+		t.Error("skipping a provider for its options should not use up the half-open trial")
+	}
+}
+
+func TestToolsUnsupportedReleasesTrial(t *testing.T) {
+	backend := &fakeToolBackend{fakeBackend{name: ProviderLocal, reply: "plain answer"}}
+	c := newTestChatbot(backend)
+	c.RegisterTool(NewCalculatorTool())
+	breaker := halfOpen(c, ProviderLocal)
+
+	response, _, _, calls := c.generateWithTools(context.Background(), newTestTurn("what is 2+2?"))
+
+	if response != "plain answer" || calls != nil {
+		t.Fatalf("expected a plain answer without tools, got %q with %d calls", response, len(calls))
+	}
+	if breaker.State() != CircuitClosed {
+		t.Errorf("the plain answer should have closed the circuit, got %s", breaker.State())
+	}
+}
+
+func TestCompletePromptFitsContextWindow(t *testing.T) {
+	backend := &smallBackend{fakeBackend: fakeBackend{name: ProviderLocal, reply: "1: 5"}, window: 1024}
+	c := newTestChatbot(backend)
+
+	passages := make([]string, 20)
+	for i := range passages {
+		passages[i] = strings.Repeat("word ", 100)
+	}
+	_, err := c.completePrompt(context.Background(), GenerateRequest{
+		SystemPrompt: "Rate the passages.",
+		Context:      passages,
+		Message:      "Question: what?",
+		MaxTokens:    100,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := backend.requests[0]
+	if len(request.Context) == 0 || len(request.Context) >= len(passages) {
+		t.Fatalf("expected the passages to be cut to fit, got %d of %d", len(request.Context), len(passages))
+	}
+	if request.Message != "Question: what?" || request.SystemPrompt != "Rate the passages." || request.MaxTokens != 100 {
+		t.Errorf("the request should keep its message, system prompt and reply length, got %+v", request)
+	}
+	used := EstimateTokens(request.SystemPrompt) + EstimateTokens(request.Message) + request.MaxTokens
+	for _, passage := range request.Context {
+		used += EstimateTokens(passage)
+	}
+	if used > backend.window {
+		t.Errorf("the request needs %d tokens, more than the %d token window", used, backend.window)
+	}
+}
+
+func TestValidateOptionsAcceptsAnyBackendInChain(t *testing.T) {
+	local := &fakeBackend{name: ProviderLocal, options: ErrInvalidOptions}
+	chatgpt := &fakeBackend{name: ProviderChatGPT}
+	c := newTestChatbot(local, chatgpt)
+	options := &models.GenerationOptions{Model: "gpt-4o"}
+
+	if err := c.ValidateOptions(options); err != nil {
+		t.Errorf("a model served by a later backend should be accepted, got %v", err)
+	}
+
+	chatgpt.options = ErrInvalidOptions
+	if err := c.ValidateOptions(options); !errors.Is(err, ErrInvalidOptions) {
+		t.Errorf("err = %v, want ErrInvalidOptions when no backend accepts the options", err)
+	}
+}
@@ -1,41 +1,78 @@
 package services
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
 	"net/http"
 	"os"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"chatbot/models"
+	"chatbot/utils"
 )
 
 // ChatGPTService handles communication with OpenAI's ChatGPT API
 type ChatGPTService struct {
+	mu            sync.RWMutex // Guards model and the model list cache
 	apiKey        string
 	baseURL       string
 	model         string
 	httpClient    *http.Client
-	searchService *SearchService
+	streamClient  *http.Client
+	contextWindow int // Set by OPENAI_CONTEXT_WINDOW; 0 uses the known size of the model
+	policy        ResponsePolicy
+	models        []string
+	modelsFetched time.Time
 }
 
 // ChatGPTRequest represents a request to the ChatGPT API
 type ChatGPTRequest struct {
-	Model       string           `json:"model"`
-	Messages    []ChatGPTMessage `json:"messages"`
-	MaxTokens   int              `json:"max_tokens,omitempty"`
-	Temperature float64          `json:"temperature,omitempty"`
-	Stop        []string         `json:"stop,omitempty"`
+	Model          string                 `json:"model"`
+	Messages       []ChatGPTMessage       `json:"messages"`
+	MaxTokens      int                    `json:"max_tokens,omitempty"`
+	Temperature    *float64               `json:"temperature,omitempty"`
+	TopP           *float64               `json:"top_p,omitempty"`
+	Seed           *int                   `json:"seed,omitempty"`
+	ResponseFormat *ChatGPTResponseFormat `json:"response_format,omitempty"`
+	Stop           []string               `json:"stop,omitempty"`
+	Stream         bool                   `json:"stream,omitempty"`
+	Tools          []ChatGPTTool          `json:"tools,omitempty"`
+}
+
+// ChatGPTResponseFormat asks for a structured reply
+type ChatGPTResponseFormat struct {
+	Type string `json:"type"` // "json_object"
 }
 
 // ChatGPTMessage represents a message in the ChatGPT format
 type ChatGPTMessage struct {
-	Role    string `json:"role"` // "system", "user", or "assistant"
-	Content string `json:"content"`
+	Role       string            `json:"role"` // "system", "user", "assistant" or "tool"
+	Content    string            `json:"content"`
+	ToolCalls  []ChatGPTToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string            `json:"tool_call_id,omitempty"` // The call a tool message answers
+}
+
+// ChatGPTTool declares a function the model may call
+type ChatGPTTool struct {
+	Type     string   `json:"type"` // "function"
+	Function ToolSpec `json:"function"`
+}
+
+// ChatGPTToolCall is a function call made by the model
+type ChatGPTToolCall struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"` // "function"
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"` // JSON encoded as a string
+	} `json:"function"`
 }
 
 // ChatGPTResponse represents a response from the ChatGPT API
@@ -45,12 +82,9 @@ type ChatGPTResponse struct {
 	Created int64  `json:"created"`
 	Model   string `json:"model"`
 	Choices []struct {
-		Index   int `json:"index"`
-		Message struct {
-			Role    string `json:"role"`
-			Content string `json:"content"`
-		} `json:"message"`
-		FinishReason string `json:"finish_reason"`
+		Index        int            `json:"index"`
+		Message      ChatGPTMessage `json:"message"`
+		FinishReason string         `json:"finish_reason"`
 	} `json:"choices"`
 	Usage struct {
 		PromptTokens     int `json:"prompt_tokens"`
@@ -64,8 +98,32 @@ type ChatGPTResponse struct {
 	} `json:"error,omitempty"`
 }
 
+// ChatGPTStreamChunk represents one streamed delta from the ChatGPT API
+type ChatGPTStreamChunk struct {
+	ID      string `json:"id"`
+	Model   string `json:"model"`
+	Choices []struct {
+		Index int `json:"index"`
+		Delta struct {
+			Role    string `json:"role,omitempty"`
+			Content string `json:"content,omitempty"`
+		} `json:"delta"`
+		FinishReason *string `json:"finish_reason"`
+	} `json:"choices"`
+	Error *struct {
+		Message string `json:"message"`
+		Type    string `json:"type"`
+	} `json:"error,omitempty"`
+}
+
+// maxStopSequences is the number of stop sequences the chat completions API accepts
+const maxStopSequences = 4
+
+// modelListTTL is how long the model list from the API is reused
+const modelListTTL = 10 * time.Minute
+
 // NewChatGPTService creates a new ChatGPT service instance
-func NewChatGPTService(enableSearch bool) *ChatGPTService {
+func NewChatGPTService() *ChatGPTService {
 	apiKey := os.Getenv("OPENAI_API_KEY")
 	baseURL := os.Getenv("OPENAI_BASE_URL")
 	model := os.Getenv("OPENAI_MODEL")
@@ -77,11 +135,6 @@ func NewChatGPTService(enableSearch bool) *ChatGPTService {
 		model = "gpt-3.5-turbo" // Default to most cost-effective model
 	}
 
-	var searchService *SearchService
-	if enableSearch {
-		searchService = NewSearchService()
-	}
-
 	return &ChatGPTService{
 		apiKey:  apiKey,
 		baseURL: baseURL,
@@ -89,122 +142,224 @@ func NewChatGPTService(enableSearch bool) *ChatGPTService {
 		httpClient: &http.Client{
 			Timeout: 30 * time.Second,
 		},
-		searchService: searchService,
+		streamClient:  &http.Client{},
+		contextWindow: utils.GetEnvInt("OPENAI_CONTEXT_WINDOW", 0),
+		// ChatGPT replies are well-formed, so they are kept whole unless OPENAI_MAX_RESPONSE_CHARS is set
+		policy: ResponsePolicyFromEnv("OPENAI", ResponsePolicy{
+			MaxTokens:        150,
+			StopPatterns:     defaultStopPatterns,
+			PreserveMarkdown: true,
+		}),
 	}
 }
 
+// Name returns the provider name of the ChatGPT backend
+func (c *ChatGPTService) Name() LLMProvider {
+	return ProviderChatGPT
+}
+
 // GenerateResponse generates a response using ChatGPT
-func (c *ChatGPTService) GenerateResponse(message string, context []string, history []models.ChatMessage) (string, error) {
-	if c.apiKey == "" {
-		return "", fmt.Errorf("OpenAI API key not set")
-	}
-
-	// Check if we should search for current information
-	var searchContext []string
-	if c.searchService != nil && c.searchService.IsEnabled() && c.searchService.ShouldSearch(message) {
-		searchResults, err := c.searchService.SearchForContext(message, 3)
-		if err != nil {
-			log.Printf("Search failed: %v", err)
-		} else if len(searchResults) > 0 {
-			searchContext = searchResults
-			log.Printf("Added %d search results to context", len(searchResults))
-		}
+func (c *ChatGPTService) GenerateResponse(ctx context.Context, generate GenerateRequest) (string, error) {
+	message, err := c.complete(ctx, generate)
+	if err != nil {
+		return "", err
 	}
+	return strings.TrimSpace(message.Content), nil
+}
 
-	// Combine document context and search context
-	allContext := append(context, searchContext...)
-
-	// Build messages for ChatGPT format
-	messages := c.buildMessages(message, allContext, history)
-
-	// Create request
-	request := ChatGPTRequest{
-		Model:       c.model,
-		Messages:    messages,
-		MaxTokens:   150, // Keep responses concise like local LLM
-		Temperature: 0.7,
-		Stop:        []string{"\n\nHuman:", "\nHuman:", "User:"},
+// GenerateToolTurn sends one turn of the agent loop using OpenAI function calling
+func (c *ChatGPTService) GenerateToolTurn(ctx context.Context, generate GenerateRequest) (string, []ToolCall, error) {
+	message, err := c.complete(ctx, generate)
+	if err != nil {
+		return "", nil, err
 	}
 
-	// Convert to JSON
-	jsonData, err := json.Marshal(request)
-	if err != nil {
-		return "", fmt.Errorf("failed to marshal request: %w", err)
+	calls := make([]ToolCall, 0, len(message.ToolCalls))
+	for _, call := range message.ToolCalls {
+		calls = append(calls, ToolCall{
+			ID:        call.ID,
+			Name:      call.Function.Name,
+			Arguments: toolArguments([]byte(call.Function.Arguments)),
+		})
 	}
+	return strings.TrimSpace(message.Content), calls, nil
+}
 
-	// Create HTTP request
-	req, err := http.NewRequest("POST", c.baseURL+"/chat/completions", bytes.NewBuffer(jsonData))
+// complete sends a non-streaming request and returns the model's message
+func (c *ChatGPTService) complete(ctx context.Context, generate GenerateRequest) (ChatGPTMessage, error) {
+	req, err := c.buildRequest(generate, false)
 	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
+		return ChatGPTMessage{}, err
 	}
 
-	// Set headers
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+c.apiKey)
-
 	// Make request
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.httpClient.Do(req.WithContext(ctx))
 	if err != nil {
-		return "", fmt.Errorf("failed to make request to ChatGPT: %w", err)
+		return ChatGPTMessage{}, fmt.Errorf("failed to make request to ChatGPT: %w", err)
 	}
 	defer resp.Body.Close()
 
 	// Read response
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", fmt.Errorf("failed to read response: %w", err)
+		return ChatGPTMessage{}, fmt.Errorf("failed to read response: %w", err)
 	}
 
 	// Parse response
 	var chatGPTResp ChatGPTResponse
 	if err := json.Unmarshal(body, &chatGPTResp); err != nil {
-		return "", fmt.Errorf("failed to decode response: %w", err)
+		return ChatGPTMessage{}, fmt.Errorf("failed to decode response: %w", err)
 	}
 
 	// Check for API errors
 	if chatGPTResp.Error != nil {
-		return "", fmt.Errorf("ChatGPT API error: %s", chatGPTResp.Error.Message)
+		return ChatGPTMessage{}, fmt.Errorf("ChatGPT API error: %s", chatGPTResp.Error.Message)
 	}
 
 	// Check if we have choices
 	if len(chatGPTResp.Choices) == 0 {
-		return "", fmt.Errorf("no response choices from ChatGPT")
+		return ChatGPTMessage{}, fmt.Errorf("no response choices from ChatGPT")
+	}
+
+	return chatGPTResp.Choices[0].Message, nil
+}
+
+// StreamResponse generates a response using OpenAI's streamed deltas, calling onToken for each fragment
+func (c *ChatGPTService) StreamResponse(ctx context.Context, generate GenerateRequest, onToken func(token string) error) (string, error) {
+	req, err := c.buildRequest(generate, true)
+	if err != nil {
+		return "", err
+	}
+
+	// Streams are bounded by the request context rather than the client timeout
+	resp, err := c.streamClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", fmt.Errorf("failed to make request to ChatGPT: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return "", fmt.Errorf("ChatGPT API returned status %d: %s", resp.StatusCode, string(body))
+	}
+
+	// The body is a server-sent event stream of "data: {chunk}" lines ending with "data: [DONE]"
+	var full strings.Builder
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "[DONE]" {
+			break
+		}
+
+		var chunk ChatGPTStreamChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return full.String(), fmt.Errorf("failed to decode stream chunk: %w", err)
+		}
+
+		if chunk.Error != nil {
+			return full.String(), fmt.Errorf("ChatGPT API error: %s", chunk.Error.Message)
+		}
+
+		if len(chunk.Choices) == 0 || chunk.Choices[0].Delta.Content == "" {
+			continue
+		}
+
+		token := chunk.Choices[0].Delta.Content
+		full.WriteString(token)
+		if err := onToken(token); err != nil {
+			return full.String(), err
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return full.String(), fmt.Errorf("failed to read stream: %w", err)
+	}
+
+	return strings.TrimSpace(full.String()), nil
+}
+
+// buildRequest creates the HTTP request for the chat completions API
+func (c *ChatGPTService) buildRequest(generate GenerateRequest, stream bool) (*http.Request, error) {
+	if c.apiKey == "" {
+		return nil, fmt.Errorf("OpenAI API key not set")
+	}
+
+	// Build messages for ChatGPT format
+	messages := c.buildMessages(generate)
+
+	maxTokens, stop := generate.limits(c.policy)
+	if len(stop) > maxStopSequences {
+		stop = stop[:maxStopSequences]
 	}
 
-	response := chatGPTResp.Choices[0].Message.Content
+	model := c.GetModel()
+	if generate.Model != "" {
+		model = generate.Model
+	}
+	temperature := 0.7
+	if generate.Temperature != nil {
+		temperature = *generate.Temperature
+	}
+
+	// Create request
+	request := ChatGPTRequest{
+		Model:       model,
+		Messages:    messages,
+		MaxTokens:   maxTokens,
+		Temperature: &temperature,
+		TopP:        generate.TopP,
+		Seed:        generate.Seed,
+		Stop:        stop,
+		Stream:      stream,
+	}
+	if generate.Format == "json" {
+		request.ResponseFormat = &ChatGPTResponseFormat{Type: "json_object"}
+	}
+	for _, tool := range generate.Tools {
+		request.Tools = append(request.Tools, ChatGPTTool{Type: "function", Function: tool})
+	}
 
-	// Clean up the response
-	response = c.cleanResponse(response)
+	// Convert to JSON
+	jsonData, err := json.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
 
-	return response, nil
+	// Create HTTP request
+	req, err := http.NewRequest("POST", c.baseURL+"/chat/completions", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	// Set headers
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+c.apiKey)
+
+	return req, nil
 }
 
 // buildMessages constructs messages array for ChatGPT API
-func (c *ChatGPTService) buildMessages(message string, context []string, history []models.ChatMessage) []ChatGPTMessage {
+func (c *ChatGPTService) buildMessages(generate GenerateRequest) []ChatGPTMessage {
 	var messages []ChatGPTMessage
 
 	// System message with instructions
-	systemPrompt := "You are a helpful AI assistant. Provide concise, direct answers. " +
-		"Keep responses under 2-3 sentences unless more detail is specifically requested. " +
-		"Use provided context when relevant. Do not continue the conversation or ask follow-up questions."
+	systemPrompt := generate.systemPrompt()
 
 	// Add context to system message if available
-	if len(context) > 0 {
+	if len(generate.Context) > 0 {
 		systemPrompt += "\n\nContext:\n"
-		for _, ctx := range context {
+		for _, ctx := range generate.Context {
 			systemPrompt += "- " + ctx + "\n"
 		}
 
 		// If search results are included, mention they're current
-		hasSearchResults := false
-		for _, ctx := range context {
-			if strings.Contains(ctx, "[Search Result") {
-				hasSearchResults = true
-				break
-			}
-		}
-
-		if hasSearchResults {
+		if hasWebContext(generate.Context) {
 			systemPrompt += "\nNote: Some context includes current web search results for up-to-date information."
 		}
 	}
@@ -214,14 +369,8 @@ func (c *ChatGPTService) buildMessages(message string, context []string, history
 		Content: systemPrompt,
 	})
 
-	// Add conversation history (limit to last 6 messages)
-	start := 0
-	if len(history) > 6 {
-		start = len(history) - 6
-	}
-
-	for i := start; i < len(history); i++ {
-		msg := history[i]
+	// Add conversation history; the prompt builder has already fitted it to the context window
+	for _, msg := range generate.History {
 		role := msg.Role
 		if role == "assistant" {
 			role = "assistant"
@@ -238,17 +387,106 @@ func (c *ChatGPTService) buildMessages(message string, context []string, history
 	// Add current user message
 	messages = append(messages, ChatGPTMessage{
 		Role:    "user",
-		Content: message,
+		Content: generate.Message,
 	})
 
+	// Replay the tool calls made so far, each followed by its results
+	for _, step := range generate.Steps {
+		assistant := ChatGPTMessage{Role: "assistant", Content: step.Content}
+		for _, call := range step.Calls {
+			toolCall := ChatGPTToolCall{ID: call.ID, Type: "function"}
+			toolCall.Function.Name = call.Name
+			toolCall.Function.Arguments = string(call.Arguments)
+			assistant.ToolCalls = append(assistant.ToolCalls, toolCall)
+		}
+		messages = append(messages, assistant)
+
+		for _, result := range step.Results {
+			messages = append(messages, ChatGPTMessage{
+				Role:       "tool",
+				Content:    result.Content,
+				ToolCallID: result.CallID,
+			})
+		}
+	}
+
 	return messages
 }
 
-// cleanResponse removes unwanted patterns from ChatGPT responses
-func (c *ChatGPTService) cleanResponse(response string) string {
-	// ChatGPT usually returns clean responses, but apply basic cleanup
-	response = cleanLLMResponse(response)
-	return response
+// ValidateOptions checks generation options against the chat completions API's ranges
+func (c *ChatGPTService) ValidateOptions(options models.GenerationOptions) error {
+	limits := OptionLimits{
+		MaxTemperature:   2,
+		MaxTokens:        c.ContextWindow(),
+		MaxStopSequences: maxStopSequences,
+	}
+	if err := limits.Validate(options); err != nil {
+		return err
+	}
+
+	if options.Model == "" {
+		return nil
+	}
+	available, err := c.GetAvailableModels()
+	if err != nil {
+		// Let the API report the problem if the model list can't be checked
+		return nil
+	}
+	if findModel(available, options.Model) == "" {
+		return fmt.Errorf("%w: model %s is not available", ErrInvalidOptions, options.Model)
+	}
+	return nil
+}
+
+// GetAvailableModels returns the models the API key can use. The list is cached for modelListTTL.
+func (c *ChatGPTService) GetAvailableModels() ([]string, error) {
+	c.mu.RLock()
+	cached, fetched := c.models, c.modelsFetched
+	c.mu.RUnlock()
+	if cached != nil && time.Since(fetched) < modelListTTL {
+		return cached, nil
+	}
+
+	if c.apiKey == "" {
+		return nil, fmt.Errorf("OpenAI API key not set")
+	}
+
+	req, err := http.NewRequest("GET", c.baseURL+"/models", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+c.apiKey)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get models: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("API returned status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	available := make([]string, 0, len(result.Data))
+	for _, model := range result.Data {
+		available = append(available, model.ID)
+	}
+	sort.Strings(available)
+
+	c.mu.Lock()
+	c.models, c.modelsFetched = available, time.Now()
+	c.mu.Unlock()
+
+	return available, nil
 }
 
 // IsAvailable checks if the ChatGPT service is available
@@ -256,13 +494,36 @@ func (c *ChatGPTService) IsAvailable() bool {
 	return c.apiKey != ""
 }
 
+// ContextWindow returns the context window of the current model
+func (c *ChatGPTService) ContextWindow() int {
+	if c.contextWindow > 0 {
+		return c.contextWindow
+	}
+	return ModelContextWindow(c.GetModel())
+}
+
+// EstimateTokens counts tokens with the shared heuristic, which is close to OpenAI's BPE
+// tokenizers for English text
+func (c *ChatGPTService) EstimateTokens(text string) int {
+	return EstimateTokens(text)
+}
+
+// ResponsePolicy returns the default reply limits and cleanup for ChatGPT
+func (c *ChatGPTService) ResponsePolicy() ResponsePolicy {
+	return c.policy
+}
+
 // GetModel returns the current model
 func (c *ChatGPTService) GetModel() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 	return c.model
 }
 
-// SetModel changes the current model
+// SetModel changes the current model; requests already sent keep their model
 func (c *ChatGPTService) SetModel(model string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	c.model = model
 }
 
@@ -270,7 +531,7 @@ func (c *ChatGPTService) SetModel(model string) {
 func (c *ChatGPTService) GetStatus() map[string]interface{} {
 	status := map[string]interface{}{
 		"base_url": c.baseURL,
-		"model":    c.model,
+		"model":    c.GetModel(),
 		"timeout":  c.httpClient.Timeout.String(),
 	}
 
@@ -287,17 +548,5 @@ func (c *ChatGPTService) GetStatus() map[string]interface{} {
 		status["error"] = "OPENAI_API_KEY not set"
 	}
 
-	// Add search capability status
-	if c.searchService != nil {
-		status["search"] = c.searchService.GetStatus()
-		status["search_enabled"] = c.searchService.IsEnabled()
-	} else {
-		status["search"] = map[string]interface{}{
-			"status": "disabled",
-			"note":   "Search not enabled for this instance",
-		}
-		status["search_enabled"] = false
-	}
-
 	return status
 }
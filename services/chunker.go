@@ -0,0 +1,380 @@
+package services
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Chunking strategies
+const (
+	ChunkerAuto      = "auto" // Markdown for .md files, recursive for everything else
+	ChunkerRecursive = "recursive"
+	ChunkerMarkdown  = "markdown"
+	ChunkerCode      = "code"
+)
+
+// Chunk is a piece of a document sized for embedding
+type Chunk struct {
+	Text        string
+	HeadingPath []string // Enclosing headings, outermost first
+}
+
+// Chunker splits document text into chunks of a bounded token size
+type Chunker interface {
+	// Name identifies the strategy in metadata and status output
+	Name() string
+	// Chunk splits text into chunks in document order
+	Chunk(text string) []Chunk
+}
+
+// NewChunker creates the chunker for a strategy with sizes in estimated tokens
+func NewChunker(strategy string, size int, overlap int) (Chunker, error) {
+	if size <= 0 {
+		return nil, fmt.Errorf("chunk size must be positive, got %d", size)
+	}
+	if overlap < 0 || overlap >= size {
+		return nil, fmt.Errorf("chunk overlap must be between 0 and the chunk size, got %d", overlap)
+	}
+
+	switch strategy {
+	case ChunkerRecursive:
+		return NewRecursiveChunker(size, overlap), nil
+	case ChunkerMarkdown:
+		return NewMarkdownChunker(size, overlap), nil
+	case ChunkerCode:
+		return NewCodeBlockChunker(size, overlap), nil
+	default:
+		return nil, fmt.Errorf("unknown chunker: %s", strategy)
+	}
+}
+
+// chunkPiece is a unit of text that chunks are assembled from
+type chunkPiece struct {
+	text   string
+	atomic bool // Code blocks must not be cut for overlap
+}
+
+// recursiveSeparators are tried in order, from paragraph breaks down to single spaces
+var recursiveSeparators = []string{"\n\n", "\n", ". ", "? ", "! ", "; ", ", ", " "}
+
+// RecursiveChunker splits on the coarsest separator that yields small enough pieces
+// and packs the pieces into chunks, keeping separators and punctuation intact
+type RecursiveChunker struct {
+	size    int
+	overlap int
+}
+
+// NewRecursiveChunker creates a recursive character chunker
+func NewRecursiveChunker(size int, overlap int) *RecursiveChunker {
+	return &RecursiveChunker{size: size, overlap: overlap}
+}
+
+// Name returns the strategy name
+func (c *RecursiveChunker) Name() string {
+	return ChunkerRecursive
+}
+
+// Chunk splits text into overlapping chunks
+func (c *RecursiveChunker) Chunk(text string) []Chunk {
+	return toChunks(mergePieces(splitRecursive(text, recursiveSeparators, c.size), c.size, c.overlap), nil)
+}
+
+// splitRecursive breaks text into pieces of at most size tokens. Separators stay attached
+// to the end of the preceding piece so joining the pieces gives back the original text.
+func splitRecursive(text string, separators []string, size int) []chunkPiece {
+	if EstimateTokens(text) <= size {
+		return []chunkPiece{{text: text}}
+	}
+	if len(separators) == 0 {
+		return splitByRunes(text, size)
+	}
+
+	parts := strings.SplitAfter(text, separators[0])
+	if len(parts) == 1 {
+		return splitRecursive(text, separators[1:], size)
+	}
+
+	var pieces []chunkPiece
+	for _, part := range parts {
+		if part == "" {
+			continue
+		}
+		if EstimateTokens(part) > size {
+			pieces = append(pieces, splitRecursive(part, separators[1:], size)...)
+		} else {
+			pieces = append(pieces, chunkPiece{text: part})
+		}
+	}
+	return pieces
+}
+
+// splitByRunes cuts text without separators, such as a long URL, into pieces that fit
+func splitByRunes(text string, size int) []chunkPiece {
+	var pieces []chunkPiece
+	runes := []rune(text)
+	step := size * 4 // Upper bound of characters per token used by EstimateTokens
+
+	for start := 0; start < len(runes); start += step {
+		end := start + step
+		if end > len(runes) {
+			end = len(runes)
+		}
+		pieces = append(pieces, chunkPiece{text: string(runes[start:end])})
+	}
+	return pieces
+}
+
+// mergePieces packs pieces into chunks of at most size tokens. Each new chunk starts with
+// the last overlap tokens of the previous one unless that chunk ended in an atomic piece.
+func mergePieces(pieces []chunkPiece, size int, overlap int) []string {
+	var chunks []string
+	var current strings.Builder
+	currentTokens := 0
+	lastAtomic := false
+
+	flush := func() {
+		if text := strings.TrimSpace(current.String()); text != "" {
+			chunks = append(chunks, text)
+		}
+	}
+
+	for _, piece := range pieces {
+		tokens := EstimateTokens(piece.text)
+
+		if currentTokens+tokens > size && currentTokens > 0 {
+			previous := current.String()
+			flush()
+			current.Reset()
+			currentTokens = 0
+
+			if overlap > 0 && !lastAtomic {
+				tail := overlapTail(previous, overlap)
+				if tailTokens := EstimateTokens(tail); tail != "" && tailTokens+tokens <= size {
+					current.WriteString(tail)
+					currentTokens = tailTokens
+				}
+			}
+		}
+
+		current.WriteString(piece.text)
+		currentTokens += tokens
+		lastAtomic = piece.atomic
+	}
+	flush()
+
+	return chunks
+}
+
+// overlapTail returns the end of text containing at most maxTokens tokens, starting at a word
+func overlapTail(text string, maxTokens int) string {
+	text = strings.TrimRightFunc(text, unicode.IsSpace)
+	words := strings.Fields(text)
+
+	start := len(words)
+	for start > 0 && EstimateTokens(strings.Join(words[start-1:], " ")) <= maxTokens {
+		start--
+	}
+	if start == len(words) {
+		return ""
+	}
+
+	// Cut the original text so line breaks inside the tail are preserved
+	cut := len(text)
+	for i := len(words) - 1; i >= start; i-- {
+		cut = strings.LastIndex(text[:cut], words[i])
+	}
+	return text[cut:] + " "
+}
+
+// toChunks wraps chunk texts with a heading path
+func toChunks(texts []string, headingPath []string) []Chunk {
+	chunks := make([]Chunk, 0, len(texts))
+	for _, text := range texts {
+		chunks = append(chunks, Chunk{Text: text, HeadingPath: headingPath})
+	}
+	return chunks
+}
+
+// fencePattern matches the opening or closing line of a fenced code block
+var fencePattern = regexp.MustCompile("^\\s{0,3}(```+|~~~+)")
+
+// CodeBlockChunker keeps fenced code blocks whole, splitting oversized blocks on line
+// boundaries and repeating the fence on each part. Prose is split recursively.
+type CodeBlockChunker struct {
+	size    int
+	overlap int
+}
+
+// NewCodeBlockChunker creates a chunker that respects fenced code blocks
+func NewCodeBlockChunker(size int, overlap int) *CodeBlockChunker {
+	return &CodeBlockChunker{size: size, overlap: overlap}
+}
+
+// Name returns the strategy name
+func (c *CodeBlockChunker) Name() string {
+	return ChunkerCode
+}
+
+// Chunk splits text into chunks without cutting through code blocks
+func (c *CodeBlockChunker) Chunk(text string) []Chunk {
+	return toChunks(mergePieces(c.pieces(text), c.size, c.overlap), nil)
+}
+
+// pieces separates prose from code blocks
+func (c *CodeBlockChunker) pieces(text string) []chunkPiece {
+	var pieces []chunkPiece
+	var prose, code strings.Builder
+	fence := ""
+
+	for _, line := range strings.SplitAfter(text, "\n") {
+		match := fencePattern.FindStringSubmatch(line)
+
+		if fence == "" {
+			if match != nil {
+				pieces = append(pieces, splitRecursive(prose.String(), recursiveSeparators, c.size)...)
+				prose.Reset()
+				fence = match[1]
+				code.WriteString(line)
+				continue
+			}
+			prose.WriteString(line)
+			continue
+		}
+
+		code.WriteString(line)
+		if match != nil && strings.HasPrefix(match[1], fence[:1]) && len(match[1]) >= len(fence) {
+			pieces = append(pieces, c.splitCodeBlock(code.String())...)
+			code.Reset()
+			fence = ""
+		}
+	}
+
+	// An unclosed fence runs to the end of the document
+	if code.Len() > 0 {
+		pieces = append(pieces, c.splitCodeBlock(code.String())...)
+	}
+	if prose.Len() > 0 {
+		pieces = append(pieces, splitRecursive(prose.String(), recursiveSeparators, c.size)...)
+	}
+
+	var nonEmpty []chunkPiece
+	for _, piece := range pieces {
+		if piece.text != "" {
+			nonEmpty = append(nonEmpty, piece)
+		}
+	}
+	return nonEmpty
+}
+
+// splitCodeBlock returns a code block as one atomic piece, or as several fenced parts
+// split between lines when it is larger than the chunk size
+func (c *CodeBlockChunker) splitCodeBlock(block string) []chunkPiece {
+	if EstimateTokens(block) <= c.size {
+		return []chunkPiece{{text: block, atomic: true}}
+	}
+
+	lines := strings.SplitAfter(strings.TrimRight(block, "\n"), "\n")
+	opening := strings.TrimRight(lines[0], "\n")
+	closing := strings.TrimSpace(fencePattern.FindString(opening))
+	body := lines[1:]
+	if len(body) > 0 && fencePattern.MatchString(body[len(body)-1]) {
+		body = body[:len(body)-1]
+	}
+
+	fenceTokens := EstimateTokens(opening) + EstimateTokens(closing)
+	var pieces []chunkPiece
+	var part strings.Builder
+	partTokens := 0
+
+	flush := func() {
+		if part.Len() == 0 {
+			return
+		}
+		text := opening + "\n" + strings.TrimRight(part.String(), "\n") + "\n" + closing + "\n"
+		pieces = append(pieces, chunkPiece{text: text, atomic: true})
+		part.Reset()
+		partTokens = 0
+	}
+
+	for _, line := range body {
+		tokens := EstimateTokens(line)
+		if partTokens+tokens+fenceTokens > c.size && partTokens > 0 {
+			flush()
+		}
+		part.WriteString(line)
+		partTokens += tokens
+	}
+	flush()
+
+	return pieces
+}
+
+// headingPattern matches an ATX markdown heading
+var headingPattern = regexp.MustCompile(`^\s{0,3}(#{1,6})\s+(.*?)\s*#*\s*$`)
+
+// MarkdownChunker splits markdown at headings so chunks never span sections, and records
+// the heading path of each chunk. Code blocks are kept whole inside each section.
+type MarkdownChunker struct {
+	size    int
+	overlap int
+	code    *CodeBlockChunker
+}
+
+// NewMarkdownChunker creates a heading-aware markdown chunker
+func NewMarkdownChunker(size int, overlap int) *MarkdownChunker {
+	return &MarkdownChunker{
+		size:    size,
+		overlap: overlap,
+		code:    NewCodeBlockChunker(size, overlap),
+	}
+}
+
+// Name returns the strategy name
+func (c *MarkdownChunker) Name() string {
+	return ChunkerMarkdown
+}
+
+// Chunk splits the document into sections at headings and chunks each section
+func (c *MarkdownChunker) Chunk(text string) []Chunk {
+	var chunks []Chunk
+	var section strings.Builder
+	var path []string
+	var levels []int
+	fence := ""
+
+	flush := func() {
+		sectionPath := append([]string(nil), path...)
+		chunks = append(chunks, toChunks(mergePieces(c.code.pieces(section.String()), c.size, c.overlap), sectionPath)...)
+		section.Reset()
+	}
+
+	for _, line := range strings.SplitAfter(text, "\n") {
+		// Lines inside code blocks are never headings
+		if match := fencePattern.FindStringSubmatch(line); match != nil {
+			if fence == "" {
+				fence = match[1]
+			} else if strings.HasPrefix(match[1], fence[:1]) && len(match[1]) >= len(fence) {
+				fence = ""
+			}
+		} else if fence == "" {
+			if match := headingPattern.FindStringSubmatch(line); match != nil {
+				flush()
+
+				level := len(match[1])
+				for len(levels) > 0 && levels[len(levels)-1] >= level {
+					levels = levels[:len(levels)-1]
+					path = path[:len(path)-1]
+				}
+				levels = append(levels, level)
+				path = append(path, match[2])
+			}
+		}
+
+		section.WriteString(line)
+	}
+	flush()
+
+	return chunks
+}
@@ -0,0 +1,135 @@
+package services
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNewChunkerValidatesSizes(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy string
+		size     int
+		overlap  int
+	}{
+		{"zero size", ChunkerRecursive, 0, 0},
+		{"negative overlap", ChunkerRecursive, 100, -1},
+		{"overlap equal to size", ChunkerRecursive, 100, 100},
+		{"unknown strategy", "sentences", 100, 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewChunker(tt.strategy, tt.size, tt.overlap); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
+
+func TestRecursiveChunkerRespectsSize(t *testing.T) {
+	text := strings.Repeat("The quick brown fox jumps over the lazy dog. ", 40)
+	chunks := NewRecursiveChunker(30, 0).Chunk(text)
+
+	if len(chunks) < 2 {
+		t.Fatalf("expected several chunks, got %d", len(chunks))
+	}
+	for i, chunk := range chunks {
+		if tokens := EstimateTokens(chunk.Text); tokens > 30 {
+			t.Errorf("chunk %d has %d tokens, want at most 30", i, tokens)
+		}
+		if !strings.HasSuffix(chunk.Text, ".") {
+			t.Errorf("chunk %d should end at a sentence boundary: %q", i, chunk.Text)
+		}
+	}
+}
+
+func TestRecursiveChunkerOverlap(t *testing.T) {
+	text := "alpha beta gamma delta. epsilon zeta eta theta. iota kappa lambda mu."
+	chunks := NewRecursiveChunker(12, 4).Chunk(text)
+
+	var texts []string
+	for _, chunk := range chunks {
+		texts = append(texts, chunk.Text)
+	}
+	want := []string{
+		"alpha beta gamma delta.",
+		"delta. epsilon zeta eta theta.",
+		"eta theta. iota kappa lambda mu.",
+	}
+	if !reflect.DeepEqual(texts, want) {
+		t.Errorf("chunks = %q, want %q", texts, want)
+	}
+}
+
+func TestSplitByRunesCutsLongWords(t *testing.T) {
+	url := "https://example.com/" + strings.Repeat("a", 200)
+	chunks := NewRecursiveChunker(10, 0).Chunk(url)
+
+	if len(chunks) < 2 {
+		t.Fatalf("expected the URL to be cut, got %d chunks", len(chunks))
+	}
+	var joined strings.Builder
+	for _, chunk := range chunks {
+		joined.WriteString(chunk.Text)
+	}
+	if joined.String() != url {
+		t.Error("cutting a long word should not lose characters")
+	}
+}
+
+func TestCodeBlockChunkerKeepsBlocksWhole(t *testing.T) {
+	code := "```go\nfunc main() {\n\tfmt.Println(\"hello\")\n}\n```\n"
+	text := strings.Repeat("Some introduction text. ", 10) + "\n\n" + code + "\nAfterwards."
+	chunks := NewCodeBlockChunker(40, 5).Chunk(text)
+
+	found := false
+	for _, chunk := range chunks {
+		if strings.Contains(chunk.Text, "```go") {
+			found = true
+			if !strings.Contains(chunk.Text, "fmt.Println") || strings.Count(chunk.Text, "```") != 2 {
+				t.Errorf("code block was split: %q", chunk.Text)
+			}
+		}
+	}
+	if !found {
+		t.Fatal("code block missing from chunks")
+	}
+}
+
+func TestCodeBlockChunkerSplitsOversizedBlocks(t *testing.T) {
+	var body strings.Builder
+	for i := 0; i < 40; i++ {
+		body.WriteString("x := compute(value, other)\n")
+	}
+	chunks := NewCodeBlockChunker(30, 0).Chunk("```go\n" + body.String() + "```\n")
+
+	if len(chunks) < 2 {
+		t.Fatalf("expected the block to be split, got %d chunks", len(chunks))
+	}
+	for i, chunk := range chunks {
+		if !strings.HasPrefix(chunk.Text, "```go\n") || !strings.HasSuffix(chunk.Text, "\n```") {
+			t.Errorf("part %d should be fenced: %q", i, chunk.Text)
+		}
+	}
+}
+
+func TestMarkdownChunkerHeadingPaths(t *testing.T) {
+	text := "# Guide\nIntro.\n## Install\nRun the installer.\n```sh\n# not a heading\n```\n### Linux\nUse apt.\n## Usage\nStart it.\n"
+	chunks := NewMarkdownChunker(200, 0).Chunk(text)
+
+	var paths [][]string
+	for _, chunk := range chunks {
+		paths = append(paths, chunk.HeadingPath)
+	}
+	want := [][]string{
+		{"Guide"},
+		{"Guide", "Install"},
+		{"Guide", "Install", "Linux"},
+		{"Guide", "Usage"},
+	}
+	if !reflect.DeepEqual(paths, want) {
+		t.Errorf("heading paths = %v, want %v", paths, want)
+	}
+}
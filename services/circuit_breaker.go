@@ -0,0 +1,142 @@
+package services
+
+import (
+	"sync"
+	"time"
+)
+
+// CircuitState represents the state of a provider circuit breaker
+type CircuitState string
+
+const (
+	CircuitClosed   CircuitState = "closed"
+	CircuitOpen     CircuitState = "open"
+	CircuitHalfOpen CircuitState = "half_open"
+)
+
+// CircuitBreaker stops calling a provider after repeated failures and lets a
+// single trial request through once the cooldown has passed
+type CircuitBreaker struct {
+	mu               sync.Mutex
+	failureThreshold int
+	cooldown         time.Duration
+	state            CircuitState
+	failures         int
+	openedAt         time.Time
+	lastError        string
+	lastFailure      time.Time
+	trialInFlight    bool
+}
+
+// NewCircuitBreaker creates a closed circuit breaker
+func NewCircuitBreaker(failureThreshold int, cooldown time.Duration) *CircuitBreaker {
+	if failureThreshold <= 0 {
+		failureThreshold = 1
+	}
+
+	return &CircuitBreaker{
+		failureThreshold: failureThreshold,
+		cooldown:         cooldown,
+		state:            CircuitClosed,
+	}
+}
+
+// Allow reports whether a request may be sent to the provider
+func (b *CircuitBreaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case CircuitOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return false
+		}
+		// Cooldown elapsed: let one trial request through
+		b.state = CircuitHalfOpen
+		b.trialInFlight = true
+		return true
+	case CircuitHalfOpen:
+		if b.trialInFlight {
+			return false
+		}
+		b.trialInFlight = true
+		return true
+	default:
+		return true
+	}
+}
+
+// RecordSuccess closes the circuit and clears the failure count
+func (b *CircuitBreaker) RecordSuccess() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.state = CircuitClosed
+	b.failures = 0
+	b.trialInFlight = false
+}
+
+// RecordFailure counts a failure and opens the circuit when the threshold is reached
+// or when the half-open trial request fails
+func (b *CircuitBreaker) RecordFailure(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	b.lastFailure = time.Now()
+	if err != nil {
+		b.lastError = err.Error()
+	}
+
+	if b.state == CircuitHalfOpen || b.failures >= b.failureThreshold {
+		b.state = CircuitOpen
+		b.openedAt = time.Now()
+		b.trialInFlight = false
+	}
+}
+
+// Release ends a half-open trial without recording an outcome, for requests that were
+// cancelled or turned out not to be a test of the provider
+func (b *CircuitBreaker) Release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.trialInFlight = false
+}
+
+// State returns the current circuit state
+func (b *CircuitBreaker) State() CircuitState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == CircuitOpen && time.Since(b.openedAt) >= b.cooldown {
+		return CircuitHalfOpen
+	}
+	return b.state
+}
+
+// GetStatus returns the circuit breaker details for the health endpoint
+func (b *CircuitBreaker) GetStatus() map[string]interface{} {
+	state := b.State()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	status := map[string]interface{}{
+		"state":             string(state),
+		"failures":          b.failures,
+		"failure_threshold": b.failureThreshold,
+		"cooldown":          b.cooldown.String(),
+	}
+
+	if b.lastError != "" {
+		status["last_error"] = b.lastError
+		status["last_failure"] = b.lastFailure
+	}
+
+	if state == CircuitOpen {
+		status["retry_in"] = (b.cooldown - time.Since(b.openedAt)).Round(time.Second).String()
+	}
+
+	return status
+}
@@ -0,0 +1,101 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerOpensAtThreshold(t *testing.T) {
+	breaker := NewCircuitBreaker(2, time.Hour)
+
+	breaker.RecordFailure(errors.New("first"))
+	if !breaker.Allow() || breaker.State() != CircuitClosed {
+		t.Fatalf("circuit should stay closed below the threshold, got %s", breaker.State())
+	}
+
+	breaker.RecordFailure(errors.New("second"))
+	if breaker.State() != CircuitOpen {
+		t.Fatalf("expected open circuit, got %s", breaker.State())
+	}
+	if breaker.Allow() {
+		t.Fatal("open circuit should reject requests during the cooldown")
+	}
+}
+
+func TestCircuitBreakerSuccessResetsFailures(t *testing.T) {
+	breaker := NewCircuitBreaker(2, time.Hour)
+
+	breaker.RecordFailure(errors.New("first"))
+	breaker.RecordSuccess()
+	breaker.RecordFailure(errors.New("second"))
+
+	if breaker.State() != CircuitClosed {
+		t.Fatalf("a success should reset the failure count, got %s", breaker.State())
+	}
+}
+
+func TestCircuitBreakerHalfOpenAllowsOneTrial(t *testing.T) {
+	breaker := NewCircuitBreaker(1, 0)
+	breaker.RecordFailure(errors.New("down"))
+
+	if !breaker.Allow() {
+		t.Fatal("expected a trial request once the cooldown has passed")
+	}
+	if breaker.State() != CircuitHalfOpen {
+		t.Fatalf("expected half-open circuit, got %s", breaker.State())
+	}
+	if breaker.Allow() {
+		t.Fatal("only one trial request should be let through")
+	}
+}
+
+func TestCircuitBreakerTrialOutcome(t *testing.T) {
+	breaker := NewCircuitBreaker(3, 0)
+	for i := 0; i < 3; i++ {
+		breaker.RecordFailure(errors.New("down"))
+	}
+
+	breaker.Allow()
+	breaker.RecordFailure(errors.New("still down"))
+	if breaker.failures != 4 || breaker.state != CircuitOpen {
+		t.Fatalf("a failed trial should reopen the circuit, got %s", breaker.state)
+	}
+
+	breaker.Allow()
+	breaker.RecordSuccess()
+	if breaker.State() != CircuitClosed || !breaker.Allow() {
+		t.Fatalf("a successful trial should close the circuit, got %s", breaker.State())
+	}
+}
+
+func TestCircuitBreakerStatus(t *testing.T) {
+	breaker := NewCircuitBreaker(1, time.Hour)
+	breaker.RecordFailure(errors.New("connection refused"))
+
+	status := breaker.GetStatus()
+	if status["state"] != string(CircuitOpen) {
+		t.Errorf("state = %v, want %s", status["state"], CircuitOpen)
+	}
+	if status["last_error"] != "connection refused" {
+		t.Errorf("last_error = %v", status["last_error"])
+	}
+	if _, ok := status["retry_in"]; !ok {
+		t.Error("open circuit status should include retry_in")
+	}
+}
+
+func TestCircuitBreakerReleaseEndsTrial(t *testing.T) {
+	breaker := NewCircuitBreaker(1, 0)
+	breaker.RecordFailure(errors.New("down"))
+
+	breaker.Allow()
+	breaker.Release()
+
+	if breaker.State() != CircuitHalfOpen {
+		t.Fatalf("releasing a trial should not change the state, got %s", breaker.State())
+	}
+	if !breaker.Allow() {
+		t.Fatal("a released trial should let the next request through")
+	}
+}
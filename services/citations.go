@@ -0,0 +1,108 @@
+package services
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"chatbot/models"
+)
+
+// webContextLabel marks context blocks that come from web search
+const webContextLabel = "Web: "
+
+// citationMarkerPattern matches markers such as [1] or [1, 3] in a response
+var citationMarkerPattern = regexp.MustCompile(`\[(\d+(?:\s*,\s*\d+)*)\]`)
+
+// documentCitation describes a retrieved chunk as the citation with the given number
+func documentCitation(number int, doc models.RAGDocument) models.Citation {
+	citation := models.Citation{
+		Number: number,
+		Type:   models.CitationDocument,
+		File:   metadataString(doc.Metadata, "relative_path"),
+		Score:  doc.Score,
+	}
+	if citation.File == "" {
+		citation.File = filepath.Base(doc.Source)
+	}
+	if index, err := strconv.Atoi(metadataString(doc.Metadata, "chunk_index")); err == nil {
+		citation.ChunkIndex = &index
+	}
+	if page, err := strconv.Atoi(metadataString(doc.Metadata, "page")); err == nil {
+		citation.Page = page
+	}
+	citation.Title = metadataString(doc.Metadata, "heading_path")
+	if citation.Title == "" {
+		citation.Title = metadataString(doc.Metadata, "section_title")
+	}
+	return citation
+}
+
+// webCitation describes a web search result as the citation with the given number
+func webCitation(number int, result SearchResult) models.Citation {
+	return models.Citation{
+		Number: number,
+		Type:   models.CitationWeb,
+		Title:  result.Title,
+		URL:    result.URL,
+	}
+}
+
+// formatCitedContext renders a context block with the number the model should cite it by
+func formatCitedContext(citation models.Citation, content string) string {
+	switch citation.Type {
+	case models.CitationWeb:
+		return fmt.Sprintf("[%d] %s%s (%s): %s", citation.Number, webContextLabel, citation.Title, citation.URL, content)
+	default:
+		label := citation.File
+		if citation.Page > 0 {
+			label += fmt.Sprintf(", page %d", citation.Page)
+		}
+		if citation.Title != "" {
+			label += ", " + citation.Title
+		}
+		return fmt.Sprintf("[%d] %s: %s", citation.Number, label, content)
+	}
+}
+
+// hasWebContext reports whether any context block came from web search
+func hasWebContext(context []string) bool {
+	for _, ctx := range context {
+		if strings.Contains(ctx, "] "+webContextLabel) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveCitations marks the citations whose numbers appear as markers in the response.
+// Markers that don't match a context block are ignored.
+func resolveCitations(response string, citations []models.Citation) []models.Citation {
+	if len(citations) == 0 {
+		return nil
+	}
+
+	cited := make(map[int]bool)
+	for _, match := range citationMarkerPattern.FindAllStringSubmatch(response, -1) {
+		for _, number := range strings.Split(match[1], ",") {
+			if n, err := strconv.Atoi(strings.TrimSpace(number)); err == nil {
+				cited[n] = true
+			}
+		}
+	}
+
+	resolved := make([]models.Citation, len(citations))
+	for i, citation := range citations {
+		citation.Cited = cited[citation.Number]
+		resolved[i] = citation
+	}
+	return resolved
+}
+
+// metadataString returns a metadata value as a string, or "" if it is missing
+func metadataString(metadata map[string]interface{}, key string) string {
+	value, _ := metadata[key].(string)
+	return value
+}
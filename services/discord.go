@@ -12,6 +12,10 @@ import (
 	"github.com/bwmarrin/discordgo"
 )
 
+// DiscordSessionPrefix starts the IDs of Discord sessions, which are built from the user and
+// channel IDs. The HTTP API refuses IDs with this prefix so they can't be guessed from there.
+const DiscordSessionPrefix = "discord_"
+
 // DiscordService handles Discord bot interactions
 type DiscordService struct {
 	session       *discordgo.Session
@@ -19,6 +23,7 @@ type DiscordService struct {
 	commandPrefix string
 	enabled       bool
 	startTime     time.Time
+	personas      map[string]string // Channel ID -> persona name
 }
 
 // NewDiscordService creates a new Discord service instance
@@ -35,6 +40,13 @@ func NewDiscordService(chatbot *Chatbot) *DiscordService {
 		commandPrefix: commandPrefix,
 		enabled:       false,
 		startTime:     time.Now(),
+		personas:      ParseChannelPersonas("DISCORD_CHANNEL_PERSONAS"),
+	}
+
+	for channel, persona := range service.personas {
+		if !chatbot.HasPersona(persona) {
+			log.Printf("Warning: persona %q for Discord channel %s not found, using the default", persona, channel)
+		}
 	}
 
 	if token == "" {
@@ -133,10 +145,14 @@ func (d *DiscordService) messageCreate(s *discordgo.Session, m *discordgo.Messag
 	}
 
 	// Create session ID based on user and channel
-	sessionID := fmt.Sprintf("discord_%s_%s", m.Author.ID, m.ChannelID)
+	sessionID := fmt.Sprintf("%s%s_%s", DiscordSessionPrefix, m.Author.ID, m.ChannelID)
 
 	// Process message through chatbot service with message history context
-	response := d.chatbot.ProcessMessage(chatMessage, sessionID, messageHistory)
+	response := d.chatbot.ProcessMessage(chatMessage, sessionID, messageHistory, ChatParams{
+		Persona: d.personas[m.ChannelID],
+		User:    m.Author.Username,
+		Channel: d.channelName(s, m.ChannelID),
+	})
 
 	// Send response back to Discord
 	d.sendMessage(s, m.ChannelID, response.Message)
@@ -146,6 +162,14 @@ func (d *DiscordService) messageCreate(s *discordgo.Session, m *discordgo.Messag
 		m.Author.Username, m.Author.ID, m.ChannelID, chatMessage)
 }
 
+// channelName returns the name of a channel, or its ID if the name isn't cached
+func (d *DiscordService) channelName(s *discordgo.Session, channelID string) string {
+	if channel, err := s.State.Channel(channelID); err == nil && channel.Name != "" {
+		return channel.Name
+	}
+	return channelID
+}
+
 // getRecentChannelMessages fetches recent messages from a Discord channel
 func (d *DiscordService) getRecentChannelMessages(s *discordgo.Session, channelID string, limit int) ([]*discordgo.Message, error) {
 	// Fetch messages from Discord API
@@ -275,6 +299,7 @@ func (d *DiscordService) GetStatus() map[string]interface{} {
 		"enabled":        d.enabled,
 		"command_prefix": d.commandPrefix,
 		"uptime":         time.Since(d.startTime).String(),
+		"personas":       d.personas,
 	}
 
 	if d.enabled && d.session != nil {
@@ -0,0 +1,187 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+
+	"chatbot/models"
+
+	"github.com/philippgille/chromem-go"
+)
+
+// Embedding providers
+const (
+	EmbeddingAuto         = "auto" // OpenAI when OPENAI_API_KEY is set, otherwise the offline hash embedder
+	EmbeddingOpenAI       = "openai"
+	EmbeddingOllama       = "ollama"
+	EmbeddingOpenAICompat = "openai-compat"
+	EmbeddingHash         = "hash"
+)
+
+// Embedding defaults
+const (
+	defaultOllamaEmbeddingModel = "nomic-embed-text"
+	defaultHashDimensions       = 512
+)
+
+// NewEmbeddingFunc returns the embedding function for the configured provider, along with
+// a description of the provider and model. Vectors from different embedders can't be compared,
+// so the description is part of the index settings and a change re-indexes every file.
+func NewEmbeddingFunc(config models.RAGConfig) (chromem.EmbeddingFunc, string, error) {
+	provider := strings.ToLower(config.EmbeddingProvider)
+	if !config.EmbeddingEnabled {
+		// Remote embeddings are disabled; stay fully local
+		provider = EmbeddingHash
+	}
+	if provider == "" || provider == EmbeddingAuto {
+		if os.Getenv("OPENAI_API_KEY") != "" {
+			provider = EmbeddingOpenAI
+		} else {
+			log.Printf("OpenAI API key not found, using offline hash embeddings")
+			provider = EmbeddingHash
+		}
+	}
+
+	switch provider {
+	case EmbeddingOpenAI:
+		apiKey := os.Getenv("OPENAI_API_KEY")
+		if apiKey == "" {
+			return nil, "", fmt.Errorf("OPENAI_API_KEY is required for OpenAI embeddings")
+		}
+		model := config.EmbeddingModel
+		if model == "" {
+			model = string(chromem.EmbeddingModelOpenAI3Small)
+		}
+		return chromem.NewEmbeddingFuncOpenAI(apiKey, chromem.EmbeddingModelOpenAI(model)), "openai:" + model, nil
+
+	case EmbeddingOllama:
+		baseURL := config.EmbeddingURL
+		if baseURL == "" {
+			baseURL = os.Getenv("LLM_BASE_URL")
+		}
+		if baseURL == "" {
+			baseURL = "http://localhost:11434"
+		}
+		model := config.EmbeddingModel
+		if model == "" {
+			model = defaultOllamaEmbeddingModel
+		}
+		// chromem calls <base>/embeddings, i.e. Ollama's /api/embeddings
+		return chromem.NewEmbeddingFuncOllama(model, strings.TrimSuffix(baseURL, "/")+"/api"), "ollama:" + model, nil
+
+	case EmbeddingOpenAICompat:
+		if config.EmbeddingURL == "" || config.EmbeddingModel == "" {
+			return nil, "", fmt.Errorf("RAG_EMBEDDING_URL and RAG_EMBEDDING_MODEL are required for OpenAI-compatible embeddings")
+		}
+		apiKey := os.Getenv("RAG_EMBEDDING_API_KEY")
+		if apiKey == "" {
+			apiKey = os.Getenv("OPENAI_API_KEY")
+		}
+		baseURL := strings.TrimSuffix(config.EmbeddingURL, "/")
+		return chromem.NewEmbeddingFuncOpenAICompat(baseURL, apiKey, config.EmbeddingModel, nil),
+			"openai-compat:" + baseURL + ":" + config.EmbeddingModel, nil
+
+	case EmbeddingHash:
+		dimensions := config.EmbeddingDimensions
+		if dimensions <= 0 {
+			dimensions = defaultHashDimensions
+		}
+		embedder := NewHashEmbedder(dimensions)
+		return embedder.Embed, fmt.Sprintf("hash:%d", dimensions), nil
+
+	default:
+		return nil, "", fmt.Errorf("unknown embedding provider: %s", provider)
+	}
+}
+
+// HashEmbedder creates embeddings offline by hashing words, word pairs and character
+// trigrams into a fixed number of dimensions with sublinear term-frequency weights.
+// It needs no model or network and always returns the same vector for the same text,
+// which makes it suitable for air-gapped hosts and reproducible tests. It matches on
+// shared vocabulary rather than meaning.
+type HashEmbedder struct {
+	dimensions int
+}
+
+// NewHashEmbedder creates a hashing embedder producing vectors of the given size
+func NewHashEmbedder(dimensions int) *HashEmbedder {
+	return &HashEmbedder{dimensions: dimensions}
+}
+
+// Feature weights: whole words matter most, trigrams make inflected forms overlap
+const (
+	hashWordWeight    = 1.0
+	hashBigramWeight  = 0.5
+	hashTrigramWeight = 0.25
+)
+
+// Embed returns the normalized feature-hashed vector for text
+func (h *HashEmbedder) Embed(_ context.Context, text string) ([]float32, error) {
+	counts := make(map[string]float64)
+
+	words := hashTokenize(text)
+	for i, word := range words {
+		counts["w:"+word] += hashWordWeight
+		if i > 0 {
+			counts["b:"+words[i-1]+" "+word] += hashBigramWeight
+		}
+
+		padded := []rune("^" + word + "$")
+		for j := 0; j+3 <= len(padded); j++ {
+			counts["t:"+string(padded[j:j+3])] += hashTrigramWeight
+		}
+	}
+
+	// Sum in a fixed order so the vector is identical bit for bit on every run
+	features := make([]string, 0, len(counts))
+	for feature := range counts {
+		features = append(features, feature)
+	}
+	sort.Strings(features)
+
+	vector := make([]float64, h.dimensions)
+	for _, feature := range features {
+		count := counts[feature]
+		hasher := fnv.New64a()
+		hasher.Write([]byte(feature))
+		sum := hasher.Sum64()
+
+		// The top bit picks the sign so that colliding features tend to cancel out
+		sign := 1.0
+		if sum>>63 == 1 {
+			sign = -1.0
+		}
+		vector[sum%uint64(h.dimensions)] += sign * math.Log1p(count)
+	}
+
+	var norm float64
+	for _, value := range vector {
+		norm += value * value
+	}
+	norm = math.Sqrt(norm)
+
+	result := make([]float32, h.dimensions)
+	if norm == 0 {
+		// Cosine similarity is undefined for zero vectors; give empty texts a fixed unit vector
+		result[0] = 1
+		return result, nil
+	}
+	for i, value := range vector {
+		result[i] = float32(value / norm)
+	}
+	return result, nil
+}
+
+// hashTokenize lowercases text and splits it into words of letters and digits
+func hashTokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
@@ -0,0 +1,85 @@
+package services
+
+import (
+	"context"
+	"math"
+	"reflect"
+	"testing"
+
+	"chatbot/models"
+)
+
+func cosine(a, b []float32) float64 {
+	var dot float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+	}
+	return dot
+}
+
+func TestHashEmbedderIsDeterministicAndNormalized(t *testing.T) {
+	embedder := NewHashEmbedder(64)
+
+	first, err := embedder.Embed(context.Background(), "Reset your password from the settings page")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, _ := embedder.Embed(context.Background(), "Reset your password from the settings page")
+
+	if len(first) != 64 {
+		t.Fatalf("got %d dimensions, want 64", len(first))
+	}
+	if !reflect.DeepEqual(first, second) {
+		t.Error("the same text should always give the same vector")
+	}
+	if norm := math.Sqrt(cosine(first, first)); math.Abs(norm-1) > 1e-5 {
+		t.Errorf("vector norm = %f, want 1", norm)
+	}
+}
+
+func TestHashEmbedderRanksSharedVocabularyHigher(t *testing.T) {
+	embedder := NewHashEmbedder(defaultHashDimensions)
+	ctx := context.Background()
+
+	query, _ := embedder.Embed(ctx, "how do I reset my password")
+	related, _ := embedder.Embed(ctx, "To reset a forgotten password, open the account settings")
+	unrelated, _ := embedder.Embed(ctx, "The quarterly sales report covers revenue by region")
+
+	if cosine(query, related) <= cosine(query, unrelated) {
+		t.Errorf("related text scored %f, unrelated %f", cosine(query, related), cosine(query, unrelated))
+	}
+}
+
+func TestHashEmbedderEmptyText(t *testing.T) {
+	vector, err := NewHashEmbedder(8).Embed(context.Background(), " ... ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vector[0] != 1 {
+		t.Errorf("empty text should give the fixed unit vector, got %v", vector)
+	}
+}
+
+func TestNewEmbeddingFuncHashProvider(t *testing.T) {
+	tests := []struct {
+		name   string
+		config models.RAGConfig
+		want   string
+	}{
+		{"explicit", models.RAGConfig{EmbeddingEnabled: true, EmbeddingProvider: EmbeddingHash, EmbeddingDimensions: 128}, "hash:128"},
+		{"default dimensions", models.RAGConfig{EmbeddingEnabled: true, EmbeddingProvider: EmbeddingHash}, "hash:512"},
+		{"embeddings disabled", models.RAGConfig{EmbeddingProvider: EmbeddingOpenAI}, "hash:512"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, description, err := NewEmbeddingFunc(tt.config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if description != tt.want {
+				t.Errorf("description = %q, want %q", description, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package services
+
+import (
+	"mime"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DocumentSection is one part of an extracted document, such as a PDF page or an EPUB chapter
+type DocumentSection struct {
+	Text   string
+	Page   int    // 1-based page number, 0 if the format has no pages
+	Number int    // 1-based section number, 0 if the format has no sections
+	Title  string // Section heading, if known
+}
+
+// Extractor turns a document file into plain text sections
+type Extractor interface {
+	// Name identifies the extractor in logs and status output
+	Name() string
+	// Extract reads the file and returns its text sections in document order
+	Extract(path string) ([]DocumentSection, error)
+}
+
+// extractorRegistry maps file extensions and MIME types to extractors
+type extractorRegistry struct {
+	mu          sync.RWMutex
+	byExtension map[string]Extractor
+	byMIMEType  map[string]Extractor
+}
+
+var extractors = &extractorRegistry{
+	byExtension: make(map[string]Extractor),
+	byMIMEType:  make(map[string]Extractor),
+}
+
+// RegisterExtractor makes an extractor available for the given extensions (with leading dot)
+// and MIME types, replacing any extractor previously registered for them
+func RegisterExtractor(extractor Extractor, extensions []string, mimeTypes []string) {
+	extractors.mu.Lock()
+	defer extractors.mu.Unlock()
+
+	for _, ext := range extensions {
+		extractors.byExtension[strings.ToLower(ext)] = extractor
+	}
+	for _, mimeType := range mimeTypes {
+		extractors.byMIMEType[strings.ToLower(mimeType)] = extractor
+	}
+}
+
+// ExtractorFor returns the extractor for a file, looked up by extension and then by the
+// MIME type registered for that extension, or nil if the file type is unsupported
+func ExtractorFor(path string) Extractor {
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext == "" {
+		return nil
+	}
+
+	extractors.mu.RLock()
+	defer extractors.mu.RUnlock()
+
+	if extractor, ok := extractors.byExtension[ext]; ok {
+		return extractor
+	}
+
+	mimeType, _, err := mime.ParseMediaType(mime.TypeByExtension(ext))
+	if err != nil {
+		return nil
+	}
+	return extractors.byMIMEType[mimeType]
+}
+
+// ExtractorForMIME returns the extractor registered for a MIME type, or nil
+func ExtractorForMIME(mimeType string) Extractor {
+	mediaType, _, err := mime.ParseMediaType(mimeType)
+	if err != nil {
+		return nil
+	}
+
+	extractors.mu.RLock()
+	defer extractors.mu.RUnlock()
+	return extractors.byMIMEType[mediaType]
+}
+
+// SupportedExtensions returns the registered file extensions in lexical order
+func SupportedExtensions() []string {
+	extractors.mu.RLock()
+	defer extractors.mu.RUnlock()
+
+	extensions := make([]string, 0, len(extractors.byExtension))
+	for ext := range extractors.byExtension {
+		extensions = append(extensions, ext)
+	}
+	sort.Strings(extensions)
+	return extensions
+}
+
+func init() {
+	RegisterExtractor(&TextExtractor{},
+		[]string{".txt", ".md", ".markdown", ".json", ".csv", ".log", ".yml", ".yaml"},
+		[]string{"text/plain", "text/markdown", "text/csv", "application/json", "application/yaml"})
+	RegisterExtractor(&PDFExtractor{}, []string{".pdf"}, []string{"application/pdf"})
+	RegisterExtractor(&DOCXExtractor{}, []string{".docx"},
+		[]string{"application/vnd.openxmlformats-officedocument.wordprocessingml.document"})
+	RegisterExtractor(&HTMLExtractor{}, []string{".html", ".htm", ".xhtml"},
+		[]string{"text/html", "application/xhtml+xml"})
+	RegisterExtractor(&EPUBExtractor{}, []string{".epub"}, []string{"application/epub+zip"})
+}
+
+// TextExtractor reads plain text formats as a single section
+type TextExtractor struct{}
+
+// Name returns the extractor name
+func (e *TextExtractor) Name() string {
+	return "text"
+}
+
+// Extract returns the file content unchanged
+func (e *TextExtractor) Extract(path string) ([]DocumentSection, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return []DocumentSection{{Text: string(content)}}, nil
+}
+
+// normalizeWhitespace collapses runs of spaces and blank lines left behind by markup
+func normalizeWhitespace(text string) string {
+	lines := strings.Split(text, "\n")
+	result := make([]string, 0, len(lines))
+	blank := false
+
+	for _, line := range lines {
+		line = strings.Join(strings.Fields(line), " ")
+		if line == "" {
+			if !blank && len(result) > 0 {
+				result = append(result, "")
+			}
+			blank = true
+			continue
+		}
+		result = append(result, line)
+		blank = false
+	}
+
+	return strings.TrimSpace(strings.Join(result, "\n"))
+}
@@ -0,0 +1,117 @@
+package services
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// DOCXExtractor extracts Word documents, starting a new section at every heading
+type DOCXExtractor struct{}
+
+// Name returns the extractor name
+func (e *DOCXExtractor) Name() string {
+	return "docx"
+}
+
+// Extract reads word/document.xml and returns the text split at headings
+func (e *DOCXExtractor) Extract(path string) ([]DocumentSection, error) {
+	archive, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open DOCX: %w", err)
+	}
+	defer archive.Close()
+
+	file, err := archive.Open("word/document.xml")
+	if err != nil {
+		return nil, fmt.Errorf("DOCX has no word/document.xml: %w", err)
+	}
+	defer file.Close()
+
+	return parseDOCXBody(file)
+}
+
+// parseDOCXBody walks the WordprocessingML paragraphs of a document body
+func parseDOCXBody(r io.Reader) ([]DocumentSection, error) {
+	decoder := xml.NewDecoder(r)
+
+	var sections []DocumentSection
+	var body, paragraph strings.Builder
+	title := ""
+	inText := false
+	heading := false
+
+	flush := func() {
+		text := normalizeWhitespace(body.String())
+		if text != "" {
+			sections = append(sections, DocumentSection{
+				Text:   text,
+				Number: len(sections) + 1,
+				Title:  title,
+			})
+		}
+		body.Reset()
+	}
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse DOCX: %w", err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "p":
+				paragraph.Reset()
+				heading = false
+			case "pStyle":
+				style := strings.ToLower(xmlAttr(t, "val"))
+				heading = strings.HasPrefix(style, "heading") || style == "title"
+			case "outlineLvl":
+				heading = true
+			case "t":
+				inText = true
+			case "tab":
+				paragraph.WriteString("\t")
+			case "br", "cr":
+				paragraph.WriteString("\n")
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				text := strings.TrimSpace(paragraph.String())
+				if heading && text != "" {
+					flush()
+					title = text
+				}
+				body.WriteString(text)
+				body.WriteString("\n")
+			}
+		case xml.CharData:
+			if inText {
+				paragraph.Write(t)
+			}
+		}
+	}
+
+	flush()
+	return sections, nil
+}
+
+// xmlAttr returns the value of an attribute by local name
+func xmlAttr(element xml.StartElement, name string) string {
+	for _, attr := range element.Attr {
+		if attr.Name.Local == name {
+			return attr.Value
+		}
+	}
+	return ""
+}
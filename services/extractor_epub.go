@@ -0,0 +1,131 @@
+package services
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// EPUBExtractor extracts e-books, returning each chapter in reading order as its own section
+type EPUBExtractor struct{}
+
+// Name returns the extractor name
+func (e *EPUBExtractor) Name() string {
+	return "epub"
+}
+
+// epubContainer is META-INF/container.xml, which points at the package document
+type epubContainer struct {
+	Rootfiles []struct {
+		FullPath string `xml:"full-path,attr"`
+	} `xml:"rootfiles>rootfile"`
+}
+
+// epubPackage is the OPF package document listing the content files and their reading order
+type epubPackage struct {
+	Manifest []struct {
+		ID        string `xml:"id,attr"`
+		Href      string `xml:"href,attr"`
+		MediaType string `xml:"media-type,attr"`
+	} `xml:"manifest>item"`
+	Spine []struct {
+		IDRef string `xml:"idref,attr"`
+	} `xml:"spine>itemref"`
+}
+
+// Extract follows the spine of the package document and extracts each XHTML chapter
+func (e *EPUBExtractor) Extract(filePath string) ([]DocumentSection, error) {
+	archive, err := zip.OpenReader(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open EPUB: %w", err)
+	}
+	defer archive.Close()
+
+	var container epubContainer
+	if err := decodeZipXML(archive, "META-INF/container.xml", &container); err != nil {
+		return nil, err
+	}
+	if len(container.Rootfiles) == 0 {
+		return nil, fmt.Errorf("EPUB container lists no package document")
+	}
+
+	packagePath := container.Rootfiles[0].FullPath
+	var pkg epubPackage
+	if err := decodeZipXML(archive, packagePath, &pkg); err != nil {
+		return nil, err
+	}
+
+	items := make(map[string]string, len(pkg.Manifest))
+	for _, item := range pkg.Manifest {
+		if strings.Contains(item.MediaType, "html") {
+			items[item.ID] = item.Href
+		}
+	}
+
+	// Manifest hrefs are relative to the package document
+	baseDir := path.Dir(packagePath)
+
+	var sections []DocumentSection
+	for _, ref := range pkg.Spine {
+		href, ok := items[ref.IDRef]
+		if !ok {
+			continue
+		}
+
+		if unescaped, err := url.PathUnescape(href); err == nil {
+			href = unescaped
+		}
+
+		chapter, err := archive.Open(path.Join(baseDir, href))
+		if err != nil {
+			return nil, fmt.Errorf("failed to open chapter %s: %w", href, err)
+		}
+		title, parts, err := parseHTMLSections(chapter)
+		chapter.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse chapter %s: %w", href, err)
+		}
+
+		// Prefer the chapter's first heading over its <title>, which is often the book title
+		texts := make([]string, 0, len(parts))
+		heading := ""
+		for _, part := range parts {
+			texts = append(texts, part.Text)
+			if heading == "" {
+				heading = part.Title
+			}
+		}
+		if heading != "" {
+			title = heading
+		}
+
+		text := strings.Join(texts, "\n\n")
+		if text == "" {
+			continue
+		}
+		sections = append(sections, DocumentSection{
+			Text:   text,
+			Number: len(sections) + 1,
+			Title:  title,
+		})
+	}
+
+	return sections, nil
+}
+
+// decodeZipXML decodes an XML file inside a zip archive
+func decodeZipXML(archive *zip.ReadCloser, name string, v interface{}) error {
+	file, err := archive.Open(name)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", name, err)
+	}
+	defer file.Close()
+
+	if err := xml.NewDecoder(file).Decode(v); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package services
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// HTMLExtractor extracts visible HTML text, starting a new section at every heading
+type HTMLExtractor struct{}
+
+// Name returns the extractor name
+func (e *HTMLExtractor) Name() string {
+	return "html"
+}
+
+// Extract parses the file and returns its text split at headings
+func (e *HTMLExtractor) Extract(path string) ([]DocumentSection, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	_, sections, err := parseHTMLSections(file)
+	return sections, err
+}
+
+// skippedHTMLElements hold no readable content
+var skippedHTMLElements = map[atom.Atom]bool{
+	atom.Script:   true,
+	atom.Style:    true,
+	atom.Noscript: true,
+	atom.Template: true,
+	atom.Head:     true,
+	atom.Svg:      true,
+	atom.Iframe:   true,
+}
+
+// blockHTMLElements are separated from the surrounding text by a line break
+var blockHTMLElements = map[atom.Atom]bool{
+	atom.P: true, atom.Div: true, atom.Br: true, atom.Li: true, atom.Tr: true,
+	atom.Section: true, atom.Article: true, atom.Header: true, atom.Footer: true,
+	atom.Blockquote: true, atom.Pre: true, atom.Table: true, atom.Ul: true, atom.Ol: true,
+	atom.H1: true, atom.H2: true, atom.H3: true, atom.H4: true, atom.H5: true, atom.H6: true,
+}
+
+// headingHTMLElements start a new section
+var headingHTMLElements = map[atom.Atom]bool{
+	atom.H1: true, atom.H2: true, atom.H3: true, atom.H4: true, atom.H5: true, atom.H6: true,
+}
+
+// parseHTMLSections returns the document title and its visible text split at headings
+func parseHTMLSections(r io.Reader) (string, []DocumentSection, error) {
+	doc, err := html.Parse(r)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to parse HTML: %w", err)
+	}
+
+	documentTitle := ""
+	var sections []DocumentSection
+	var body strings.Builder
+	sectionTitle := ""
+
+	flush := func() {
+		text := normalizeWhitespace(body.String())
+		if text != "" {
+			sections = append(sections, DocumentSection{
+				Text:   text,
+				Number: len(sections) + 1,
+				Title:  sectionTitle,
+			})
+		}
+		body.Reset()
+	}
+
+	var walk func(node *html.Node)
+	walk = func(node *html.Node) {
+		if node.Type == html.ElementNode {
+			if skippedHTMLElements[node.DataAtom] {
+				return
+			}
+			if headingHTMLElements[node.DataAtom] {
+				if heading := nodeText(node); heading != "" {
+					flush()
+					sectionTitle = heading
+				}
+			}
+			if blockHTMLElements[node.DataAtom] {
+				body.WriteString("\n")
+			}
+		}
+
+		if node.Type == html.TextNode {
+			body.WriteString(node.Data)
+		}
+
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+
+		if node.Type == html.ElementNode && blockHTMLElements[node.DataAtom] {
+			body.WriteString("\n")
+		}
+	}
+
+	// The title lives in <head>, which walk skips
+	var findTitle func(node *html.Node)
+	findTitle = func(node *html.Node) {
+		if node.Type == html.ElementNode && node.DataAtom == atom.Title {
+			documentTitle = nodeText(node)
+			return
+		}
+		for child := node.FirstChild; child != nil && documentTitle == ""; child = child.NextSibling {
+			findTitle(child)
+		}
+	}
+	findTitle(doc)
+
+	walk(doc)
+	flush()
+
+	return documentTitle, sections, nil
+}
+
+// nodeText returns the concatenated text below a node, ignoring scripts and styles
+func nodeText(node *html.Node) string {
+	var text strings.Builder
+
+	var collect func(n *html.Node)
+	collect = func(n *html.Node) {
+		if n.Type == html.ElementNode && (n.DataAtom == atom.Script || n.DataAtom == atom.Style) {
+			return
+		}
+		if n.Type == html.TextNode {
+			text.WriteString(n.Data)
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			collect(child)
+		}
+	}
+	collect(node)
+
+	return strings.Join(strings.Fields(text.String()), " ")
+}
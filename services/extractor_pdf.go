@@ -0,0 +1,52 @@
+package services
+
+import (
+	"fmt"
+
+	"github.com/ledongthuc/pdf"
+)
+
+// PDFExtractor extracts the text of each PDF page as its own section
+type PDFExtractor struct{}
+
+// Name returns the extractor name
+func (e *PDFExtractor) Name() string {
+	return "pdf"
+}
+
+// Extract returns one section per page that contains text
+func (e *PDFExtractor) Extract(path string) (sections []DocumentSection, err error) {
+	// The PDF reader panics on some malformed files
+	defer func() {
+		if r := recover(); r != nil {
+			sections = nil
+			err = fmt.Errorf("failed to parse PDF: %v", r)
+		}
+	}()
+
+	file, reader, err := pdf.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open PDF: %w", err)
+	}
+	defer file.Close()
+
+	for i := 1; i <= reader.NumPage(); i++ {
+		page := reader.Page(i)
+		if page.V.IsNull() {
+			continue
+		}
+
+		text, err := page.GetPlainText(nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read page %d: %w", i, err)
+		}
+
+		text = normalizeWhitespace(text)
+		if text == "" {
+			continue
+		}
+		sections = append(sections, DocumentSection{Text: text, Page: i})
+	}
+
+	return sections, nil
+}
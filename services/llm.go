@@ -1,39 +1,96 @@
 package services
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"chatbot/models"
+	"chatbot/utils"
+)
+
+// Ollama APIs the service can use, chosen by LLM_API
+const (
+	ollamaAPIAuto     = "auto"     // Chat for models with a chat template, generate for raw models
+	ollamaAPIChat     = "chat"     // Always /api/chat with system, user and assistant messages
+	ollamaAPIGenerate = "generate" // Always /api/generate with a single text prompt
 )
 
 // LLMService handles communication with local LLM models (like Ollama)
 type LLMService struct {
-	baseURL    string
-	model      string
-	httpClient *http.Client
-	timeout    time.Duration
+	mu           sync.RWMutex // Guards model, chatSupport and noTools, which change while requests are in flight
+	baseURL      string
+	model        string
+	httpClient   *http.Client
+	streamClient *http.Client
+	timeout      time.Duration
+	numCtx       int
+	policy       ResponsePolicy
+	api          string
+	keepAlive    interface{}     // How long Ollama keeps the model loaded; a duration string or seconds
+	format       string          // Default output format, e.g. "json"
+	chatSupport  map[string]bool // Whether each model has a chat template
+	noTools      map[string]bool // Models Ollama reported as unable to call tools
 }
 
-// OllamaRequest represents a request to the Ollama API
+// OllamaRequest represents a request to Ollama's generate or chat API
 type OllamaRequest struct {
-	Model   string                 `json:"model"`
-	Prompt  string                 `json:"prompt"`
-	Stream  bool                   `json:"stream"`
-	Options map[string]interface{} `json:"options,omitempty"`
+	Model     string                 `json:"model"`
+	Prompt    string                 `json:"prompt,omitempty"`   // Generate API
+	Messages  []OllamaChatMessage    `json:"messages,omitempty"` // Chat API
+	Stream    bool                   `json:"stream"`
+	Format    string                 `json:"format,omitempty"`
+	KeepAlive interface{}            `json:"keep_alive,omitempty"`
+	Options   map[string]interface{} `json:"options,omitempty"`
+	Tools     []OllamaTool           `json:"tools,omitempty"` // Chat API
 }
 
-// OllamaResponse represents a response from the Ollama API
+// OllamaChatMessage is one message for Ollama's chat API
+type OllamaChatMessage struct {
+	Role      string           `json:"role"` // "system", "user", "assistant" or "tool"
+	Content   string           `json:"content"`
+	ToolCalls []OllamaToolCall `json:"tool_calls,omitempty"`
+	ToolName  string           `json:"tool_name,omitempty"` // The tool a tool message answers
+}
+
+// OllamaTool declares a function the model may call
+type OllamaTool struct {
+	Type     string   `json:"type"` // "function"
+	Function ToolSpec `json:"function"`
+}
+
+// OllamaToolCall is a function call made by the model
+type OllamaToolCall struct {
+	Function struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"` // A JSON object
+	} `json:"function"`
+}
+
+// OllamaResponse represents a response, or one streamed line, from Ollama's generate or chat API
 type OllamaResponse struct {
-	Response string `json:"response"`
-	Done     bool   `json:"done"`
-	Error    string `json:"error,omitempty"`
+	Response string             `json:"response"`          // Generate API
+	Message  *OllamaChatMessage `json:"message,omitempty"` // Chat API
+	Done     bool               `json:"done"`
+	Error    string             `json:"error,omitempty"`
+}
+
+// text returns the generated text of either API
+func (r OllamaResponse) text() string {
+	if r.Message != nil {
+		return r.Message.Content
+	}
+	return r.Response
 }
 
 // NewLLMService creates a new LLM service instance
@@ -45,146 +102,383 @@ func NewLLMService(baseURL, model string) *LLMService {
 		model = os.Getenv("LLM_MODEL")
 	}
 
+	api := strings.ToLower(os.Getenv("LLM_API"))
+	switch api {
+	case ollamaAPIChat, ollamaAPIGenerate:
+	case "", ollamaAPIAuto:
+		api = ollamaAPIAuto
+	default:
+		log.Printf("Warning: unknown LLM_API %q, using %s", api, ollamaAPIAuto)
+		api = ollamaAPIAuto
+	}
+
+	// keep_alive takes a duration such as "10m", or seconds where -1 keeps the model loaded
+	var keepAlive interface{}
+	if value := os.Getenv("LLM_KEEP_ALIVE"); value != "" {
+		keepAlive = value
+		if seconds, err := strconv.Atoi(value); err == nil {
+			keepAlive = seconds
+		}
+	}
+
 	return &LLMService{
 		baseURL: baseURL,
 		model:   model,
 		httpClient: &http.Client{
 			Timeout: 60 * time.Second, // Faster timeout for smaller model
 		},
-		timeout: 60 * time.Second,
+		streamClient: &http.Client{},
+		timeout:      60 * time.Second,
+		numCtx:       utils.GetEnvInt("LLM_NUM_CTX", 1024), // Smaller context window for Pi
+		// Small local models ramble, so replies are kept short by default
+		policy: ResponsePolicyFromEnv("LLM", ResponsePolicy{
+			MaxTokens:        150,
+			MaxChars:         300,
+			StopPatterns:     defaultStopPatterns,
+			PreserveMarkdown: true,
+		}),
+		api:         api,
+		keepAlive:   keepAlive,
+		format:      os.Getenv("LLM_FORMAT"),
+		chatSupport: make(map[string]bool),
+		noTools:     make(map[string]bool),
 	}
 }
 
+// Name returns the provider name of the local LLM backend
+func (l *LLMService) Name() LLMProvider {
+	return ProviderLocal
+}
+
 // GenerateResponse generates a response using the local LLM
-func (l *LLMService) GenerateResponse(message string, context []string, history []models.ChatMessage) (string, error) {
-	// Build the prompt with context and history
-	prompt := l.buildPrompt(message, context, history)
+func (l *LLMService) GenerateResponse(ctx context.Context, generate GenerateRequest) (string, error) {
+	resp, err := l.send(ctx, l.httpClient, generate, false)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
 
-	// Create request with tighter controls
-	request := OllamaRequest{
-		Model:  l.model,
-		Prompt: prompt,
-		Stream: false,
-		Options: map[string]interface{}{
-			"temperature":    0.7,
-			"max_tokens":     150, // Much shorter responses
-			"top_p":          0.9,
-			"repeat_penalty": 1.2,                                                 // Prevent repetition
-			"num_ctx":        1024,                                                // Smaller context window for Pi
-			"stop":           []string{"\n\nHuman:", "\nHuman:", "User:", "\n\n"}, // Stop tokens
-		},
+	var ollamaResp OllamaResponse
+	if err := json.NewDecoder(resp.Body).Decode(&ollamaResp); err != nil {
+		return "", fmt.Errorf("failed to decode response: %w", err)
 	}
 
-	// Convert to JSON
-	jsonData, err := json.Marshal(request)
-	if err != nil {
-		return "", fmt.Errorf("failed to marshal request: %w", err)
+	if ollamaResp.Error != "" {
+		return "", fmt.Errorf("LLM returned error: %s", ollamaResp.Error)
 	}
 
-	// Make HTTP request
-	resp, err := l.httpClient.Post(l.baseURL+"/api/generate", "application/json", bytes.NewBuffer(jsonData))
+	return strings.TrimSpace(ollamaResp.text()), nil
+}
+
+// StreamResponse generates a response using Ollama's NDJSON stream, calling onToken for each fragment
+func (l *LLMService) StreamResponse(ctx context.Context, generate GenerateRequest, onToken func(token string) error) (string, error) {
+	// Streams are bounded by the request context rather than the client timeout
+	resp, err := l.send(ctx, l.streamClient, generate, true)
 	if err != nil {
-		return "", fmt.Errorf("failed to make request to LLM: %w", err)
+		return "", err
 	}
 	defer resp.Body.Close()
 
-	// Check status code
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("LLM API returned status %d: %s", resp.StatusCode, string(body))
+	// Each line of the body is a JSON object carrying the next fragment
+	var full strings.Builder
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var chunk OllamaResponse
+		if err := json.Unmarshal(line, &chunk); err != nil {
+			return full.String(), fmt.Errorf("failed to decode stream chunk: %w", err)
+		}
+
+		if chunk.Error != "" {
+			return full.String(), fmt.Errorf("LLM returned error: %s", chunk.Error)
+		}
+
+		if token := chunk.text(); token != "" {
+			full.WriteString(token)
+			if err := onToken(token); err != nil {
+				return full.String(), err
+			}
+		}
+
+		if chunk.Done {
+			break
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return full.String(), fmt.Errorf("failed to read stream: %w", err)
+	}
+
+	return strings.TrimSpace(full.String()), nil
+}
+
+// GenerateToolTurn sends one turn of the agent loop using Ollama's tool calling, which
+// needs the chat API and a model trained for tools
+func (l *LLMService) GenerateToolTurn(ctx context.Context, generate GenerateRequest) (string, []ToolCall, error) {
+	model := l.GetModel()
+	if generate.Model != "" {
+		model = generate.Model
+	}
+	l.mu.RLock()
+	noTools := l.noTools[model]
+	l.mu.RUnlock()
+	if noTools || !l.usesChat(model) {
+		return "", nil, fmt.Errorf("%w: %s", ErrToolsUnsupported, model)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, l.timeout)
+	defer cancel()
+
+	resp, err := l.send(ctx, l.streamClient, generate, false)
+	if err != nil {
+		return "", nil, err
 	}
+	defer resp.Body.Close()
 
-	// Parse response and clean it up
 	var ollamaResp OllamaResponse
 	if err := json.NewDecoder(resp.Body).Decode(&ollamaResp); err != nil {
-		return "", fmt.Errorf("failed to decode response: %w", err)
+		return "", nil, fmt.Errorf("failed to decode response: %w", err)
 	}
-
 	if ollamaResp.Error != "" {
-		return "", fmt.Errorf("LLM returned error: %s", ollamaResp.Error)
+		return "", nil, fmt.Errorf("LLM returned error: %s", ollamaResp.Error)
 	}
 
-	// Clean up the response to prevent self-conversation
-	cleanResponse := l.cleanResponse(ollamaResp.Response)
+	var calls []ToolCall
+	if ollamaResp.Message != nil {
+		// Ollama has no call IDs; results are matched to calls by order and tool name
+		for i, call := range ollamaResp.Message.ToolCalls {
+			calls = append(calls, ToolCall{
+				ID:        fmt.Sprintf("call_%d", i+1),
+				Name:      call.Function.Name,
+				Arguments: toolArguments(call.Function.Arguments),
+			})
+		}
+	}
+	return strings.TrimSpace(ollamaResp.text()), calls, nil
+}
+
+// send posts the request to the chat or generate API and returns the successful response.
+// Ollama versions without /api/chat are detected by its 404 and get the generate API instead.
+func (l *LLMService) send(ctx context.Context, client *http.Client, generate GenerateRequest, stream bool) (*http.Response, error) {
+	model := l.GetModel()
+	if generate.Model != "" {
+		model = generate.Model
+	}
+	chat := l.usesChat(model)
+
+	for {
+		path, request := l.buildRequest(generate, model, chat, stream)
+		jsonData, err := json.Marshal(request)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal request: %w", err)
+		}
+
+		req, err := http.NewRequestWithContext(ctx, "POST", l.baseURL+path, bytes.NewBuffer(jsonData))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
 
-	return cleanResponse, nil
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to make request to LLM: %w", err)
+		}
+		if resp.StatusCode == http.StatusOK {
+			return resp, nil
+		}
+
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		// A missing model is also a 404, but its message names the model
+		if chat && resp.StatusCode == http.StatusNotFound && !strings.Contains(string(body), "model") {
+			log.Printf("Ollama has no chat API, using /api/generate for %s", model)
+			l.setChatSupport(model, false)
+			chat = false
+			continue
+		}
+		if len(request.Tools) > 0 && resp.StatusCode == http.StatusBadRequest && strings.Contains(string(body), "does not support tools") {
+			l.mu.Lock()
+			l.noTools[model] = true
+			l.mu.Unlock()
+			return nil, fmt.Errorf("%w: %s", ErrToolsUnsupported, model)
+		}
+		return nil, fmt.Errorf("LLM API returned status %d: %s", resp.StatusCode, string(body))
+	}
 }
 
-// cleanResponse removes unwanted patterns from LLM responses
-func (l *LLMService) cleanResponse(response string) string {
-	return cleanLLMResponse(response)
+// usesChat reports whether requests for a model go to the chat API
+func (l *LLMService) usesChat(model string) bool {
+	switch l.api {
+	case ollamaAPIChat:
+		return true
+	case ollamaAPIGenerate:
+		return false
+	}
+
+	l.mu.RLock()
+	supported, known := l.chatSupport[model]
+	l.mu.RUnlock()
+	if known {
+		return supported
+	}
+
+	supported = l.hasChatTemplate(model)
+	if !supported {
+		log.Printf("Model %s has no chat template, using /api/generate", model)
+	}
+	l.setChatSupport(model, supported)
+	return supported
+}
+
+// setChatSupport records which API a model uses
+func (l *LLMService) setChatSupport(model string, supported bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.chatSupport[model] = supported
+}
+
+// hasChatTemplate asks Ollama for the model's prompt template. Raw models pass the prompt
+// through unchanged and need the generate-style prompt. If the template can't be read,
+// chat is assumed and send falls back if the chat API is missing.
+func (l *LLMService) hasChatTemplate(model string) bool {
+	jsonData, err := json.Marshal(map[string]string{"model": model, "name": model})
+	if err != nil {
+		return true
+	}
+
+	resp, err := l.httpClient.Post(l.baseURL+"/api/show", "application/json", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return true
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return true
+	}
+
+	var show struct {
+		Template string `json:"template"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&show); err != nil {
+		return true
+	}
+
+	template := strings.Join(strings.Fields(show.Template), "")
+	return template != "" && template != "{{.Prompt}}"
 }
 
-// cleanLLMResponse is a shared function for cleaning LLM responses
-func cleanLLMResponse(response string) string {
-	// Trim whitespace
-	response = strings.TrimSpace(response)
-
-	// Stop at common conversation continuation patterns
-	stopPatterns := []string{
-		"\n\nHuman:",
-		"\nHuman:",
-		"\n\nUser:",
-		"\nUser:",
-		"\n\nQ:",
-		"\nQ:",
-		"\n\nQuestion:",
-	}
-
-	for _, pattern := range stopPatterns {
-		if idx := strings.Index(response, pattern); idx != -1 {
-			response = response[:idx]
+// buildRequest creates the Ollama chat or generate request with tighter controls and
+// returns the API path to send it to
+func (l *LLMService) buildRequest(generate GenerateRequest, model string, chat bool, stream bool) (string, OllamaRequest) {
+	maxTokens, stop := generate.limits(l.policy)
+
+	options := map[string]interface{}{
+		"temperature":    0.7,
+		"num_predict":    maxTokens,
+		"top_p":          0.9,
+		"repeat_penalty": 1.2, // Prevent repetition
+		"num_ctx":        l.numCtx,
+		"stop":           stop,
+	}
+	if generate.Temperature != nil {
+		options["temperature"] = *generate.Temperature
+	}
+	if generate.TopP != nil {
+		options["top_p"] = *generate.TopP
+	}
+	if generate.Seed != nil {
+		options["seed"] = *generate.Seed
+	}
+
+	request := OllamaRequest{
+		Model:     model,
+		Stream:    stream,
+		Format:    l.format,
+		KeepAlive: l.keepAlive,
+		Options:   options,
+	}
+	if generate.Format != "" {
+		request.Format = generate.Format
+	}
+
+	if chat {
+		request.Messages = l.buildMessages(generate)
+		for _, tool := range generate.Tools {
+			request.Tools = append(request.Tools, OllamaTool{Type: "function", Function: tool})
+		}
+		return "/api/chat", request
+	}
+
+	// Raw models get the context and history flattened into one prompt
+	request.Prompt = l.buildPrompt(generate)
+	return "/api/generate", request
+}
+
+// buildMessages constructs the chat messages, with the context in the system message
+func (l *LLMService) buildMessages(generate GenerateRequest) []OllamaChatMessage {
+	system := generate.systemPrompt()
+	if len(generate.Context) > 0 {
+		system += "\n\nContext:\n"
+		for _, ctx := range generate.Context {
+			system += "- " + ctx + "\n"
 		}
 	}
 
-	// Remove trailing punctuation that might indicate continuation
-	response = strings.TrimRight(response, ".,!?;:")
-	response = strings.TrimSpace(response)
+	messages := []OllamaChatMessage{{Role: "system", Content: strings.TrimSpace(system)}}
 
-	// Limit length as final safeguard (about 2-3 sentences)
-	if len(response) > 300 {
-		// Try to cut at sentence boundary
-		sentences := strings.Split(response, ". ")
-		if len(sentences) > 2 {
-			response = strings.Join(sentences[:2], ". ") + "."
-		} else {
-			// Hard cut if no sentence boundaries
-			response = response[:297] + "..."
+	// The prompt builder has already fitted the history to the context window
+	for _, msg := range generate.History {
+		if msg.Role == "user" || msg.Role == "assistant" {
+			messages = append(messages, OllamaChatMessage{Role: msg.Role, Content: msg.Content})
 		}
 	}
 
-	return response
+	messages = append(messages, OllamaChatMessage{Role: "user", Content: generate.Message})
+
+	// Replay the tool calls made so far, each followed by its results
+	for _, step := range generate.Steps {
+		assistant := OllamaChatMessage{Role: "assistant", Content: step.Content}
+		for _, call := range step.Calls {
+			var toolCall OllamaToolCall
+			toolCall.Function.Name = call.Name
+			toolCall.Function.Arguments = call.Arguments
+			assistant.ToolCalls = append(assistant.ToolCalls, toolCall)
+		}
+		messages = append(messages, assistant)
+
+		for _, result := range step.Results {
+			messages = append(messages, OllamaChatMessage{Role: "tool", Content: result.Content, ToolName: result.Name})
+		}
+	}
+
+	return messages
 }
 
-// buildPrompt constructs a prompt for the LLM with context and history
-func (l *LLMService) buildPrompt(message string, context []string, history []models.ChatMessage) string {
+// buildPrompt constructs a generate-style prompt for raw models with context and history
+func (l *LLMService) buildPrompt(generate GenerateRequest) string {
 	var prompt bytes.Buffer
 
 	// System prompt with clear instructions
-	prompt.WriteString("You are a helpful AI assistant. Provide concise, direct answers. ")
-	prompt.WriteString("Keep responses under 2-3 sentences unless more detail is specifically requested. ")
-	prompt.WriteString("Use provided context when relevant. ")
-	prompt.WriteString("Do not continue the conversation or ask follow-up questions.\n\n")
+	prompt.WriteString(generate.systemPrompt() + "\n\n")
 
 	// Add context if available
-	if len(context) > 0 {
+	if len(generate.Context) > 0 {
 		prompt.WriteString("Context:\n")
-		for _, ctx := range context {
+		for _, ctx := range generate.Context {
 			prompt.WriteString(fmt.Sprintf("- %s\n", ctx))
 		}
 		prompt.WriteString("\n")
 	}
 
-	// Add conversation history (limit to last 4 messages to avoid token limits)
-	if len(history) > 0 {
+	// Add conversation history; the prompt builder has already fitted it to the context window
+	if len(generate.History) > 0 {
 		prompt.WriteString("Previous conversation:\n")
-		start := 0
-		if len(history) > 4 {
-			start = len(history) - 4
-		}
-
-		for i := start; i < len(history); i++ {
-			msg := history[i]
+		for _, msg := range generate.History {
 			if msg.Role == "user" {
 				prompt.WriteString(fmt.Sprintf("Human: %s\n", msg.Content))
 			} else if msg.Role == "assistant" {
@@ -195,12 +489,49 @@ func (l *LLMService) buildPrompt(message string, context []string, history []mod
 	}
 
 	// Add current user message with clear instruction
-	prompt.WriteString(fmt.Sprintf("Human: %s\n", message))
+	prompt.WriteString(fmt.Sprintf("Human: %s\n", generate.Message))
 	prompt.WriteString("Assistant: ")
 
 	return prompt.String()
 }
 
+// ContextWindow returns the context size requested from Ollama
+func (l *LLMService) ContextWindow() int {
+	return l.numCtx
+}
+
+// EstimateTokens counts tokens with the shared heuristic, as Ollama models use many
+// different tokenizers and none is bundled
+func (l *LLMService) EstimateTokens(text string) int {
+	return EstimateTokens(text)
+}
+
+// ResponsePolicy returns the default reply limits and cleanup for the local model
+func (l *LLMService) ResponsePolicy() ResponsePolicy {
+	return l.policy
+}
+
+// ValidateOptions checks generation options against Ollama's ranges and the installed models
+func (l *LLMService) ValidateOptions(options models.GenerationOptions) error {
+	limits := OptionLimits{MaxTemperature: 2, MaxTokens: l.numCtx}
+	if err := limits.Validate(options); err != nil {
+		return err
+	}
+
+	if options.Model == "" {
+		return nil
+	}
+	installed, err := l.GetAvailableModels()
+	if err != nil {
+		// Let Ollama report the problem if the model list can't be checked
+		return nil
+	}
+	if findModel(installed, options.Model) == "" {
+		return fmt.Errorf("%w: model %s is not installed", ErrInvalidOptions, options.Model)
+	}
+	return nil
+}
+
 // IsAvailable checks if the LLM service is available
 func (l *LLMService) IsAvailable() bool {
 	resp, err := l.httpClient.Get(l.baseURL + "/api/tags")
@@ -246,8 +577,15 @@ func (l *LLMService) GetAvailableModels() ([]string, error) {
 func (l *LLMService) GetStatus() map[string]interface{} {
 	status := map[string]interface{}{
 		"base_url": l.baseURL,
-		"model":    l.model,
+		"model":    l.GetModel(),
 		"timeout":  l.timeout.String(),
+		"api":      l.api,
+	}
+	if l.keepAlive != nil {
+		status["keep_alive"] = l.keepAlive
+	}
+	if l.format != "" {
+		status["format"] = l.format
 	}
 
 	if l.IsAvailable() {
@@ -263,12 +601,16 @@ func (l *LLMService) GetStatus() map[string]interface{} {
 	return status
 }
 
-// SetModel changes the current model
+// SetModel changes the current model; requests already sent keep their model
 func (l *LLMService) SetModel(model string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
 	l.model = model
 }
 
 // GetModel returns the current model
 func (l *LLMService) GetModel() string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
 	return l.model
 }
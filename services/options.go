@@ -0,0 +1,62 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+
+	"chatbot/models"
+)
+
+// ErrInvalidOptions is returned when generation options fall outside a provider's limits
+var ErrInvalidOptions = errors.New("invalid generation options")
+
+// OptionLimits are the generation option ranges a provider accepts
+type OptionLimits struct {
+	MaxTemperature   float64
+	MaxTokens        int // Largest reply length, usually the context window
+	MaxStopSequences int // 0 allows any number
+}
+
+// Validate checks options against the limits
+func (l OptionLimits) Validate(options models.GenerationOptions) error {
+	if options.Temperature != nil && (*options.Temperature < 0 || *options.Temperature > l.MaxTemperature) {
+		return fmt.Errorf("%w: temperature must be between 0 and %g", ErrInvalidOptions, l.MaxTemperature)
+	}
+	if options.TopP != nil && (*options.TopP <= 0 || *options.TopP > 1) {
+		return fmt.Errorf("%w: top_p must be greater than 0 and at most 1", ErrInvalidOptions)
+	}
+	if options.MaxTokens != nil && (*options.MaxTokens < 1 || *options.MaxTokens > l.MaxTokens) {
+		return fmt.Errorf("%w: max_tokens must be between 1 and %d", ErrInvalidOptions, l.MaxTokens)
+	}
+	if l.MaxStopSequences > 0 && len(options.Stop) > l.MaxStopSequences {
+		return fmt.Errorf("%w: at most %d stop sequences are allowed", ErrInvalidOptions, l.MaxStopSequences)
+	}
+	if options.Format != "" && options.Format != "json" {
+		return fmt.Errorf("%w: format must be \"json\"", ErrInvalidOptions)
+	}
+	for _, stop := range options.Stop {
+		if stop == "" {
+			return fmt.Errorf("%w: stop sequences cannot be empty", ErrInvalidOptions)
+		}
+	}
+	return nil
+}
+
+// validateOptions checks options against a backend. Backends that don't validate
+// options can't honour them, so any option is rejected.
+func validateOptions(backend LLMBackend, options *models.GenerationOptions) error {
+	if options == nil {
+		return nil
+	}
+	if validator, ok := backend.(OptionsBackend); ok {
+		if err := validator.ValidateOptions(*options); err != nil {
+			return fmt.Errorf("%s: %w", backend.Name(), err)
+		}
+		return nil
+	}
+	if options.Temperature != nil || options.MaxTokens != nil || options.TopP != nil ||
+		options.Seed != nil || len(options.Stop) > 0 || options.Model != "" || options.Format != "" {
+		return fmt.Errorf("%w: %s does not support generation options", ErrInvalidOptions, backend.Name())
+	}
+	return nil
+}
@@ -0,0 +1,320 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"text/template/parse"
+	"time"
+
+	"chatbot/utils"
+)
+
+// DefaultPersona is the built-in persona used when no other is selected
+const DefaultPersona = "default"
+
+// personaExtension is the file extension of persona templates
+const personaExtension = ".tmpl"
+
+// ErrUnknownPersona is returned when a persona name has no template
+var ErrUnknownPersona = errors.New("unknown persona")
+
+// PromptData holds the variables available to persona templates
+type PromptData struct {
+	Date       string // e.g. "Monday, 2 January 2006"
+	Time       string // e.g. "15:04 MST"
+	Channel    string // Discord channel name, or "web" for HTTP requests
+	User       string // Name of the person asking, if known
+	Persona    string
+	Context    string // Numbered context blocks, one per line
+	HasContext bool
+}
+
+// newPromptData fills in the date and time for a request
+func newPromptData(persona string, channel string, user string) PromptData {
+	now := time.Now()
+	if channel == "" {
+		channel = "web"
+	}
+	return PromptData{
+		Date:    now.Format("Monday, 2 January 2006"),
+		Time:    now.Format("15:04 MST"),
+		Channel: channel,
+		User:    user,
+		Persona: persona,
+	}
+}
+
+// Persona is a named system prompt template
+type Persona struct {
+	Name        string
+	Description string
+	Source      string // Template file, or "built-in"
+	template    *template.Template
+	// embedsContext is set when the template places {{.Context}} itself; otherwise the
+	// backends list the context after the system prompt
+	embedsContext bool
+	// policy changes the provider's response policy for this persona
+	policy PolicyOverride
+}
+
+// Render executes the persona template
+func (p *Persona) Render(data PromptData) (string, error) {
+	var out strings.Builder
+	if err := p.template.Execute(&out, data); err != nil {
+		return "", fmt.Errorf("failed to render persona %s: %w", p.Name, err)
+	}
+	return strings.TrimSpace(out.String()), nil
+}
+
+// newPersona parses and test-renders a persona template
+func newPersona(name string, text string, source string) (*Persona, error) {
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse persona %s: %w", name, err)
+	}
+
+	description, policy, err := parseTemplateHeader(templateHeader(text))
+	if err != nil {
+		return nil, fmt.Errorf("invalid header in persona %s: %w", name, err)
+	}
+
+	persona := &Persona{
+		Name:          name,
+		Description:   description,
+		Source:        source,
+		template:      tmpl,
+		embedsContext: templateUsesField(tmpl.Tree.Root, "Context"),
+		policy:        policy,
+	}
+
+	// Unknown fields only show up when the template runs, so catch them at load time
+	if _, err := persona.Render(newPromptData(name, "", "")); err != nil {
+		return nil, err
+	}
+	return persona, nil
+}
+
+// templateHeader returns the text of a leading {{/* comment */}}, if any
+func templateHeader(text string) string {
+	text = strings.TrimSpace(text)
+	if !strings.HasPrefix(text, "{{/*") {
+		return ""
+	}
+	end := strings.Index(text, "*/}}")
+	if end < 0 {
+		return ""
+	}
+	return strings.TrimSpace(text[len("{{/*"):end])
+}
+
+// parseTemplateHeader splits a template header into the description and "key: value"
+// response policy lines such as "max_tokens: 600" or "truncate: false"
+func parseTemplateHeader(header string) (string, PolicyOverride, error) {
+	var description []string
+	var policy PolicyOverride
+	for _, line := range strings.Split(header, "\n") {
+		line = strings.TrimSpace(line)
+		key, value, found := strings.Cut(line, ":")
+		key = strings.TrimSpace(key)
+		if _, isSetting := policySettings[key]; !found || !isSetting {
+			if line != "" {
+				description = append(description, line)
+			}
+			continue
+		}
+		if err := policy.set(key, strings.TrimSpace(value)); err != nil {
+			return "", policy, err
+		}
+	}
+	return strings.Join(description, " "), policy, nil
+}
+
+// templateUsesField reports whether a template refers to a top-level field such as .Context
+func templateUsesField(node parse.Node, field string) bool {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return false
+		}
+		for _, child := range n.Nodes {
+			if templateUsesField(child, field) {
+				return true
+			}
+		}
+	case *parse.ActionNode:
+		return templateUsesField(n.Pipe, field)
+	case *parse.PipeNode:
+		if n == nil {
+			return false
+		}
+		for _, cmd := range n.Cmds {
+			if templateUsesField(cmd, field) {
+				return true
+			}
+		}
+	case *parse.CommandNode:
+		for _, arg := range n.Args {
+			if templateUsesField(arg, field) {
+				return true
+			}
+		}
+	case *parse.FieldNode:
+		return len(n.Ident) > 0 && n.Ident[0] == field
+	case *parse.ChainNode:
+		return templateUsesField(n.Node, field)
+	case *parse.IfNode:
+		return templateUsesField(n.Pipe, field) || templateUsesField(n.List, field) || templateUsesField(n.ElseList, field)
+	case *parse.RangeNode:
+		return templateUsesField(n.Pipe, field) || templateUsesField(n.List, field) || templateUsesField(n.ElseList, field)
+	case *parse.WithNode:
+		return templateUsesField(n.Pipe, field) || templateUsesField(n.List, field) || templateUsesField(n.ElseList, field)
+	case *parse.TemplateNode:
+		return templateUsesField(n.Pipe, field)
+	}
+	return false
+}
+
+// PersonaStore holds the personas loaded from the persona folder
+type PersonaStore struct {
+	mu          sync.RWMutex
+	dir         string
+	personas    map[string]*Persona
+	defaultName string
+}
+
+// NewPersonaStoreFromEnv loads persona templates from PERSONA_DIR (default "./personas").
+// Each <name>.tmpl file becomes a persona; a "default.tmpl" file replaces the built-in one.
+func NewPersonaStoreFromEnv() *PersonaStore {
+	dir := os.Getenv("PERSONA_DIR")
+	if dir == "" {
+		dir = "./personas"
+	}
+
+	store := &PersonaStore{
+		dir:         dir,
+		defaultName: os.Getenv("PERSONA_DEFAULT"),
+	}
+	if store.defaultName == "" {
+		store.defaultName = DefaultPersona
+	}
+
+	if err := store.load(); err != nil {
+		log.Printf("Failed to load personas from %s: %v", dir, err)
+	}
+	return store
+}
+
+// load reads the persona templates. Templates that fail to parse are skipped.
+func (s *PersonaStore) load() error {
+	personas := make(map[string]*Persona)
+
+	builtin, err := newPersona(DefaultPersona, defaultPersonaTemplate, "built-in")
+	if err != nil {
+		return err
+	}
+	personas[DefaultPersona] = builtin
+
+	files, err := filepath.Glob(filepath.Join(s.dir, "*"+personaExtension))
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		text, err := os.ReadFile(file)
+		if err != nil {
+			log.Printf("Failed to read persona %s: %v", file, err)
+			continue
+		}
+		name := strings.TrimSuffix(filepath.Base(file), personaExtension)
+		persona, err := newPersona(name, string(text), file)
+		if err != nil {
+			log.Printf("Skipping persona: %v", err)
+			continue
+		}
+		personas[name] = persona
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.personas = personas
+	if _, exists := personas[s.defaultName]; !exists {
+		log.Printf("Warning: default persona %q not found, using %q", s.defaultName, DefaultPersona)
+		s.defaultName = DefaultPersona
+	}
+	if len(personas) > 1 {
+		log.Printf("Loaded %d personas from %s (default: %s)", len(personas), s.dir, s.defaultName)
+	}
+	return nil
+}
+
+// Get returns a persona by name; an empty name selects the default persona
+func (s *PersonaStore) Get(name string) (*Persona, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if name == "" {
+		name = s.defaultName
+	}
+	persona, exists := s.personas[name]
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownPersona, name)
+	}
+	return persona, nil
+}
+
+// Names returns the available persona names in alphabetical order
+func (s *PersonaStore) Names() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	names := make([]string, 0, len(s.personas))
+	for name := range s.personas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// GetStatus returns the persona configuration
+func (s *PersonaStore) GetStatus() map[string]interface{} {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	personas := make(map[string]interface{}, len(s.personas))
+	for name, persona := range s.personas {
+		personas[name] = map[string]interface{}{
+			"description": persona.Description,
+			"source":      persona.Source,
+		}
+	}
+
+	return map[string]interface{}{
+		"dir":      s.dir,
+		"default":  s.defaultName,
+		"personas": personas,
+	}
+}
+
+// defaultPersonaTemplate reproduces the original built-in instructions
+const defaultPersonaTemplate = `{{/* Concise general-purpose assistant */}}` + assistantInstructions
+
+// ParseChannelPersonas reads "channelID=persona" pairs from a comma-separated environment variable
+func ParseChannelPersonas(key string) map[string]string {
+	channels := make(map[string]string)
+	for _, pair := range utils.GetEnvList(key) {
+		channel, persona, found := strings.Cut(pair, "=")
+		if !found || strings.TrimSpace(channel) == "" || strings.TrimSpace(persona) == "" {
+			log.Printf("Warning: ignoring invalid %s entry %q, expected channelID=persona", key, pair)
+			continue
+		}
+		channels[strings.TrimSpace(channel)] = strings.TrimSpace(persona)
+	}
+	return channels
+}
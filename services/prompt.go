@@ -0,0 +1,395 @@
+package services
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"chatbot/models"
+)
+
+// assistantInstructions is the system prompt shared by every backend
+const assistantInstructions = "You are a helpful AI assistant. Provide concise, direct answers. " +
+	"Keep responses under 2-3 sentences unless more detail is specifically requested. " +
+	"Use provided context when relevant and cite it by its number, like [1]. " +
+	"Do not continue the conversation or ask follow-up questions."
+
+// Prompt sections, in the order they are given budget
+const (
+	PromptSectionDocuments = "documents"
+	PromptSectionSearch    = "search"
+	PromptSectionHistory   = "history"
+	PromptSectionMessage   = "message"
+)
+
+// Actions taken on prompt parts that don't fit
+const (
+	PromptActionTrimmed    = "trimmed"
+	PromptActionSummarized = "summarized"
+	PromptActionDropped    = "dropped"
+)
+
+// Budget shares of the tokens left after the system prompt and the message. A section
+// that needs less than its share passes the rest on to the others.
+const (
+	documentsShare = 0.5
+	searchShare    = 0.2
+	historyShare   = 0.3
+)
+
+const (
+	// promptItemOverhead covers the bullet, role label and line break around each item
+	promptItemOverhead = 4
+	// promptFrameOverhead covers section headings and the final "Assistant:" cue
+	promptFrameOverhead = 16
+	// minTrimmedTokens is the smallest useful remainder of a trimmed block
+	minTrimmedTokens = 24
+	// summaryWordsPerMessage limits how much of each earlier message goes into the summary
+	summaryWordsPerMessage = 12
+	// defaultMaxOutputTokens is the reply length for backends without their own response policy
+	defaultMaxOutputTokens = 256
+	// defaultContextWindow is assumed for models that aren't recognized
+	defaultContextWindow = 4096
+)
+
+// modelContextWindows lists context windows by model name prefix
+var modelContextWindows = map[string]int{
+	"gpt-4o":        128000,
+	"gpt-4.1":       1047576,
+	"gpt-4-turbo":   128000,
+	"gpt-4-32k":     32768,
+	"gpt-4":         8192,
+	"gpt-3.5-turbo": 16385,
+	"o1":            200000,
+	"o3":            200000,
+	"o4":            200000,
+	"llama3":        8192,
+	"llama2":        4096,
+	"mistral":       32768,
+	"mixtral":       32768,
+	"qwen2":         32768,
+	"gemma":         8192,
+	"phi3":          4096,
+	"phi":           2048,
+	"tinyllama":     2048,
+}
+
+// ModelContextWindow returns the context window of a model, matching the longest known name prefix
+func ModelContextWindow(model string) int {
+	model = strings.ToLower(model)
+	best := ""
+	for prefix := range modelContextWindows {
+		if strings.HasPrefix(model, prefix) && len(prefix) > len(best) {
+			best = prefix
+		}
+	}
+	if best == "" {
+		return defaultContextWindow
+	}
+	return modelContextWindows[best]
+}
+
+// PromptSections holds everything that may go into a prompt, each list ordered best first
+type PromptSections struct {
+	System    string   // Rendered system prompt; empty uses the built-in default
+	Documents []string // Numbered document blocks
+	Search    []string // Numbered web search blocks
+	History   []models.ChatMessage
+	Message   string
+}
+
+// flatten returns every context block without budgeting
+func (s PromptSections) flatten() []string {
+	return append(append([]string{}, s.Documents...), s.Search...)
+}
+
+// BuiltPrompt is the part of PromptSections that fits a model's context window
+type BuiltPrompt struct {
+	Context []string
+	History []models.ChatMessage
+	Message string
+	Persona string
+	Report  *models.PromptReport
+	Policy  ResponsePolicy // Cleanup to apply to the reply
+	Model   string         // Model requested for this prompt, if not the backend's own
+}
+
+// dropped reports whether the context block with the given citation number was left out
+func (p *BuiltPrompt) dropped(citation int) bool {
+	if p == nil || p.Report == nil {
+		return false
+	}
+	for _, drop := range p.Report.Dropped {
+		if drop.Citation == citation && drop.Action == PromptActionDropped {
+			return true
+		}
+	}
+	return false
+}
+
+// PromptBuilder fits prompt sections into a token budget. It keeps the system prompt and
+// the message, shares the rest between documents, search results and history, and gives
+// up the lowest-ranked documents and search results and the oldest history first.
+type PromptBuilder struct {
+	contextWindow   int
+	maxOutputTokens int
+	estimate        TokenEstimator
+}
+
+// NewPromptBuilder creates a builder for a model with the given context window and reply length
+func NewPromptBuilder(contextWindow int, maxOutputTokens int) *PromptBuilder {
+	if contextWindow <= 0 {
+		contextWindow = defaultContextWindow
+	}
+	if maxOutputTokens < 0 || maxOutputTokens >= contextWindow {
+		maxOutputTokens = contextWindow / 4
+	}
+	return &PromptBuilder{contextWindow: contextWindow, maxOutputTokens: maxOutputTokens, estimate: EstimateTokens}
+}
+
+// PromptBuilderFor returns the builder matching a backend's context window and token
+// counting, reserving maxOutputTokens for the reply
+func PromptBuilderFor(backend LLMBackend, maxOutputTokens int) *PromptBuilder {
+	if limited, ok := backend.(PromptBudgetBackend); ok {
+		builder := NewPromptBuilder(limited.ContextWindow(), maxOutputTokens)
+		builder.estimate = limited.EstimateTokens
+		return builder
+	}
+	return NewPromptBuilder(ModelContextWindow(backend.GetModel()), maxOutputTokens)
+}
+
+// Build fits the sections into the budget and reports what had to be cut
+func (b *PromptBuilder) Build(sections PromptSections) *BuiltPrompt {
+	report := &models.PromptReport{
+		ContextWindow: b.contextWindow,
+		OutputReserve: b.maxOutputTokens,
+		Budget:        b.contextWindow - b.maxOutputTokens,
+	}
+	prompt := &BuiltPrompt{Report: report}
+
+	system := sections.System
+	if system == "" {
+		system = assistantInstructions
+	}
+	fixed := b.estimate(system) + promptFrameOverhead
+
+	// The message is never dropped, only shortened if it can't fit on its own
+	prompt.Message = sections.Message
+	messageTokens := b.estimate(prompt.Message) + promptItemOverhead
+	if room := report.Budget - fixed; messageTokens > room && room > promptItemOverhead {
+		prompt.Message = b.truncateToTokens(prompt.Message, room-promptItemOverhead)
+		trimmedTokens := b.estimate(prompt.Message) + promptItemOverhead
+		report.Dropped = append(report.Dropped, models.PromptDrop{
+			Section: PromptSectionMessage,
+			Action:  PromptActionTrimmed,
+			Tokens:  messageTokens - trimmedTokens,
+		})
+		messageTokens = trimmedTokens
+	}
+
+	remaining := report.Budget - fixed - messageTokens
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	historyNeed := 0
+	for _, msg := range sections.History {
+		historyNeed += b.estimate(msg.Content) + promptItemOverhead
+	}
+
+	allocation := allocateBudget(remaining,
+		[]string{PromptSectionDocuments, PromptSectionSearch, PromptSectionHistory},
+		[]int{b.blocksTokens(sections.Documents), b.blocksTokens(sections.Search), historyNeed},
+		[]float64{documentsShare, searchShare, historyShare})
+	report.Allocations = allocation
+
+	documents, documentsUsed := b.fitBlocks(PromptSectionDocuments, sections.Documents, allocation[PromptSectionDocuments], report)
+	search, searchUsed := b.fitBlocks(PromptSectionSearch, sections.Search, allocation[PromptSectionSearch], report)
+	prompt.Context = append(documents, search...)
+
+	history, summary, historyUsed := b.fitHistory(sections.History, allocation[PromptSectionHistory], report)
+	prompt.History = history
+	if summary != "" {
+		prompt.Context = append(prompt.Context, summary)
+	}
+
+	report.Used = fixed + messageTokens + documentsUsed + searchUsed + historyUsed
+	return prompt
+}
+
+// allocateBudget gives each section up to its share of the budget, then hands what's left
+// over to sections that need more, in priority order
+func allocateBudget(budget int, sections []string, needs []int, shares []float64) map[string]int {
+	allocation := make(map[string]int, len(sections))
+	left := budget
+	for i, section := range sections {
+		tokens := int(float64(budget) * shares[i])
+		if tokens > needs[i] {
+			tokens = needs[i]
+		}
+		allocation[section] = tokens
+		left -= tokens
+	}
+	for i, section := range sections {
+		if left <= 0 {
+			break
+		}
+		extra := needs[i] - allocation[section]
+		if extra > left {
+			extra = left
+		}
+		if extra > 0 {
+			allocation[section] += extra
+			left -= extra
+		}
+	}
+	return allocation
+}
+
+// blocksTokens estimates the tokens a list of context blocks needs
+func (b *PromptBuilder) blocksTokens(blocks []string) int {
+	total := 0
+	for _, block := range blocks {
+		total += b.estimate(block) + promptItemOverhead
+	}
+	return total
+}
+
+// citationPrefixPattern reads the number of a context block
+var citationPrefixPattern = regexp.MustCompile(`^\[(\d+)\]`)
+
+// blockCitation returns the number a context block is cited by, or 0
+func blockCitation(block string) int {
+	match := citationPrefixPattern.FindStringSubmatch(block)
+	if match == nil {
+		return 0
+	}
+	number, _ := strconv.Atoi(match[1])
+	return number
+}
+
+// fitBlocks keeps blocks in order while they fit. A block that doesn't fit is trimmed when
+// enough room is left for a useful part of it and dropped otherwise; later, shorter blocks
+// may still fit after it.
+func (b *PromptBuilder) fitBlocks(section string, blocks []string, budget int, report *models.PromptReport) ([]string, int) {
+	var kept []string
+	used := 0
+	for _, block := range blocks {
+		tokens := b.estimate(block) + promptItemOverhead
+		if used+tokens <= budget {
+			kept = append(kept, block)
+			used += tokens
+			continue
+		}
+
+		if room := budget - used - promptItemOverhead; room >= minTrimmedTokens {
+			trimmed := b.truncateToTokens(block, room)
+			trimmedTokens := b.estimate(trimmed) + promptItemOverhead
+			kept = append(kept, trimmed)
+			used += trimmedTokens
+			report.Dropped = append(report.Dropped, models.PromptDrop{
+				Section:  section,
+				Citation: blockCitation(block),
+				Action:   PromptActionTrimmed,
+				Tokens:   tokens - trimmedTokens,
+			})
+			continue
+		}
+
+		report.Dropped = append(report.Dropped, models.PromptDrop{
+			Section:  section,
+			Citation: blockCitation(block),
+			Action:   PromptActionDropped,
+			Tokens:   tokens,
+		})
+	}
+	return kept, used
+}
+
+// fitHistory keeps the most recent history messages that fit. Older messages are replaced
+// by a short summary of the user's earlier messages when there's room.
+func (b *PromptBuilder) fitHistory(history []models.ChatMessage, budget int, report *models.PromptReport) ([]models.ChatMessage, string, int) {
+	used := 0
+
+	start := len(history)
+	for start > 0 {
+		tokens := b.estimate(history[start-1].Content) + promptItemOverhead
+		if used+tokens > budget {
+			break
+		}
+		used += tokens
+		start--
+	}
+	keptHistory := history[start:]
+
+	if start == 0 {
+		return keptHistory, "", used
+	}
+
+	removed := 0
+	for _, msg := range history[:start] {
+		removed += b.estimate(msg.Content) + promptItemOverhead
+	}
+
+	summary := summarizeHistory(history[:start])
+	summaryTokens := b.estimate(summary) + promptItemOverhead
+	if summary != "" && used+summaryTokens > budget {
+		if room := budget - used - promptItemOverhead; room >= minTrimmedTokens {
+			summary = b.truncateToTokens(summary, room)
+			summaryTokens = b.estimate(summary) + promptItemOverhead
+		} else {
+			summary = ""
+		}
+	}
+
+	drop := models.PromptDrop{
+		Section: PromptSectionHistory,
+		Count:   start,
+		Action:  PromptActionDropped,
+		Tokens:  removed,
+	}
+	if summary != "" {
+		drop.Action = PromptActionSummarized
+		drop.Tokens = removed - summaryTokens
+		used += summaryTokens
+	}
+	report.Dropped = append(report.Dropped, drop)
+
+	return keptHistory, summary, used
+}
+
+// summarizeHistory condenses earlier messages to the opening words of each user message
+func summarizeHistory(history []models.ChatMessage) string {
+	var topics []string
+	for _, msg := range history {
+		if msg.Role == "assistant" {
+			continue
+		}
+		words := strings.Fields(msg.Content)
+		if len(words) == 0 {
+			continue
+		}
+		if len(words) > summaryWordsPerMessage {
+			words = append(words[:summaryWordsPerMessage], "...")
+		}
+		topics = append(topics, strings.Join(words, " "))
+	}
+	if len(topics) == 0 {
+		return ""
+	}
+	return "[Earlier Conversation] The user previously asked: " + strings.Join(topics, "; ")
+}
+
+// truncateToTokens shortens text to roughly the given number of tokens, cutting between words
+func (b *PromptBuilder) truncateToTokens(text string, maxTokens int) string {
+	words := strings.Fields(text)
+	used := b.estimate("...")
+	for i, word := range words {
+		tokens := b.estimate(word)
+		if used+tokens > maxTokens {
+			return strings.Join(words[:i], " ") + " ..."
+		}
+		used += tokens
+	}
+	return strings.Join(words, " ")
+}
@@ -0,0 +1,57 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"chatbot/models"
+)
+
+// charBackend is a backend whose tokenizer counts every character as a token
+type charBackend struct {
+	fakeBackend
+}
+
+func (f *charBackend) ContextWindow() int             { return 1000 }
+func (f *charBackend) EstimateTokens(text string) int { return len(text) }
+
+func TestPromptBuilderUsesBackendTokenCount(t *testing.T) {
+	sections := PromptSections{
+		System:    "Answer.",
+		Documents: []string{strings.Repeat("a", 300), strings.Repeat("b", 300), strings.Repeat("c", 300)},
+		Message:   "question",
+	}
+
+	heuristic := NewPromptBuilder(1000, 100).Build(sections)
+	if len(heuristic.Report.Dropped) != 0 {
+		t.Fatalf("the word heuristic should fit every block, cut %+v", heuristic.Report.Dropped)
+	}
+
+	counted := PromptBuilderFor(&charBackend{fakeBackend{name: ProviderLocal}}, 100).Build(sections)
+	if len(counted.Report.Dropped) == 0 {
+		t.Error("the backend's token count should cut blocks")
+	}
+	if counted.Report.Used > counted.Report.Budget {
+		t.Errorf("used %d tokens of a %d token budget", counted.Report.Used, counted.Report.Budget)
+	}
+}
+
+func TestFitBlocksSkipsOnlyBlocksThatDontFit(t *testing.T) {
+	builder := NewPromptBuilder(1000, 100)
+	short := "[1] short block"
+	long := "[2] " + strings.Repeat("word ", 20)
+	budget := 2*(builder.estimate(short)+promptItemOverhead) + 10
+
+	report := &models.PromptReport{}
+	kept, used := builder.fitBlocks(PromptSectionDocuments, []string{short, long, short}, budget, report)
+
+	if len(kept) != 2 || kept[0] != short || kept[1] != short {
+		t.Fatalf("the long block should be dropped and the later short block kept, got %q", kept)
+	}
+	if used > budget {
+		t.Errorf("used %d tokens of %d", used, budget)
+	}
+	if len(report.Dropped) != 1 || report.Dropped[0].Citation != 2 {
+		t.Errorf("dropped = %+v, want block 2", report.Dropped)
+	}
+}
@@ -2,21 +2,29 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"io/fs"
 	"log"
+	"math"
 	"os"
 	"path/filepath"
-	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"chatbot/models"
+	"chatbot/utils"
 
 	"github.com/philippgille/chromem-go"
 )
 
+// ErrDocumentNotFound is returned when a source is not in the index
+var ErrDocumentNotFound = errors.New("document not found in index")
+
 // RAGService handles document storage and retrieval using chromem-go
 type RAGService struct {
 	db               *chromem.DB
@@ -24,73 +32,179 @@ type RAGService struct {
 	initialized      bool
 	dataPath         string
 	collectionName   string
+	persistPath      string
+	manifest         *IndexManifest
+	indexMutex       sync.Mutex
+	collectionMutex  sync.RWMutex // Held for writing while chunks are deleted, so queries see a stable count
 	discordMessages  map[string][]*models.DiscordMessage
 	messagesMutex    sync.RWMutex
 	embeddingEnabled bool
+	chunkStrategy    string
+	chunkSize        int
+	chunkOverlap     int
+	config           models.RAGConfig
+	embedder         string
+	keywordIndex     *BM25Index
+	embed            chromem.EmbeddingFunc
+	threshold        float64
+	vectorWeight     float64
+	keywordWeight    float64
+	rrfK             float64
+	reranker         Reranker
+	rerankCandidates int
+}
+
+// NewRAGConfigFromEnv returns the RAG configuration with environment overrides applied
+func NewRAGConfigFromEnv() models.RAGConfig {
+	config := models.RAGConfig{
+		Enabled:             true,
+		DataPath:            os.Getenv("RAG_DATA_PATH"),
+		CollectionName:      os.Getenv("RAG_COLLECTION"),
+		EmbeddingEnabled:    true,
+		EmbeddingProvider:   os.Getenv("RAG_EMBEDDING_PROVIDER"),
+		EmbeddingModel:      os.Getenv("RAG_EMBEDDING_MODEL"),
+		EmbeddingURL:        os.Getenv("RAG_EMBEDDING_URL"),
+		EmbeddingDimensions: utils.GetEnvInt("RAG_EMBEDDING_DIMENSIONS", defaultHashDimensions),
+		Chunker:             os.Getenv("RAG_CHUNKER"),
+		ChunkSize:           utils.GetEnvInt("RAG_CHUNK_SIZE", 256),
+		ChunkOverlap:        utils.GetEnvInt("RAG_CHUNK_OVERLAP", 32),
+		PersistPath:         os.Getenv("RAG_PERSIST_PATH"),
+	}
+
+	if config.DataPath == "" {
+		config.DataPath = "./data"
+	}
+	if config.CollectionName == "" {
+		config.CollectionName = "chatbot_knowledge"
+	}
+	if config.Chunker == "" {
+		config.Chunker = ChunkerAuto
+	}
+
+	return config
 }
 
 // NewRAGService creates a new RAG service instance
-func NewRAGService(dataPath, collectionName string, embeddingEnabled bool) *RAGService {
+func NewRAGService(config models.RAGConfig) *RAGService {
 	return &RAGService{
-		dataPath:         dataPath,
-		collectionName:   collectionName,
+		dataPath:         config.DataPath,
+		collectionName:   config.CollectionName,
+		persistPath:      config.PersistPath,
+		manifest:         newIndexManifest(),
 		discordMessages:  make(map[string][]*models.DiscordMessage),
-		embeddingEnabled: embeddingEnabled,
+		embeddingEnabled: config.EmbeddingEnabled,
+		chunkStrategy:    config.Chunker,
+		chunkSize:        config.ChunkSize,
+		chunkOverlap:     config.ChunkOverlap,
+		config:           config,
+		keywordIndex:     NewBM25Index(),
+		vectorWeight:     utils.GetEnvFloat("RAG_VECTOR_WEIGHT", 1.0),
+		keywordWeight:    utils.GetEnvFloat("RAG_KEYWORD_WEIGHT", 1.0),
+		rrfK:             utils.GetEnvFloat("RAG_RRF_K", 60),
+		threshold:        utils.GetEnvFloat("RAG_THRESHOLD", 0),
+		rerankCandidates: utils.GetEnvInt("RAG_RERANK_CANDIDATES", 20),
 		initialized:      false,
 	}
 }
 
-// Initialize sets up the chromem database and collection
+// Initialize sets up the chromem database and collection.
+// With a persist path the database is stored on disk and an existing collection is loaded.
 func (r *RAGService) Initialize() error {
-	// Create chromem database
-	db := chromem.NewDB()
+	// Fail early on a bad chunking configuration rather than on the first file
+	if _, err := r.chunkerFor("example.txt"); err != nil {
+		return fmt.Errorf("invalid chunking configuration: %w", err)
+	}
 
-	var collection *chromem.Collection
+	var db *chromem.DB
 	var err error
 
-	if r.embeddingEnabled {
-		// Use OpenAI embeddings if enabled
-		openaiAPIKey := os.Getenv("OPENAI_API_KEY")
-		if openaiAPIKey == "" {
-			log.Printf("OpenAI API key not found, using default embeddings")
-			collection, err = db.GetOrCreateCollection(r.collectionName, nil, nil)
-		} else {
-			// Create embedding function for OpenAI
-			embeddingFunc := chromem.NewEmbeddingFuncOpenAI(openaiAPIKey, chromem.EmbeddingModelOpenAI3Small)
-			collection, err = db.GetOrCreateCollection(r.collectionName, nil, embeddingFunc)
+	if r.persistPath != "" {
+		db, err = chromem.NewPersistentDB(r.persistPath, false)
+		if err != nil {
+			return fmt.Errorf("failed to open persistent database at %s: %w", r.persistPath, err)
 		}
 	} else {
-		// Use default embeddings (local)
-		collection, err = db.GetOrCreateCollection(r.collectionName, nil, nil)
+		// Create in-memory chromem database
+		db = chromem.NewDB()
+	}
+
+	embeddingFunc, embedder, err := NewEmbeddingFunc(r.config)
+	if err != nil {
+		return fmt.Errorf("failed to set up embeddings: %w", err)
 	}
 
+	collection, err := db.GetOrCreateCollection(r.collectionName, nil, embeddingFunc)
 	if err != nil {
 		return fmt.Errorf("failed to create collection: %w", err)
 	}
 
 	r.db = db
 	r.collection = collection
+	r.embedder = embedder
+	r.embed = embeddingFunc
 	r.initialized = true
 
-	log.Printf("RAG service initialized with collection: %s, embedding enabled: %v", r.collectionName, r.embeddingEnabled)
+	if path := r.manifestPath(); path != "" {
+		manifest, err := loadIndexManifest(path)
+		if err != nil {
+			log.Printf("Ignoring unreadable index manifest, all files will be re-indexed: %v", err)
+		} else {
+			r.manifest = manifest
+		}
+	}
+
+	// Chunks built with other settings are stale even if the files haven't changed
+	if settings := r.indexSettings(); len(r.manifest.Files) > 0 && r.manifest.Settings != settings {
+		log.Printf("Indexing settings changed (%s), all files will be re-indexed", settings)
+		for _, entry := range r.manifest.Files {
+			entry.Hash = ""
+		}
+	}
+	r.manifest.Settings = r.indexSettings()
+
+	r.rebuildKeywordIndex()
+
+	if r.persistPath != "" {
+		log.Printf("RAG service loaded persistent collection %s from %s with %d chunks", r.collectionName, r.persistPath, collection.Count())
+	}
+
+	log.Printf("RAG service initialized with collection: %s, embeddings: %s", r.collectionName, r.embedder)
 	return nil
 }
 
 // IndexDocuments processes and indexes documents from the data folder
 func (r *RAGService) IndexDocuments() error {
+	result, err := r.Reindex(false)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Indexed %d files (%d unchanged, %d removed, %d errors) from %s in %s",
+		result.IndexedCount, result.SkippedCount, result.DeletedCount, result.ErrorCount, r.dataPath, result.Duration)
+	return nil
+}
+
+// Reindex synchronizes the collection with the data folder. Only new or changed files
+// are embedded and chunks of deleted files are removed; force re-embeds every file.
+func (r *RAGService) Reindex(force bool) (*models.DocumentIndexResponse, error) {
 	if !r.initialized {
-		return fmt.Errorf("RAG service not initialized")
+		return nil, fmt.Errorf("RAG service not initialized")
 	}
 
 	if r.dataPath == "" {
-		return fmt.Errorf("data path not set")
+		return nil, fmt.Errorf("data path not set")
 	}
 
+	r.indexMutex.Lock()
+	defer r.indexMutex.Unlock()
+
+	start := time.Now()
+
 	// Check if data path exists
 	if _, err := os.Stat(r.dataPath); os.IsNotExist(err) {
 		log.Printf("Data path %s does not exist, creating it", r.dataPath)
 		if err := os.MkdirAll(r.dataPath, 0755); err != nil {
-			return fmt.Errorf("failed to create data path: %w", err)
+			return nil, fmt.Errorf("failed to create data path: %w", err)
 		}
 
 		// Create example file
@@ -103,130 +217,698 @@ func (r *RAGService) IndexDocuments() error {
 		}
 	}
 
-	var documents []models.RAGDocument
+	paths, err := r.collectFiles(r.dataPath, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to walk data directory: %w", err)
+	}
 
-	// Walk through data directory
-	err := filepath.WalkDir(r.dataPath, func(path string, d fs.DirEntry, err error) error {
+	result := newIndexResult()
+	seen := make(map[string]bool)
+
+	for _, path := range paths {
+		relPath, err := r.relativePath(path)
+		if err != nil {
+			return nil, err
+		}
+		seen[relPath] = true
+
+		r.indexFile(path, relPath, force, result)
+	}
+
+	// Remove chunks of files that no longer exist
+	for _, relPath := range r.manifest.sortedPaths() {
+		if !seen[relPath] {
+			r.removeFile(relPath, result)
+		}
+	}
+
+	r.saveManifest()
+
+	result.Duration = time.Since(start).String()
+	return result, nil
+}
+
+// IndexFiles re-indexes only the given files or directories inside the data folder.
+// Directories include their subfolders when recursive is set. Paths that no longer
+// exist have their chunks removed.
+func (r *RAGService) IndexFiles(paths []string, recursive bool, force bool) (*models.DocumentIndexResponse, error) {
+	if !r.initialized {
+		return nil, fmt.Errorf("RAG service not initialized")
+	}
+
+	r.indexMutex.Lock()
+	defer r.indexMutex.Unlock()
+
+	start := time.Now()
+	result := newIndexResult()
+
+	for _, path := range paths {
+		relPath, err := r.relativePath(path)
+		if err != nil || relPath == ".." || strings.HasPrefix(relPath, "../") {
+			log.Printf("Skipping %s: outside data path %s", path, r.dataPath)
+			result.ErrorCount++
+			continue
+		}
+
+		info, err := os.Stat(path)
+		switch {
+		case os.IsNotExist(err):
+			r.removePath(relPath, result)
+		case err != nil:
+			log.Printf("Failed to stat %s: %v", path, err)
+			result.ErrorCount++
+		case info.IsDir():
+			files, err := r.collectFiles(path, recursive)
+			if err != nil {
+				log.Printf("Failed to walk %s: %v", path, err)
+				result.ErrorCount++
+				continue
+			}
+			for _, file := range files {
+				fileRelPath, err := r.relativePath(file)
+				if err != nil {
+					result.ErrorCount++
+					continue
+				}
+				r.indexFile(file, fileRelPath, force, result)
+			}
+		case r.isIndexable(path):
+			r.indexFile(path, relPath, force, result)
+		default:
+			result.SkippedCount++
+		}
+	}
+
+	r.saveManifest()
+
+	result.Duration = time.Since(start).String()
+	return result, nil
+}
+
+// collectFiles returns the supported, non-hidden files under root
+func (r *RAGService) collectFiles(root string, recursive bool) ([]string, error) {
+	var paths []string
+
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
 
-		// Skip directories and hidden files
-		if d.IsDir() || strings.HasPrefix(d.Name(), ".") {
+		if d.IsDir() {
+			// Skip hidden folders and, unless recursive, anything below root
+			if path != root && (strings.HasPrefix(d.Name(), ".") || !recursive) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if strings.HasPrefix(d.Name(), ".") {
 			return nil
 		}
 
 		// Process supported file types
-		ext := strings.ToLower(filepath.Ext(path))
-		if !r.isSupportedFileType(ext) {
+		if !r.isIndexable(path) {
 			log.Printf("Skipping unsupported file type: %s", path)
 			return nil
 		}
 
-		content, err := r.extractTextFromFile(path)
+		paths = append(paths, path)
+		return nil
+	})
+
+	return paths, err
+}
+
+// isIndexable checks whether a file is visible and of a supported type
+func (r *RAGService) isIndexable(path string) bool {
+	if strings.HasPrefix(filepath.Base(path), ".") {
+		return false
+	}
+	return r.isSupportedFileType(path)
+}
+
+// removePath removes a deleted file, or every indexed file below a deleted directory
+func (r *RAGService) removePath(relPath string, result *models.DocumentIndexResponse) {
+	if _, known := r.manifest.Files[relPath]; known {
+		r.removeFile(relPath, result)
+		return
+	}
+
+	prefix := relPath + "/"
+	for _, indexedPath := range r.manifest.sortedPaths() {
+		if strings.HasPrefix(indexedPath, prefix) {
+			r.removeFile(indexedPath, result)
+		}
+	}
+}
+
+// ResolvePath maps a path relative to the data folder (or an absolute path inside it)
+// to a filesystem path, rejecting anything outside the data folder
+func (r *RAGService) ResolvePath(path string) (string, error) {
+	fullPath := path
+	if !filepath.IsAbs(fullPath) {
+		fullPath = filepath.Join(r.dataPath, filepath.FromSlash(path))
+	}
+
+	relPath, err := r.relativePath(fullPath)
+	if err != nil {
+		return "", err
+	}
+	if relPath == ".." || strings.HasPrefix(relPath, "../") {
+		return "", fmt.Errorf("path %s is outside the data folder", path)
+	}
+
+	return filepath.Join(r.dataPath, filepath.FromSlash(relPath)), nil
+}
+
+// SaveDocument writes an uploaded document into the data folder and returns its path
+func (r *RAGService) SaveDocument(dir string, name string, content io.Reader) (string, error) {
+	name = filepath.Base(name)
+	if name == "." || name == string(filepath.Separator) || strings.HasPrefix(name, ".") {
+		return "", fmt.Errorf("invalid file name: %s", name)
+	}
+	if !r.isIndexable(name) {
+		return "", fmt.Errorf("unsupported file type: %s", filepath.Ext(name))
+	}
+
+	dirPath, err := r.ResolvePath(dir)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dirPath, 0755); err != nil {
+		return "", fmt.Errorf("failed to create folder: %w", err)
+	}
+
+	path := filepath.Join(dirPath, name)
+	file, err := os.Create(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to create %s: %w", name, err)
+	}
+	defer file.Close()
+
+	if _, err := io.Copy(file, content); err != nil {
+		return "", fmt.Errorf("failed to write %s: %w", name, err)
+	}
+
+	return path, nil
+}
+
+// ListDocuments returns every indexed source with its chunk count
+func (r *RAGService) ListDocuments() []models.DocumentInfo {
+	r.indexMutex.Lock()
+	defer r.indexMutex.Unlock()
+
+	documents := make([]models.DocumentInfo, 0, len(r.manifest.Files))
+	for _, relPath := range r.manifest.sortedPaths() {
+		entry := r.manifest.Files[relPath]
+		documents = append(documents, models.DocumentInfo{
+			Source:     relPath,
+			ChunkCount: len(entry.ChunkIDs),
+			Hash:       entry.Hash,
+			IndexedAt:  entry.IndexedAt,
+			Tags:       entry.Tags,
+		})
+	}
+	return documents
+}
+
+// TagFiles sets custom tags on files, or on every file below a directory, replacing their
+// previous tags. The files are marked as changed so the next pass stores the tags on their chunks.
+func (r *RAGService) TagFiles(paths []string, tags map[string]string) error {
+	if err := ValidateTags(tags); err != nil {
+		return err
+	}
+
+	r.indexMutex.Lock()
+	defer r.indexMutex.Unlock()
+
+	for _, path := range paths {
+		info, err := os.Stat(path)
 		if err != nil {
-			log.Printf("Failed to extract text from %s: %v", path, err)
-			return nil
+			return fmt.Errorf("cannot tag %s: %w", path, err)
 		}
 
-		// Create document chunks
-		chunks := r.chunkText(content, 500) // 500 character chunks
-		for i, chunk := range chunks {
-			doc := models.RAGDocument{
-				ID:      fmt.Sprintf("%s_chunk_%d", strings.TrimSuffix(d.Name(), ext), i),
-				Content: chunk,
-				Source:  path,
-				Metadata: map[string]interface{}{
-					"file_name":    d.Name(),
-					"file_path":    path,
-					"file_type":    ext,
-					"chunk_index":  i,
-					"total_chunks": len(chunks),
-					"indexed_at":   time.Now().UTC().Format(time.RFC3339),
-				},
+		files := []string{path}
+		if info.IsDir() {
+			if files, err = r.collectFiles(path, true); err != nil {
+				return fmt.Errorf("failed to scan %s: %w", path, err)
 			}
-			documents = append(documents, doc)
 		}
 
-		return nil
-	})
+		for _, file := range files {
+			relPath, err := r.relativePath(file)
+			if err != nil {
+				return err
+			}
 
+			entry, exists := r.manifest.Files[relPath]
+			if !exists {
+				entry = &ManifestEntry{}
+				r.manifest.Files[relPath] = entry
+			}
+			entry.Tags = tags
+			entry.Hash = ""
+		}
+	}
+
+	return nil
+}
+
+// DeleteDocument removes an indexed source from the collection and the data folder
+func (r *RAGService) DeleteDocument(source string) (*models.DocumentIndexResponse, error) {
+	if !r.initialized {
+		return nil, fmt.Errorf("RAG service not initialized")
+	}
+
+	path, err := r.ResolvePath(source)
+	if err != nil {
+		return nil, err
+	}
+	relPath, err := r.relativePath(path)
 	if err != nil {
-		return fmt.Errorf("failed to walk data directory: %w", err)
+		return nil, err
 	}
 
-	// Add documents to collection
-	if len(documents) == 0 {
-		log.Printf("No documents found to index in %s", r.dataPath)
-		return nil
+	r.indexMutex.Lock()
+	defer r.indexMutex.Unlock()
+
+	if _, known := r.manifest.Files[relPath]; !known {
+		return nil, ErrDocumentNotFound
+	}
+
+	start := time.Now()
+	result := newIndexResult()
+
+	// Remove the file first so the watcher or a later re-index doesn't add it back
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to delete %s: %w", relPath, err)
+	}
+
+	r.removeFile(relPath, result)
+	r.saveManifest()
+
+	result.Files = append(result.Files, relPath)
+	result.Duration = time.Since(start).String()
+	return result, nil
+}
+
+// newIndexResult creates an empty successful indexing result
+func newIndexResult() *models.DocumentIndexResponse {
+	return &models.DocumentIndexResponse{
+		BaseResponse: models.BaseResponse{
+			Status:    models.StatusSuccess,
+			Timestamp: time.Now(),
+		},
+		Files: []string{},
+	}
+}
+
+// indexFile embeds a single file if it is new, changed or force is set, replacing its previous chunks
+func (r *RAGService) indexFile(path string, relPath string, force bool, result *models.DocumentIndexResponse) {
+	hash, err := hashFile(path)
+	if err != nil {
+		log.Printf("Failed to read %s: %v", path, err)
+		result.ErrorCount++
+		return
+	}
+
+	previous, known := r.manifest.Files[relPath]
+	if known && !force && previous.Hash == hash {
+		result.SkippedCount++
+		return
 	}
 
-	for _, doc := range documents {
-		// Convert metadata to map[string]string for chromem-go
-		metadata := make(map[string]string)
-		for k, v := range doc.Metadata {
-			metadata[k] = fmt.Sprintf("%v", v)
+	sections, err := r.extractTextFromFile(path)
+	if err != nil {
+		log.Printf("Failed to extract text from %s: %v", path, err)
+		result.ErrorCount++
+		return
+	}
+
+	ctx := context.Background()
+
+	// Files indexed before the manifest existed used other chunk IDs; clear them by path
+	if !known {
+		if err := r.deleteChunks(ctx, map[string]string{"file_path": path}); err != nil {
+			log.Printf("Failed to clear previous chunks of %s: %v", path, err)
+		}
+	}
+
+	ext := strings.ToLower(filepath.Ext(path))
+	indexedAt := time.Now().UTC()
+
+	chunker, err := r.chunkerFor(path)
+	if err != nil {
+		log.Printf("Failed to chunk %s: %v", path, err)
+		result.ErrorCount++
+		return
+	}
+
+	// Create document chunks, keeping each one within a single page or section
+	type sectionChunk struct {
+		Chunk
+		section DocumentSection
+	}
+	var chunks []sectionChunk
+	for _, section := range sections {
+		for _, chunk := range chunker.Chunk(section.Text) {
+			if section.Title != "" {
+				chunk.HeadingPath = append([]string{section.Title}, chunk.HeadingPath...)
+			}
+			chunks = append(chunks, sectionChunk{Chunk: chunk, section: section})
 		}
+	}
+
+	chunkIDs := make([]string, 0, len(chunks))
+	failed := false
 
-		err := r.collection.AddDocument(context.Background(), chromem.Document{
-			ID:       doc.ID,
-			Content:  doc.Content,
+	for i, chunk := range chunks {
+		id := chunkID(relPath, i)
+
+		metadata := map[string]string{
+			"file_name":     filepath.Base(path),
+			"file_path":     path,
+			"relative_path": relPath,
+			"file_type":     ext,
+			"content_hash":  hash,
+			"chunk_index":   strconv.Itoa(i),
+			"total_chunks":  strconv.Itoa(len(chunks)),
+			"indexed_at":    indexedAt.Format(time.RFC3339),
+			"chunker":       chunker.Name(),
+			"tokens":        strconv.Itoa(EstimateTokens(chunk.Text)),
+		}
+		if chunk.section.Page > 0 {
+			metadata["page"] = strconv.Itoa(chunk.section.Page)
+		}
+		if chunk.section.Number > 0 {
+			metadata["section"] = strconv.Itoa(chunk.section.Number)
+		}
+		if chunk.section.Title != "" {
+			metadata["section_title"] = chunk.section.Title
+		}
+		if len(chunk.HeadingPath) > 0 {
+			metadata["heading_path"] = strings.Join(chunk.HeadingPath, " > ")
+		}
+		if known {
+			for key, value := range previous.Tags {
+				metadata[tagMetadataPrefix+key] = value
+			}
+		}
+
+		err := r.collection.AddDocument(ctx, chromem.Document{
+			ID:       id,
+			Content:  chunk.Text,
 			Metadata: metadata,
 		})
 		if err != nil {
-			log.Printf("Failed to add document %s: %v", doc.ID, err)
+			log.Printf("Failed to add document %s: %v", id, err)
+			failed = true
 			continue
 		}
+		r.keywordIndex.Add(id, chunk.Text, metadata)
+		chunkIDs = append(chunkIDs, id)
 	}
 
-	log.Printf("Indexed %d document chunks from %s", len(documents), r.dataPath)
-	return nil
+	// Drop chunks the new version of the file no longer has
+	if known {
+		current := make(map[string]bool, len(chunkIDs))
+		for _, id := range chunkIDs {
+			current[id] = true
+		}
+
+		var stale []string
+		for _, id := range previous.ChunkIDs {
+			if !current[id] {
+				stale = append(stale, id)
+			}
+		}
+		if len(stale) > 0 {
+			if err := r.deleteChunks(ctx, nil, stale...); err != nil {
+				log.Printf("Failed to remove stale chunks of %s: %v", relPath, err)
+			}
+			r.keywordIndex.Remove(stale...)
+		}
+	}
+
+	entry := &ManifestEntry{
+		Hash:      hash,
+		ChunkIDs:  chunkIDs,
+		IndexedAt: indexedAt,
+	}
+	if known {
+		entry.Tags = previous.Tags
+	}
+	if failed {
+		// Leave the hash empty so the file is retried on the next pass
+		entry.Hash = ""
+		result.ErrorCount++
+	} else {
+		result.IndexedCount++
+		result.Files = append(result.Files, relPath)
+	}
+	r.manifest.Files[relPath] = entry
 }
 
-// Query searches for relevant documents and context
-func (r *RAGService) Query(query string, channelID string, limit int) (*models.RAGResponse, error) {
+// removeFile deletes the chunks of a file that is no longer in the data folder
+func (r *RAGService) removeFile(relPath string, result *models.DocumentIndexResponse) {
+	entry := r.manifest.Files[relPath]
+	if entry != nil && len(entry.ChunkIDs) > 0 {
+		if err := r.deleteChunks(context.Background(), nil, entry.ChunkIDs...); err != nil {
+			log.Printf("Failed to remove chunks of deleted file %s: %v", relPath, err)
+			result.ErrorCount++
+			return
+		}
+		r.keywordIndex.Remove(entry.ChunkIDs...)
+	}
+
+	delete(r.manifest.Files, relPath)
+	result.DeletedCount++
+	log.Printf("Removed %s from the index", relPath)
+}
+
+// deleteChunks removes chunks from the collection by metadata or ID. Queries can't run
+// meanwhile, since chromem rejects requests for more results than the collection holds.
+func (r *RAGService) deleteChunks(ctx context.Context, where map[string]string, ids ...string) error {
+	r.collectionMutex.Lock()
+	defer r.collectionMutex.Unlock()
+	return r.collection.Delete(ctx, where, nil, ids...)
+}
+
+// relativePath returns a file's slash-separated path relative to the data folder
+func (r *RAGService) relativePath(path string) (string, error) {
+	base, err := filepath.Abs(r.dataPath)
+	if err != nil {
+		return "", err
+	}
+	target, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+
+	relPath, err := filepath.Rel(base, target)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %s relative to %s: %w", path, r.dataPath, err)
+	}
+	return filepath.ToSlash(relPath), nil
+}
+
+// manifestPath returns where the manifest is stored, or "" when the index is in memory only
+func (r *RAGService) manifestPath() string {
+	if r.persistPath == "" {
+		return ""
+	}
+	return filepath.Join(r.persistPath, r.collectionName+".manifest.json")
+}
+
+// saveManifest persists the manifest alongside a persistent index
+func (r *RAGService) saveManifest() {
+	path := r.manifestPath()
+	if path == "" {
+		return
+	}
+	if err := r.manifest.save(path); err != nil {
+		log.Printf("Failed to save index manifest: %v", err)
+	}
+}
+
+// SetReranker sets the stage that reorders retrieved chunks; nil disables re-ranking
+func (r *RAGService) SetReranker(reranker Reranker) {
+	r.reranker = reranker
+}
+
+// Query searches the documents with vector similarity and BM25 keyword search and merges
+// the two rankings with weighted reciprocal-rank fusion. ctx bounds the embedding and
+// re-ranking calls.
+func (r *RAGService) Query(ctx context.Context, query models.RAGQuery) (*models.RAGResponse, error) {
 	if !r.initialized {
 		return nil, fmt.Errorf("RAG service not initialized")
 	}
 
+	limit := query.Limit
 	if limit <= 0 {
 		limit = 5
 	}
 
+	vectorWeight := r.vectorWeight
+	if query.VectorWeight != nil {
+		vectorWeight = *query.VectorWeight
+	}
+	keywordWeight := r.keywordWeight
+	if query.KeywordWeight != nil {
+		keywordWeight = *query.KeywordWeight
+	}
+	if vectorWeight < 0 || keywordWeight < 0 {
+		return nil, fmt.Errorf("search weights must not be negative")
+	}
+
+	threshold := r.threshold
+	if query.Threshold != nil {
+		threshold = *query.Threshold
+	}
+
+	filter, err := newSearchFilter(query.Filter)
+	if err != nil {
+		return nil, err
+	}
+
+	// With a reranker, retrieve a larger candidate pool and let it pick the best chunks
+	reranker := r.reranker
+	if query.Rerank != nil && !*query.Rerank {
+		reranker = nil
+	}
+	retrieve := limit
+	if reranker != nil && r.rerankCandidates > retrieve {
+		retrieve = r.rerankCandidates
+	}
+
+	queryEmbedding, err := r.embed(ctx, query.Query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed query: %w", err)
+	}
+
 	// Get Discord message context if available
 	var msgContext []string
-	if channelID != "" {
-		msgContext = r.getDiscordContext(channelID, 10)
+	if query.ChannelID != "" {
+		msgContext = r.getDiscordContext(query.ChannelID, 10)
 	}
 
-	// Search documents
-	results, err := r.collection.Query(context.Background(), query, limit, nil, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to query collection: %w", err)
+	// Each retriever returns more candidates than needed so fusion has something to work with
+	candidates := retrieve * 4
+	if candidates < 20 {
+		candidates = 20
 	}
 
-	// Convert results to our format
-	var documents []models.RAGDocument
-	for _, result := range results {
-		// Convert metadata back to map[string]interface{}
-		metadata := make(map[string]interface{})
-		for k, v := range result.Metadata {
-			metadata[k] = v
+	fused := make(map[string]*models.RAGDocument)
+	var order []string
+
+	fuse := func(id string, content string, metadata map[string]string) *models.RAGDocument {
+		doc, exists := fused[id]
+		if !exists {
+			meta := make(map[string]interface{}, len(metadata))
+			for k, v := range metadata {
+				meta[k] = v
+			}
+			doc = &models.RAGDocument{
+				ID:       id,
+				Content:  content,
+				Source:   r.getSourceFromMetadata(meta),
+				Metadata: meta,
+				Scores:   &models.RetrievalScores{},
+			}
+			fused[id] = doc
+			order = append(order, id)
 		}
+		return doc
+	}
 
-		doc := models.RAGDocument{
-			ID:       result.ID,
-			Content:  result.Content,
-			Source:   r.getSourceFromMetadata(metadata),
-			Metadata: metadata,
-			Score:    result.Similarity, // chromem-go uses Similarity field
+	if vectorWeight > 0 {
+		// Conditions chromem can't evaluate are checked afterwards, so consider every chunk.
+		// Chunks can't be deleted between counting and querying, or n could exceed the count.
+		r.collectionMutex.RLock()
+		n := candidates
+		count := r.collection.Count()
+		if n > count || filter.needsPostFilter {
+			n = count
+		}
+		var results []chromem.Result
+		if n > 0 {
+			results, err = r.collection.QueryEmbedding(ctx, queryEmbedding, n, filter.where, filter.whereDocument)
+		}
+		r.collectionMutex.RUnlock()
+		if err != nil {
+			return nil, fmt.Errorf("failed to query collection: %w", err)
+		}
+
+		rank := 0
+		for _, result := range results {
+			if filter.needsPostFilter && !filter.accept(result.Content, result.Metadata) {
+				continue
+			}
+			if rank == candidates {
+				break
+			}
+			doc := fuse(result.ID, result.Content, result.Metadata)
+			doc.Scores.Vector = result.Similarity
+			doc.Scores.VectorRank = rank + 1
+			doc.Scores.Fused += vectorWeight / (r.rrfK + float64(rank+1))
+			rank++
+		}
+	}
+
+	if keywordWeight > 0 {
+		for rank, hit := range r.keywordIndex.Search(query.Query, candidates, filter.accept) {
+			doc := fuse(hit.ID, hit.Content, hit.Metadata)
+			doc.Scores.Keyword = hit.Score
+			doc.Scores.KeywordRank = rank + 1
+			doc.Scores.Fused += keywordWeight / (r.rrfK + float64(rank+1))
+		}
+	}
+
+	// Scale so that a chunk ranked first by every enabled retriever scores 1.0
+	maxFused := (vectorWeight + keywordWeight) / (r.rrfK + 1)
+
+	documents := make([]models.RAGDocument, 0, len(order))
+	for _, id := range order {
+		doc := fused[id]
+
+		// Keyword-only hits get their similarity computed so the threshold applies to every chunk
+		if doc.Scores.VectorRank == 0 {
+			if stored, err := r.collection.GetByID(ctx, id); err == nil {
+				doc.Scores.Vector = cosineSimilarity(queryEmbedding, stored.Embedding)
+			}
 		}
-		documents = append(documents, doc)
+		if threshold > 0 && float64(doc.Scores.Vector) < threshold {
+			continue
+		}
+
+		if maxFused > 0 {
+			doc.Score = float32(doc.Scores.Fused / maxFused)
+		}
+		documents = append(documents, *doc)
+	}
+
+	sort.SliceStable(documents, func(i, j int) bool {
+		return documents[i].Scores.Fused > documents[j].Scores.Fused
+	})
+	if len(documents) > retrieve {
+		documents = documents[:retrieve]
+	}
+
+	if reranker != nil {
+		reranked, err := reranker.Rerank(ctx, query.Query, documents, limit)
+		if err != nil {
+			log.Printf("Re-ranking failed, keeping retrieval order: %v", err)
+		} else {
+			documents = reranked
+		}
+	}
+	if len(documents) > limit {
+		documents = documents[:limit]
 	}
 
 	return &models.RAGResponse{
 		Documents: documents,
-		Query:     query,
+		Query:     query.Query,
 		Context:   msgContext,
 		Timestamp: time.Now(),
 		Total:     len(documents),
@@ -237,6 +919,47 @@ func (r *RAGService) Query(query string, channelID string, limit int) (*models.R
 	}, nil
 }
 
+// cosineSimilarity returns the cosine of the angle between two vectors
+func cosineSimilarity(a []float32, b []float32) float32 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return float32(dot / (math.Sqrt(normA) * math.Sqrt(normB)))
+}
+
+// rebuildKeywordIndex loads the chunks listed in the manifest into the keyword index,
+// which lives in memory and is empty after a restart with a persistent vector store
+func (r *RAGService) rebuildKeywordIndex() {
+	ctx := context.Background()
+	loaded := 0
+
+	for _, relPath := range r.manifest.sortedPaths() {
+		for _, id := range r.manifest.Files[relPath].ChunkIDs {
+			doc, err := r.collection.GetByID(ctx, id)
+			if err != nil {
+				log.Printf("Chunk %s is missing from the collection: %v", id, err)
+				continue
+			}
+			r.keywordIndex.Add(doc.ID, doc.Content, doc.Metadata)
+			loaded++
+		}
+	}
+
+	if loaded > 0 {
+		log.Printf("Keyword index rebuilt with %d chunks", loaded)
+	}
+}
+
 // AddDiscordMessage stores Discord message for context
 func (r *RAGService) AddDiscordMessage(channelID string, message *models.DiscordMessage) {
 	r.messagesMutex.Lock()
@@ -287,68 +1010,42 @@ func (r *RAGService) getDiscordContext(channelID string, limit int) []string {
 	return msgContext
 }
 
-// isSupportedFileType checks if file type is supported
-func (r *RAGService) isSupportedFileType(ext string) bool {
-	supportedTypes := map[string]bool{
-		".txt":  true,
-		".md":   true,
-		".json": true,
-		".csv":  true,
-		".log":  true,
-		".yml":  true,
-		".yaml": true,
-	}
-	return supportedTypes[ext]
+// isSupportedFileType checks if an extractor is registered for the file type
+func (r *RAGService) isSupportedFileType(path string) bool {
+	return ExtractorFor(path) != nil
 }
 
-// extractTextFromFile extracts text content from file
-func (r *RAGService) extractTextFromFile(path string) (string, error) {
-	content, err := os.ReadFile(path)
-	if err != nil {
-		return "", err
+// extractTextFromFile extracts the text sections of a file with its registered extractor
+func (r *RAGService) extractTextFromFile(path string) ([]DocumentSection, error) {
+	extractor := ExtractorFor(path)
+	if extractor == nil {
+		return nil, fmt.Errorf("unsupported file type: %s", filepath.Ext(path))
 	}
-	return string(content), nil
-}
 
-// chunkText splits text into smaller chunks
-func (r *RAGService) chunkText(text string, maxChunkSize int) []string {
-	if len(text) <= maxChunkSize {
-		return []string{text}
+	sections, err := extractor.Extract(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s extractor: %w", extractor.Name(), err)
 	}
+	return sections, nil
+}
 
-	var chunks []string
-	sentences := r.splitIntoSentences(text)
-
-	var currentChunk strings.Builder
-	for _, sentence := range sentences {
-		if currentChunk.Len()+len(sentence) > maxChunkSize && currentChunk.Len() > 0 {
-			chunks = append(chunks, strings.TrimSpace(currentChunk.String()))
-			currentChunk.Reset()
+// chunkerFor returns the chunker for a file, choosing by file type in auto mode
+func (r *RAGService) chunkerFor(path string) (Chunker, error) {
+	strategy := r.chunkStrategy
+	if strategy == ChunkerAuto {
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".md", ".markdown":
+			strategy = ChunkerMarkdown
+		default:
+			strategy = ChunkerRecursive
 		}
-		currentChunk.WriteString(sentence)
-		currentChunk.WriteString(" ")
-	}
-
-	if currentChunk.Len() > 0 {
-		chunks = append(chunks, strings.TrimSpace(currentChunk.String()))
 	}
-
-	return chunks
+	return NewChunker(strategy, r.chunkSize, r.chunkOverlap)
 }
 
-// splitIntoSentences splits text into sentences
-func (r *RAGService) splitIntoSentences(text string) []string {
-	sentenceRegex := regexp.MustCompile(`[.!?]+\s+`)
-	sentences := sentenceRegex.Split(text, -1)
-
-	var result []string
-	for _, sentence := range sentences {
-		sentence = strings.TrimSpace(sentence)
-		if len(sentence) > 0 {
-			result = append(result, sentence)
-		}
-	}
-	return result
+// indexSettings describes the settings that shape the stored chunks and their vectors
+func (r *RAGService) indexSettings() string {
+	return fmt.Sprintf("chunker=%s size=%d overlap=%d embedder=%s", r.chunkStrategy, r.chunkSize, r.chunkOverlap, r.embedder)
 }
 
 // getSourceFromMetadata extracts source path from metadata
@@ -369,12 +1066,34 @@ func (r *RAGService) GetStatus() map[string]interface{} {
 		"collection_name":   r.collectionName,
 		"data_path":         r.dataPath,
 		"embedding_enabled": r.embeddingEnabled,
+		"embedder":          r.embedder,
+		"search": map[string]interface{}{
+			"vector_weight":  r.vectorWeight,
+			"keyword_weight": r.keywordWeight,
+			"rrf_k":          r.rrfK,
+			"threshold":      r.threshold,
+			"keyword_chunks": r.keywordIndex.Len(),
+		},
+		"rerank": map[string]interface{}{
+			"reranker":   rerankerName(r.reranker),
+			"candidates": r.rerankCandidates,
+		},
+		"persistent":      r.persistPath != "",
+		"supported_types": SupportedExtensions(),
+		"chunking": map[string]interface{}{
+			"strategy":       r.chunkStrategy,
+			"size_tokens":    r.chunkSize,
+			"overlap_tokens": r.chunkOverlap,
+		},
+	}
+
+	if r.persistPath != "" {
+		status["persist_path"] = r.persistPath
 	}
 
 	if r.initialized && r.collection != nil {
 		status["status"] = "active"
-		// Note: chromem-go doesn't provide document count directly
-		status["note"] = "Collection active"
+		status["document_count"] = r.collection.Count()
 	} else {
 		status["status"] = "inactive"
 		status["error"] = "Not initialized"
@@ -397,6 +1116,24 @@ func (r *RAGService) GetStatus() map[string]interface{} {
 	return status
 }
 
+// DocumentCount returns the number of chunks stored in the collection
+func (r *RAGService) DocumentCount() int {
+	if !r.initialized || r.collection == nil {
+		return 0
+	}
+	return r.collection.Count()
+}
+
+// DataPath returns the folder documents are indexed from
+func (r *RAGService) DataPath() string {
+	return r.dataPath
+}
+
+// IsPersistent returns whether the index is stored on disk
+func (r *RAGService) IsPersistent() bool {
+	return r.persistPath != ""
+}
+
 // IsEnabled returns whether the RAG service is enabled and initialized
 func (r *RAGService) IsEnabled() bool {
 	return r.initialized
@@ -0,0 +1,168 @@
+package services
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"chatbot/models"
+)
+
+// tagMetadataPrefix namespaces custom tags in chunk metadata
+const tagMetadataPrefix = "tag_"
+
+// tagKeyPattern limits tag names to characters that are safe as metadata keys
+var tagKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// searchFilter is a RAGFilter split into the exact-match parts chromem evaluates itself
+// and the remaining conditions, which are checked on each candidate
+type searchFilter struct {
+	where         map[string]string
+	whereDocument map[string]string
+	fileTypes     map[string]bool
+	fileName      string
+	indexedAfter  *time.Time
+	indexedBefore *time.Time
+	tags          map[string]string
+	contains      string
+	notContains   string
+	// needsPostFilter is set when some condition can't be expressed as a chromem filter
+	needsPostFilter bool
+}
+
+// newSearchFilter validates a filter and maps it onto chromem's where and whereDocument filters
+func newSearchFilter(filter *models.RAGFilter) (*searchFilter, error) {
+	f := &searchFilter{}
+	if filter == nil {
+		return f, nil
+	}
+
+	if len(filter.FileType) > 0 {
+		f.fileTypes = make(map[string]bool, len(filter.FileType))
+		for _, fileType := range filter.FileType {
+			fileType = strings.ToLower(strings.TrimSpace(fileType))
+			if fileType == "" {
+				continue
+			}
+			if !strings.HasPrefix(fileType, ".") {
+				fileType = "." + fileType
+			}
+			f.fileTypes[fileType] = true
+		}
+	}
+
+	if filter.FileName != "" {
+		if _, err := path.Match(filter.FileName, ""); err != nil {
+			return nil, fmt.Errorf("invalid file_name pattern %q: %w", filter.FileName, err)
+		}
+		f.fileName = filter.FileName
+		f.needsPostFilter = true
+	}
+
+	if filter.IndexedAfter != nil && filter.IndexedBefore != nil && filter.IndexedAfter.After(*filter.IndexedBefore) {
+		return nil, fmt.Errorf("indexed_after must not be later than indexed_before")
+	}
+	f.indexedAfter = filter.IndexedAfter
+	f.indexedBefore = filter.IndexedBefore
+	if f.indexedAfter != nil || f.indexedBefore != nil {
+		f.needsPostFilter = true
+	}
+
+	if err := ValidateTags(filter.Tags); err != nil {
+		return nil, err
+	}
+	f.tags = filter.Tags
+	f.contains = filter.Contains
+	f.notContains = filter.NotContains
+
+	// chromem only supports exact metadata matches, so several file types need a post filter
+	if len(f.fileTypes) > 1 {
+		f.needsPostFilter = true
+	}
+	if len(f.fileTypes) == 1 || len(f.tags) > 0 {
+		f.where = make(map[string]string)
+		if len(f.fileTypes) == 1 {
+			for fileType := range f.fileTypes {
+				f.where["file_type"] = fileType
+			}
+		}
+		for key, value := range f.tags {
+			f.where[tagMetadataPrefix+key] = value
+		}
+	}
+
+	if f.contains != "" || f.notContains != "" {
+		f.whereDocument = make(map[string]string)
+		if f.contains != "" {
+			f.whereDocument["$contains"] = f.contains
+		}
+		if f.notContains != "" {
+			f.whereDocument["$not_contains"] = f.notContains
+		}
+	}
+
+	return f, nil
+}
+
+// ValidateRAGFilter reports whether a filter can be used in a search
+func ValidateRAGFilter(filter *models.RAGFilter) error {
+	_, err := newSearchFilter(filter)
+	return err
+}
+
+// accept checks every condition of the filter against a chunk
+func (f *searchFilter) accept(content string, metadata map[string]string) bool {
+	if len(f.fileTypes) > 0 && !f.fileTypes[metadata["file_type"]] {
+		return false
+	}
+
+	if f.fileName != "" {
+		target := metadata["file_name"]
+		if strings.Contains(f.fileName, "/") {
+			target = metadata["relative_path"]
+		}
+		if matched, _ := path.Match(f.fileName, target); !matched {
+			return false
+		}
+	}
+
+	if f.indexedAfter != nil || f.indexedBefore != nil {
+		indexedAt, err := time.Parse(time.RFC3339, metadata["indexed_at"])
+		if err != nil {
+			return false
+		}
+		if f.indexedAfter != nil && indexedAt.Before(*f.indexedAfter) {
+			return false
+		}
+		if f.indexedBefore != nil && indexedAt.After(*f.indexedBefore) {
+			return false
+		}
+	}
+
+	for key, value := range f.tags {
+		if metadata[tagMetadataPrefix+key] != value {
+			return false
+		}
+	}
+
+	if f.contains != "" && !strings.Contains(content, f.contains) {
+		return false
+	}
+	if f.notContains != "" && strings.Contains(content, f.notContains) {
+		return false
+	}
+
+	return true
+}
+
+// ValidateTags checks that custom tag names can be stored as metadata keys
+func ValidateTags(tags map[string]string) error {
+	for key := range tags {
+		if !tagKeyPattern.MatchString(key) {
+			return fmt.Errorf("invalid tag name %q: use letters, digits, '_' and '-'", key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// IndexManifest records which chunks were created for each indexed file so that
+// re-indexing only touches new, changed or deleted files
+type IndexManifest struct {
+	Settings string                    `json:"settings"` // Chunking and embedding settings the files were indexed with
+	Files    map[string]*ManifestEntry `json:"files"`    // Keyed by path relative to the data folder
+}
+
+// ManifestEntry describes the indexed state of a single file
+type ManifestEntry struct {
+	Hash      string            `json:"hash"` // SHA-256 of the file content
+	ChunkIDs  []string          `json:"chunk_ids"`
+	IndexedAt time.Time         `json:"indexed_at"`
+	Tags      map[string]string `json:"tags,omitempty"` // Custom tags copied to every chunk
+}
+
+// newIndexManifest creates an empty manifest
+func newIndexManifest() *IndexManifest {
+	return &IndexManifest{Files: make(map[string]*ManifestEntry)}
+}
+
+// loadIndexManifest reads a manifest from disk, returning an empty one if the file doesn't exist
+func loadIndexManifest(path string) (*IndexManifest, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return newIndexManifest(), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+
+	manifest := newIndexManifest()
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, fmt.Errorf("failed to decode manifest: %w", err)
+	}
+	if manifest.Files == nil {
+		manifest.Files = make(map[string]*ManifestEntry)
+	}
+	return manifest, nil
+}
+
+// save writes the manifest to disk atomically
+func (m *IndexManifest) save(path string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create manifest directory: %w", err)
+	}
+
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// sortedPaths returns the manifest paths in lexical order
+func (m *IndexManifest) sortedPaths() []string {
+	paths := make([]string, 0, len(m.Files))
+	for path := range m.Files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// hashFile returns the hex SHA-256 of a file's content
+func hashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// chunkID derives a collision-free chunk ID from the file's path relative to the data folder
+func chunkID(relPath string, index int) string {
+	return fmt.Sprintf("%s_chunk_%d", relPath, index)
+}
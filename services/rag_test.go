@@ -0,0 +1,162 @@
+package services
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"chatbot/models"
+)
+
+// newTestRAGService indexes files into an in-memory collection with hash embeddings
+func newTestRAGService(t *testing.T, files map[string]string) *RAGService {
+	t.Helper()
+
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rag := NewRAGService(models.RAGConfig{
+		Enabled:           true,
+		DataPath:          dir,
+		CollectionName:    "test",
+		EmbeddingProvider: EmbeddingHash,
+		Chunker:           ChunkerRecursive,
+		ChunkSize:         256,
+		ChunkOverlap:      0,
+	})
+	rag.vectorWeight, rag.keywordWeight, rag.rrfK, rag.threshold = 1, 1, 60, 0
+	if err := rag.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rag.Reindex(false); err != nil {
+		t.Fatal(err)
+	}
+	return rag
+}
+
+var testDocuments = map[string]string{
+	"errors.txt":   "Error ERR_CONN-42 means the database connection was refused.",
+	"password.txt": "To reset your password open the account settings and choose reset password.",
+	"billing.txt":  "Invoices are sent on the first day of every month.",
+}
+
+func TestRAGQueryFusesVectorAndKeywordRanks(t *testing.T) {
+	rag := newTestRAGService(t, testDocuments)
+
+	response, err := rag.Query(context.Background(), models.RAGQuery{Query: "reset password", Limit: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(response.Documents) == 0 {
+		t.Fatal("expected results")
+	}
+
+	top := response.Documents[0]
+	if filepath.Base(top.Source) != "password.txt" {
+		t.Fatalf("top result = %s, want password.txt", top.Source)
+	}
+	if top.Scores.VectorRank != 1 || top.Scores.KeywordRank != 1 {
+		t.Errorf("ranks = %d/%d, want first in both", top.Scores.VectorRank, top.Scores.KeywordRank)
+	}
+	// First in both rankings is the best possible fused score
+	if top.Score < 0.999 {
+		t.Errorf("score = %f, want 1", top.Score)
+	}
+	for i := 1; i < len(response.Documents); i++ {
+		if response.Documents[i].Scores.Fused > response.Documents[i-1].Scores.Fused {
+			t.Errorf("results are not sorted by fused score")
+		}
+	}
+}
+
+func TestRAGQueryWeights(t *testing.T) {
+	rag := newTestRAGService(t, testDocuments)
+	zero := 0.0
+
+	response, err := rag.Query(context.Background(), models.RAGQuery{Query: "ERR_CONN-42", Limit: 3, VectorWeight: &zero})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(response.Documents) != 1 || filepath.Base(response.Documents[0].Source) != "errors.txt" {
+		t.Fatalf("keyword-only search should find just errors.txt, got %d results", len(response.Documents))
+	}
+	if response.Documents[0].Scores.VectorRank != 0 {
+		t.Error("vector retrieval should be skipped with a zero weight")
+	}
+
+	negative := -1.0
+	if _, err := rag.Query(context.Background(), models.RAGQuery{Query: "x", KeywordWeight: &negative}); err == nil {
+		t.Error("expected an error for a negative weight")
+	}
+}
+
+func TestRAGQueryThresholdOverride(t *testing.T) {
+	rag := newTestRAGService(t, testDocuments)
+	rag.threshold = 0.99
+
+	response, err := rag.Query(context.Background(), models.RAGQuery{Query: "reset password", Limit: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(response.Documents) != 0 {
+		t.Fatalf("the default threshold should drop every chunk, got %d", len(response.Documents))
+	}
+
+	zero := 0.0
+	response, err = rag.Query(context.Background(), models.RAGQuery{Query: "reset password", Limit: 3, Threshold: &zero})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(response.Documents) != 3 {
+		t.Errorf("a threshold of 0 should keep every chunk, got %d", len(response.Documents))
+	}
+}
+
+func TestRAGQueryDuringDeletion(t *testing.T) {
+	files := make(map[string]string)
+	for _, name := range []string{"a.txt", "b.txt", "c.txt", "d.txt", "e.txt", "f.txt"} {
+		files[name] = "Document " + name + " about connection errors."
+	}
+	rag := newTestRAGService(t, files)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for name := range files {
+			if _, err := rag.DeleteDocument(name); err != nil {
+				t.Errorf("delete %s: %v", name, err)
+			}
+		}
+	}()
+
+	for i := 0; i < 200; i++ {
+		if _, err := rag.Query(context.Background(), models.RAGQuery{Query: "connection errors", Limit: 10}); err != nil {
+			t.Fatalf("query failed while documents were deleted: %v", err)
+		}
+	}
+	wg.Wait()
+}
+
+func TestRAGQueryPassesContextToReranker(t *testing.T) {
+	type key struct{}
+	ctx := context.WithValue(context.Background(), key{}, "request")
+
+	rag := newTestRAGService(t, testDocuments)
+	rag.SetReranker(NewLLMReranker(func(ctx context.Context, _ GenerateRequest) (string, error) {
+		if ctx.Value(key{}) != "request" {
+			t.Error("the request context was not passed to the reranker")
+		}
+		return "1: 5", nil
+	}))
+
+	if _, err := rag.Query(ctx, models.RAGQuery{Query: "reset password", Limit: 2}); err != nil {
+		t.Fatal(err)
+	}
+}
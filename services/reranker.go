@@ -0,0 +1,456 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"chatbot/models"
+	"chatbot/utils"
+)
+
+// Reranker strategies
+const (
+	RerankerNone    = "none"
+	RerankerLLM     = "llm"
+	RerankerLexical = "lexical"
+	RerankerMMR     = "mmr"
+)
+
+// Reranker reorders retrieved chunks by a finer relevance judgement than retrieval used
+type Reranker interface {
+	// Name identifies the strategy in status output
+	Name() string
+	// Rerank returns the best k documents in their new order
+	Rerank(ctx context.Context, query string, documents []models.RAGDocument, k int) ([]models.RAGDocument, error)
+}
+
+// GenerateFunc sends a standalone request to a language model and returns its reply. The
+// request's context blocks are fitted to the model's budget, dropping the last ones first.
+type GenerateFunc func(ctx context.Context, request GenerateRequest) (string, error)
+
+// NewRerankerFromEnv creates the reranker selected by RAG_RERANKER, which may list several
+// strategies separated by commas to apply them in order (for example "lexical,mmr").
+// It returns nil when re-ranking is disabled.
+func NewRerankerFromEnv(generate GenerateFunc) (Reranker, error) {
+	names := utils.GetEnvList("RAG_RERANKER")
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	var stages []Reranker
+	for _, name := range names {
+		switch strings.ToLower(name) {
+		case RerankerNone:
+			continue
+		case RerankerLLM:
+			if generate == nil {
+				return nil, fmt.Errorf("the llm reranker needs a language model")
+			}
+			stages = append(stages, NewLLMReranker(generate))
+		case RerankerLexical:
+			stages = append(stages, NewLexicalReranker())
+		case RerankerMMR:
+			stages = append(stages, NewMMRReranker(utils.GetEnvFloat("RAG_MMR_LAMBDA", 0.7)))
+		default:
+			return nil, fmt.Errorf("unknown reranker: %s", name)
+		}
+	}
+
+	switch len(stages) {
+	case 0:
+		return nil, nil
+	case 1:
+		return stages[0], nil
+	default:
+		return &RerankerChain{stages: stages}, nil
+	}
+}
+
+// RerankerChain applies several rerankers in order; only the last one cuts the list to k
+type RerankerChain struct {
+	stages []Reranker
+}
+
+// Name returns the stage names joined by commas
+func (c *RerankerChain) Name() string {
+	names := make([]string, 0, len(c.stages))
+	for _, stage := range c.stages {
+		names = append(names, stage.Name())
+	}
+	return strings.Join(names, ",")
+}
+
+// Rerank runs every stage
+func (c *RerankerChain) Rerank(ctx context.Context, query string, documents []models.RAGDocument, k int) ([]models.RAGDocument, error) {
+	var err error
+	for i, stage := range c.stages {
+		keep := len(documents)
+		if i == len(c.stages)-1 {
+			keep = k
+		}
+		if documents, err = stage.Rerank(ctx, query, documents, keep); err != nil {
+			return nil, fmt.Errorf("%s reranker: %w", stage.Name(), err)
+		}
+	}
+	return documents, nil
+}
+
+// setRerankScore records a reranker's score on a document
+func setRerankScore(doc *models.RAGDocument, score float64) {
+	if doc.Scores == nil {
+		doc.Scores = &models.RetrievalScores{}
+	}
+	doc.Scores.Rerank = score
+}
+
+// sortByRerankScore orders documents by rerank score, keeping retrieval order for ties, and keeps k
+func sortByRerankScore(documents []models.RAGDocument, k int) []models.RAGDocument {
+	sort.SliceStable(documents, func(i, j int) bool {
+		return documents[i].Scores.Rerank > documents[j].Scores.Rerank
+	})
+	if k > 0 && len(documents) > k {
+		documents = documents[:k]
+	}
+	return documents
+}
+
+// LLMReranker asks the language model to rate how well each chunk answers the query
+type LLMReranker struct {
+	generate GenerateFunc
+}
+
+// NewLLMReranker creates a reranker that scores chunks with a language model
+func NewLLMReranker(generate GenerateFunc) *LLMReranker {
+	return &LLMReranker{generate: generate}
+}
+
+// Name returns the strategy name
+func (r *LLMReranker) Name() string {
+	return RerankerLLM
+}
+
+// llmScorePattern matches "3: 7", "[3] 7/10", "3. 7" or "Passage 3: 7" style lines in the
+// model's reply, optionally as list items or in bold
+var llmScorePattern = regexp.MustCompile(`(?im)^[\s*\-]*(?:passage\s*)?\[?(\d+)\]?\**\s*[:=\-).]?\s*\**(\d+(?:\.\d+)?)`)
+
+// llmRerankInstructions is the system prompt for rating passages
+const llmRerankInstructions = "You rate how relevant passages are to a question on a scale from 0 (irrelevant) " +
+	"to 10 (answers it directly). Reply with one line per passage in the form \"<passage number>: <rating>\" " +
+	"and nothing else."
+
+const (
+	// llmRerankPassageLength limits how much of each chunk is shown to the model
+	llmRerankPassageLength = 400
+	// llmRerankTokensPerPassage is the reply length allowed for each rating line
+	llmRerankTokensPerPassage = 8
+)
+
+// Rerank rates all chunks in a single prompt and sorts them by rating. Passages that don't
+// fit the model's context window are left unrated.
+func (r *LLMReranker) Rerank(ctx context.Context, query string, documents []models.RAGDocument, k int) ([]models.RAGDocument, error) {
+	if len(documents) == 0 {
+		return documents, nil
+	}
+
+	passages := make([]string, 0, len(documents))
+	for i, doc := range documents {
+		passage := strings.Join(strings.Fields(doc.Content), " ")
+		if runes := []rune(passage); len(runes) > llmRerankPassageLength {
+			passage = string(runes[:llmRerankPassageLength]) + "..."
+		}
+		passages = append(passages, fmt.Sprintf("Passage %d: %s", i+1, passage))
+	}
+
+	reply, err := r.generate(ctx, GenerateRequest{
+		SystemPrompt: llmRerankInstructions,
+		Context:      passages,
+		Message:      fmt.Sprintf("Question: %s\n\nRate each passage in the context.", query),
+		MaxTokens:    len(passages)*llmRerankTokensPerPassage + promptFrameOverhead,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ratings := make(map[int]float64)
+	for _, match := range llmScorePattern.FindAllStringSubmatch(reply, -1) {
+		index, _ := strconv.Atoi(match[1])
+		rating, _ := strconv.ParseFloat(match[2], 64)
+		if index >= 1 && index <= len(documents) {
+			if _, seen := ratings[index]; !seen {
+				ratings[index] = math.Min(rating, 10) / 10
+			}
+		}
+	}
+	if len(ratings) == 0 {
+		return nil, fmt.Errorf("no ratings found in model reply %q", reply)
+	}
+
+	for i := range documents {
+		// Unrated chunks rank below rated ones but keep their retrieval order
+		rating, ok := ratings[i+1]
+		if !ok {
+			rating = -1
+		}
+		setRerankScore(&documents[i], rating)
+	}
+
+	return sortByRerankScore(documents, k), nil
+}
+
+// LexicalReranker scores each query-chunk pair on how completely, closely and in what
+// order the chunk contains the query terms, blended with the retrieval score
+type LexicalReranker struct{}
+
+// NewLexicalReranker creates a local lexical reranker
+func NewLexicalReranker() *LexicalReranker {
+	return &LexicalReranker{}
+}
+
+// Name returns the strategy name
+func (r *LexicalReranker) Name() string {
+	return RerankerLexical
+}
+
+// Weights of the lexical features and of the original retrieval score
+const (
+	lexicalCoverageWeight  = 0.45
+	lexicalProximityWeight = 0.2
+	lexicalBigramWeight    = 0.15
+	lexicalRetrievalWeight = 0.2
+)
+
+// Rerank scores and sorts the chunks
+func (r *LexicalReranker) Rerank(_ context.Context, query string, documents []models.RAGDocument, k int) ([]models.RAGDocument, error) {
+	queryTerms := uniqueTerms(keywordTokenize(query))
+	if len(queryTerms) == 0 {
+		return sortByRerankScore(documents, k), nil
+	}
+
+	queryBigrams := termBigrams(keywordTokenize(query))
+
+	for i := range documents {
+		docTokens := keywordTokenize(documents[i].Content)
+		positions := make(map[string][]int)
+		for pos, token := range docTokens {
+			positions[token] = append(positions[token], pos)
+		}
+
+		// Coverage: share of distinct query terms present in the chunk
+		matched := 0
+		for _, term := range queryTerms {
+			if len(positions[term]) > 0 {
+				matched++
+			}
+		}
+		coverage := float64(matched) / float64(len(queryTerms))
+
+		// Proximity: how tightly the matched terms cluster, 1.0 when adjacent
+		proximity := 0.0
+		if matched > 1 {
+			window := smallestWindow(queryTerms, positions)
+			if window > 0 {
+				proximity = float64(matched) / float64(window)
+			}
+		} else if matched == 1 {
+			proximity = 1.0 / float64(len(queryTerms))
+		}
+
+		// Bigram overlap rewards the query's word order
+		bigrams := 0.0
+		if len(queryBigrams) > 0 {
+			docBigrams := termBigrams(docTokens)
+			hits := 0
+			for bigram := range queryBigrams {
+				if docBigrams[bigram] {
+					hits++
+				}
+			}
+			bigrams = float64(hits) / float64(len(queryBigrams))
+		}
+
+		score := lexicalCoverageWeight*coverage +
+			lexicalProximityWeight*proximity +
+			lexicalBigramWeight*bigrams +
+			lexicalRetrievalWeight*float64(documents[i].Score)
+		setRerankScore(&documents[i], score)
+	}
+
+	return sortByRerankScore(documents, k), nil
+}
+
+// uniqueTerms removes repeated terms, keeping the first occurrence
+func uniqueTerms(terms []string) []string {
+	seen := make(map[string]bool, len(terms))
+	unique := make([]string, 0, len(terms))
+	for _, term := range terms {
+		if !seen[term] {
+			seen[term] = true
+			unique = append(unique, term)
+		}
+	}
+	return unique
+}
+
+// termBigrams returns the set of adjacent term pairs
+func termBigrams(terms []string) map[string]bool {
+	bigrams := make(map[string]bool)
+	for i := 1; i < len(terms); i++ {
+		bigrams[terms[i-1]+" "+terms[i]] = true
+	}
+	return bigrams
+}
+
+// smallestWindow returns the length of the shortest token span containing every query term
+// found in the chunk, or 0 if none are found
+func smallestWindow(terms []string, positions map[string][]int) int {
+	type hit struct{ pos, term int }
+	var hits []hit
+	for t, term := range terms {
+		for _, pos := range positions[term] {
+			hits = append(hits, hit{pos, t})
+		}
+	}
+	sort.Slice(hits, func(i, j int) bool { return hits[i].pos < hits[j].pos })
+
+	needed := 0
+	for _, term := range terms {
+		if len(positions[term]) > 0 {
+			needed++
+		}
+	}
+	if needed == 0 {
+		return 0
+	}
+
+	counts := make(map[int]int)
+	covered := 0
+	best := 0
+	left := 0
+	for right := range hits {
+		if counts[hits[right].term] == 0 {
+			covered++
+		}
+		counts[hits[right].term]++
+
+		for covered == needed {
+			if width := hits[right].pos - hits[left].pos + 1; best == 0 || width < best {
+				best = width
+			}
+			counts[hits[left].term]--
+			if counts[hits[left].term] == 0 {
+				covered--
+			}
+			left++
+		}
+	}
+	return best
+}
+
+// MMRReranker applies maximal marginal relevance: it picks chunks one at a time, trading
+// relevance against similarity to chunks already picked so near-duplicates don't crowd
+// out other useful context
+type MMRReranker struct {
+	lambda float64 // 1.0 ranks purely by relevance, 0.0 purely by novelty
+}
+
+// NewMMRReranker creates a diversifying reranker
+func NewMMRReranker(lambda float64) *MMRReranker {
+	if lambda < 0 || lambda > 1 {
+		log.Printf("Warning: RAG_MMR_LAMBDA must be between 0 and 1, using 0.7")
+		lambda = 0.7
+	}
+	return &MMRReranker{lambda: lambda}
+}
+
+// Name returns the strategy name
+func (r *MMRReranker) Name() string {
+	return RerankerMMR
+}
+
+// Rerank greedily selects k diverse, relevant chunks
+func (r *MMRReranker) Rerank(_ context.Context, _ string, documents []models.RAGDocument, k int) ([]models.RAGDocument, error) {
+	if k <= 0 || k > len(documents) {
+		k = len(documents)
+	}
+
+	// Relevance comes from an earlier reranker if there was one, otherwise from retrieval
+	relevance := make([]float64, len(documents))
+	shingles := make([]map[string]bool, len(documents))
+	for i, doc := range documents {
+		relevance[i] = float64(doc.Score)
+		if doc.Scores != nil && doc.Scores.Rerank != 0 {
+			relevance[i] = doc.Scores.Rerank
+		}
+		shingles[i] = termBigrams(keywordTokenize(doc.Content))
+		if len(shingles[i]) == 0 {
+			shingles[i] = map[string]bool{strings.ToLower(strings.TrimSpace(doc.Content)): true}
+		}
+	}
+
+	selected := make([]int, 0, k)
+	used := make([]bool, len(documents))
+
+	for len(selected) < k {
+		best := -1
+		bestScore := math.Inf(-1)
+
+		for i := range documents {
+			if used[i] {
+				continue
+			}
+
+			maxSimilarity := 0.0
+			for _, j := range selected {
+				if similarity := jaccard(shingles[i], shingles[j]); similarity > maxSimilarity {
+					maxSimilarity = similarity
+				}
+			}
+
+			score := r.lambda*relevance[i] - (1-r.lambda)*maxSimilarity
+			if score > bestScore {
+				best, bestScore = i, score
+			}
+		}
+
+		used[best] = true
+		selected = append(selected, best)
+	}
+
+	result := make([]models.RAGDocument, 0, k)
+	for rank, i := range selected {
+		doc := documents[i]
+		// Preserve the selection order as a descending score
+		setRerankScore(&doc, float64(k-rank)/float64(k))
+		result = append(result, doc)
+	}
+	return result, nil
+}
+
+// jaccard returns the overlap of two sets relative to their union
+func jaccard(a map[string]bool, b map[string]bool) float64 {
+	if len(a) == 0 && len(b) == 0 {
+		return 1
+	}
+
+	intersection := 0
+	for item := range a {
+		if b[item] {
+			intersection++
+		}
+	}
+	return float64(intersection) / float64(len(a)+len(b)-intersection)
+}
+
+// rerankerName returns the name of a possibly nil reranker
+func rerankerName(reranker Reranker) string {
+	if reranker == nil {
+		return RerankerNone
+	}
+	return reranker.Name()
+}
@@ -0,0 +1,136 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"chatbot/models"
+)
+
+// testDocs creates documents with the given IDs and retrieval scores in order
+func testDocs(contents ...string) []models.RAGDocument {
+	docs := make([]models.RAGDocument, 0, len(contents))
+	for i, content := range contents {
+		docs = append(docs, models.RAGDocument{
+			ID:      string(rune('a' + i)),
+			Content: content,
+			Score:   float32(len(contents)-i) / float32(len(contents)),
+			Scores:  &models.RetrievalScores{},
+		})
+	}
+	return docs
+}
+
+func docIDs(docs []models.RAGDocument) string {
+	ids := ""
+	for _, doc := range docs {
+		ids += doc.ID
+	}
+	return ids
+}
+
+func TestLLMRerankerParsesRatingFormats(t *testing.T) {
+	tests := []struct {
+		name  string
+		reply string
+		want  string
+	}{
+		{"colon", "1: 2\n2: 9\n3: 5", "bca"},
+		{"brackets", "[1] 2/10\n[2] 9/10\n[3] 5/10", "bca"},
+		{"passage prefix", "Passage 1: 2\nPassage 2: 9\nPassage 3: 5", "bca"},
+		{"dot", "1. 2\n2. 9\n3. 5", "bca"},
+		{"bold list", "- **Passage 1**: 2\n- **Passage 2**: 9\n- **Passage 3**: 5", "bca"},
+		{"decimal ratings", "1: 2.5\n2: 9.5\n3: 5.5", "bca"},
+		{"unrated keep order", "Passage 3: 8", "cab"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reranker := NewLLMReranker(func(context.Context, GenerateRequest) (string, error) {
+				return tt.reply, nil
+			})
+			docs, err := reranker.Rerank(context.Background(), "question", testDocs("one", "two", "three"), 3)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := docIDs(docs); got != tt.want {
+				t.Errorf("order = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLLMRerankerPassesContext(t *testing.T) {
+	type key struct{}
+	ctx := context.WithValue(context.Background(), key{}, "request")
+
+	reranker := NewLLMReranker(func(ctx context.Context, _ GenerateRequest) (string, error) {
+		if ctx.Value(key{}) != "request" {
+			t.Error("the request context was not passed to the model")
+		}
+		return "1: 5", nil
+	})
+	if _, err := reranker.Rerank(ctx, "question", testDocs("one"), 1); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLLMRerankerRequest(t *testing.T) {
+	var request GenerateRequest
+	reranker := NewLLMReranker(func(_ context.Context, r GenerateRequest) (string, error) {
+		request = r
+		return "1: 5\n2: 5", nil
+	})
+	if _, err := reranker.Rerank(context.Background(), "question", testDocs("one", "two"), 2); err != nil {
+		t.Fatal(err)
+	}
+
+	if request.SystemPrompt != llmRerankInstructions {
+		t.Errorf("system prompt = %q, want the rating instructions", request.SystemPrompt)
+	}
+	if request.MaxTokens <= 0 || request.MaxTokens > 100 {
+		t.Errorf("MaxTokens = %d, want a small reply sized for two ratings", request.MaxTokens)
+	}
+	if len(request.Context) != 2 || request.Context[1] != "Passage 2: two" {
+		t.Errorf("passages should be sent as context blocks, got %q", request.Context)
+	}
+}
+
+func TestLLMRerankerRejectsReplyWithoutRatings(t *testing.T) {
+	reranker := NewLLMReranker(func(context.Context, GenerateRequest) (string, error) {
+		return "I cannot rate these passages.", nil
+	})
+	if _, err := reranker.Rerank(context.Background(), "question", testDocs("one", "two"), 2); err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestLexicalRerankerPrefersCompleteMatches(t *testing.T) {
+	docs := testDocs(
+		"the password policy requires twelve characters",
+		"to reset your password open settings",
+		"reset the router",
+	)
+	reranked, err := NewLexicalReranker().Rerank(context.Background(), "reset password", docs, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := docIDs(reranked); got != "ba" {
+		t.Errorf("order = %s, want ba", got)
+	}
+}
+
+func TestMMRRerankerDropsNearDuplicates(t *testing.T) {
+	docs := testDocs(
+		"restart the service with systemctl restart chatbot",
+		"restart the service with systemctl restart chatbot now",
+		"logs are written to the journal",
+	)
+	reranked, err := NewMMRReranker(0.5).Rerank(context.Background(), "", docs, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := docIDs(reranked); got != "ac" {
+		t.Errorf("order = %s, want ac", got)
+	}
+}
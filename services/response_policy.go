@@ -0,0 +1,362 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// defaultStopPatterns end a reply where the model starts writing the next turn itself
+var defaultStopPatterns = []string{"\nHuman:", "\nUser:", "\nQ:", "\nQuestion:"}
+
+// ResponsePolicy controls how long a reply may be and how it is cleaned up
+type ResponsePolicy struct {
+	MaxTokens        int      // Reply length requested from the model
+	MaxChars         int      // Replies longer than this are cut at a sentence boundary; 0 keeps everything
+	StopPatterns     []string // The reply ends at the first of these, outside code blocks
+	TrimPunctuation  bool     // Strip trailing punctuation, for models that trail off mid-sentence
+	PreserveMarkdown bool     // Keep formatting and never cut inside a code block; false returns plain text
+}
+
+// DefaultResponsePolicy returns the policy for backends that don't define their own
+func DefaultResponsePolicy() ResponsePolicy {
+	return ResponsePolicy{
+		MaxTokens:        defaultMaxOutputTokens,
+		StopPatterns:     defaultStopPatterns,
+		PreserveMarkdown: true,
+	}
+}
+
+// policySettings are the keys accepted by PolicyOverride.set, with their environment suffixes
+var policySettings = map[string]string{
+	"max_tokens":        "MAX_TOKENS",
+	"max_chars":         "MAX_RESPONSE_CHARS",
+	"truncate":          "TRUNCATE",
+	"trim_punctuation":  "TRIM_PUNCTUATION",
+	"preserve_markdown": "PRESERVE_MARKDOWN",
+	"stop":              "STOP_PATTERNS",
+}
+
+// ResponsePolicyFromEnv applies <prefix>_MAX_TOKENS, <prefix>_MAX_RESPONSE_CHARS,
+// <prefix>_TRUNCATE, <prefix>_TRIM_PUNCTUATION, <prefix>_PRESERVE_MARKDOWN and
+// <prefix>_STOP_PATTERNS to a provider's default policy
+func ResponsePolicyFromEnv(prefix string, policy ResponsePolicy) ResponsePolicy {
+	var override PolicyOverride
+	for key, suffix := range policySettings {
+		value := strings.TrimSpace(os.Getenv(prefix + "_" + suffix))
+		if value == "" {
+			continue
+		}
+		if err := override.set(key, value); err != nil {
+			log.Printf("Warning: ignoring %s_%s: %v", prefix, suffix, err)
+		}
+	}
+	return policy.With(override)
+}
+
+// PolicyOverride changes selected fields of a ResponsePolicy; nil fields are left alone
+type PolicyOverride struct {
+	MaxTokens        *int
+	MaxChars         *int
+	StopPatterns     []string
+	TrimPunctuation  *bool
+	PreserveMarkdown *bool
+}
+
+// With returns the policy with the override applied
+func (p ResponsePolicy) With(override PolicyOverride) ResponsePolicy {
+	if override.MaxTokens != nil {
+		p.MaxTokens = *override.MaxTokens
+	}
+	if override.MaxChars != nil {
+		p.MaxChars = *override.MaxChars
+	}
+	if override.StopPatterns != nil {
+		p.StopPatterns = override.StopPatterns
+	}
+	if override.TrimPunctuation != nil {
+		p.TrimPunctuation = *override.TrimPunctuation
+	}
+	if override.PreserveMarkdown != nil {
+		p.PreserveMarkdown = *override.PreserveMarkdown
+	}
+	return p
+}
+
+// set parses a "key: value" policy setting, as used in persona template headers
+func (o *PolicyOverride) set(key string, value string) error {
+	switch key {
+	case "max_tokens", "max_chars":
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return fmt.Errorf("%s must be a non-negative number", key)
+		}
+		if key == "max_tokens" {
+			o.MaxTokens = &n
+		} else {
+			o.MaxChars = &n
+		}
+	case "truncate", "trim_punctuation", "preserve_markdown":
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%s must be true or false", key)
+		}
+		switch key {
+		case "truncate":
+			// Turning truncation off removes the character limit
+			if !b {
+				zero := 0
+				o.MaxChars = &zero
+			}
+		case "trim_punctuation":
+			o.TrimPunctuation = &b
+		default:
+			o.PreserveMarkdown = &b
+		}
+	case "stop":
+		// Comma-separated; "\n" stands for a line break
+		o.StopPatterns = []string{}
+		for _, pattern := range strings.Split(value, ",") {
+			pattern = strings.ReplaceAll(strings.TrimSpace(pattern), `\n`, "\n")
+			if pattern != "" {
+				o.StopPatterns = append(o.StopPatterns, pattern)
+			}
+		}
+	default:
+		return fmt.Errorf("unknown setting %q", key)
+	}
+	return nil
+}
+
+// Apply cleans up a reply according to the policy and reports whether the character limit
+// shortened it. A code block kept whole may leave the reply longer than MaxChars.
+func (p ResponsePolicy) Apply(response string) (string, bool) {
+	response = strings.TrimSpace(response)
+
+	// Stop at conversation continuation patterns outside code blocks
+	for _, pattern := range p.StopPatterns {
+		if idx := indexOutsideFences(response, pattern); idx != -1 {
+			response = strings.TrimSpace(response[:idx])
+		}
+	}
+
+	if p.PreserveMarkdown {
+		response = closeOpenFence(response)
+	} else {
+		response = stripMarkdown(response)
+	}
+
+	if p.TrimPunctuation && !strings.HasSuffix(response, "```") {
+		response = strings.TrimSpace(strings.TrimRight(response, ".,!?;:"))
+	}
+
+	truncated := false
+	if p.MaxChars > 0 && utf8.RuneCountInString(response) > p.MaxChars {
+		// Nothing is cut when the limit falls inside a final code block that is kept whole
+		cut := truncateReply(response, p.MaxChars, p.PreserveMarkdown)
+		truncated = cut != response
+		response = cut
+	}
+
+	return response, truncated
+}
+
+// fenceSpans returns the byte ranges of fenced code blocks, including the fence lines.
+// An unclosed fence runs to the end of the text.
+func fenceSpans(text string) [][2]int {
+	var spans [][2]int
+	start := -1
+	offset := 0
+	for _, line := range strings.SplitAfter(text, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			if start < 0 {
+				start = offset
+			} else {
+				spans = append(spans, [2]int{start, offset + len(line)})
+				start = -1
+			}
+		}
+		offset += len(line)
+	}
+	if start >= 0 {
+		spans = append(spans, [2]int{start, len(text)})
+	}
+	return spans
+}
+
+// spanContaining returns the code block containing a position, if any
+func spanContaining(spans [][2]int, pos int) ([2]int, bool) {
+	for _, span := range spans {
+		if pos >= span[0] && pos < span[1] {
+			return span, true
+		}
+	}
+	return [2]int{}, false
+}
+
+// indexOutsideFences finds the first occurrence of pattern that isn't inside a code block
+func indexOutsideFences(text string, pattern string) int {
+	spans := fenceSpans(text)
+	from := 0
+	for {
+		idx := strings.Index(text[from:], pattern)
+		if idx < 0 {
+			return -1
+		}
+		idx += from
+		span, inside := spanContaining(spans, idx)
+		if !inside {
+			return idx
+		}
+		from = span[1]
+	}
+}
+
+// closeOpenFence adds a closing fence when the reply ended inside a code block
+func closeOpenFence(text string) string {
+	fences := 0
+	for _, line := range strings.Split(text, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			fences++
+		}
+	}
+	if fences%2 == 1 {
+		return text + "\n```"
+	}
+	return text
+}
+
+// truncateReply cuts text to about maxChars at a sentence or line boundary. With preserve
+// set, a cut that would fall inside a code block keeps the whole block instead.
+func truncateReply(text string, maxChars int, preserve bool) string {
+	// Cut at the byte offset of the last character that fits, never inside a character
+	cut := len(text)
+	chars := 0
+	for i := range text {
+		if chars == maxChars {
+			cut = i
+			break
+		}
+		chars++
+	}
+
+	if preserve {
+		if span, inside := spanContaining(fenceSpans(text), cut); inside {
+			// Keep the block whole rather than emitting half of it
+			return strings.TrimSpace(text[:span[1]])
+		}
+	}
+
+	head := text[:cut]
+	// Prefer the last sentence or line ending within the limit
+	best := -1
+	for _, end := range []string{". ", "! ", "? ", ".\n", "!\n", "?\n", "\n"} {
+		if idx := strings.LastIndex(head, end); idx >= 0 && idx+1 > best {
+			best = idx + 1
+		}
+	}
+	if best > cut/2 {
+		return strings.TrimSpace(text[:best])
+	}
+
+	// No usable boundary; cut between words
+	if idx := strings.LastIndex(head, " "); idx > 0 {
+		head = head[:idx]
+	}
+	return strings.TrimSpace(head) + "..."
+}
+
+// Patterns for stripping markdown from replies sent to plain-text clients
+var (
+	markdownHeading = regexp.MustCompile(`(?m)^#{1,6}\s+`)
+	markdownLink    = regexp.MustCompile(`\[([^\]]+)\]\((https?://[^)]+)\)`)
+	markdownFence   = regexp.MustCompile("(?m)^\\s*```.*\\n?")
+	markdownInline  = regexp.MustCompile("`([^`]+)`")
+	markdownCode    = regexp.MustCompile("\x00(\\d+)\x00") // Placeholder for code set aside while stripping
+)
+
+// markdownEmphasis lists the emphasis delimiters, strong before regular. Underscores only
+// count at word boundaries, as in CommonMark, so snake_case identifiers are left alone.
+var markdownEmphasis = []struct {
+	pattern      *regexp.Regexp
+	wordBoundary bool
+}{
+	{regexp.MustCompile(`\*\*(\S(?:.*?\S)?)\*\*`), false},
+	{regexp.MustCompile(`__(\S(?:.*?\S)?)__`), true},
+	{regexp.MustCompile(`\*(\S(?:.*?\S)?)\*`), false},
+	{regexp.MustCompile(`_(\S(?:.*?\S)?)_`), true},
+}
+
+// stripMarkdown turns markdown into plain text, keeping code and link targets. Code blocks
+// and inline code are set aside first so their contents are returned unchanged.
+func stripMarkdown(text string) string {
+	var code []string
+	setAside := func(content string) string {
+		code = append(code, content)
+		return fmt.Sprintf("\x00%d\x00", len(code)-1)
+	}
+
+	var prose strings.Builder
+	last := 0
+	for _, span := range fenceSpans(text) {
+		prose.WriteString(text[last:span[0]])
+		prose.WriteString(setAside(markdownFence.ReplaceAllString(text[span[0]:span[1]], "")))
+		last = span[1]
+	}
+	prose.WriteString(text[last:])
+
+	text = markdownInline.ReplaceAllStringFunc(prose.String(), func(span string) string {
+		return setAside(span[1 : len(span)-1])
+	})
+	text = markdownHeading.ReplaceAllString(text, "")
+	text = markdownLink.ReplaceAllString(text, "$1 ($2)")
+	for _, emphasis := range markdownEmphasis {
+		text = removeEmphasis(text, emphasis.pattern, emphasis.wordBoundary)
+	}
+
+	text = markdownCode.ReplaceAllStringFunc(text, func(placeholder string) string {
+		index, _ := strconv.Atoi(placeholder[1 : len(placeholder)-1])
+		return code[index]
+	})
+	return strings.TrimSpace(text)
+}
+
+// removeEmphasis replaces each match of pattern with the emphasized text. With wordBoundary
+// set, matches whose delimiters touch a letter, digit or underscore outside are skipped.
+func removeEmphasis(text string, pattern *regexp.Regexp, wordBoundary bool) string {
+	var result strings.Builder
+	written := 0
+	for from := 0; from < len(text); {
+		match := pattern.FindStringSubmatchIndex(text[from:])
+		if match == nil {
+			break
+		}
+		start, end := from+match[0], from+match[1]
+
+		if wordBoundary {
+			before, _ := utf8.DecodeLastRuneInString(text[:start])
+			after, _ := utf8.DecodeRuneInString(text[end:])
+			if isWordRune(before) || isWordRune(after) {
+				// The opening delimiter is inside a word; a later one may still start emphasis
+				from = start + 1
+				continue
+			}
+		}
+
+		result.WriteString(text[written:start])
+		result.WriteString(text[from+match[2] : from+match[3]])
+		written, from = end, end
+	}
+	result.WriteString(text[written:])
+	return result.String()
+}
+
+// isWordRune reports whether r is part of a word for emphasis purposes
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
@@ -0,0 +1,101 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTruncateReplyCutsByCharacters(t *testing.T) {
+	text := strings.Repeat("é", 30) + " " + strings.Repeat("ü", 30)
+	got := truncateReply(text, 40, false)
+
+	if !utf8.ValidString(got) {
+		t.Fatalf("truncated reply is not valid UTF-8: %q", got)
+	}
+	if got != strings.Repeat("é", 30)+"..." {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestTruncateReplyPrefersSentenceBoundary(t *testing.T) {
+	text := "Première phrase terminée. Deuxième phrase qui est beaucoup trop longue pour tenir."
+	got := truncateReply(text, 50, false)
+
+	if got != "Première phrase terminée." {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestTruncateReplyKeepsCodeBlocksWhole(t *testing.T) {
+	text := "Run this:\n```sh\nmake build\nmake test\n```\nThen deploy it."
+	got := truncateReply(text, 20, true)
+
+	if got != "Run this:\n```sh\nmake build\nmake test\n```" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestApplyCountsCharactersNotBytes(t *testing.T) {
+	policy := ResponsePolicy{MaxChars: 10, PreserveMarkdown: true}
+	reply := "日本語のテキスト" // 8 characters, 24 bytes
+
+	got, truncated := policy.Apply(reply)
+	if truncated || got != reply {
+		t.Errorf("a reply under the limit was cut: %q", got)
+	}
+}
+
+func TestApplyStopsOutsideCodeBlocks(t *testing.T) {
+	policy := DefaultResponsePolicy()
+	reply := "Example:\n```\nUser: admin\n```\nDone.\nUser: next question"
+
+	got, _ := policy.Apply(reply)
+	if got != "Example:\n```\nUser: admin\n```\nDone." {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestApplyKeepsFinalCodeBlock(t *testing.T) {
+	policy := ResponsePolicy{MaxChars: 20, PreserveMarkdown: true}
+	reply := "Run:\n```sh\nmake build && make test\n```"
+
+	got, truncated := policy.Apply(reply)
+	if got != reply {
+		t.Errorf("the final code block should be kept whole, got %q", got)
+	}
+	if truncated {
+		t.Error("a reply that wasn't shortened should not be reported as truncated")
+	}
+
+	got, truncated = policy.Apply(reply + "\nThen deploy it to production.")
+	if got != reply || !truncated {
+		t.Errorf("got %q, truncated %v; want the text after the block cut", got, truncated)
+	}
+}
+
+func TestStripMarkdown(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"heading and strong", "## Setup\n**Install** the *package*.", "Setup\nInstall the package."},
+		{"underscore emphasis", "This is _really_ __important__.", "This is really important."},
+		{"snake case", "Set max_retry_count and my_var_name.", "Set max_retry_count and my_var_name."},
+		{"snake case then emphasis", "Use snake_case names, _not_ camelCase.", "Use snake_case names, not camelCase."},
+		{"inline code", "Call `get_user_name()` or `*ptr*`.", "Call get_user_name() or *ptr*."},
+		{"emphasis around code", "**Run `make`** first.", "Run make first."},
+		{"fenced code", "Example:\n```python\nx = a_b * c_d\n# comment\n```", "Example:\nx = a_b * c_d\n# comment"},
+		{"link", "See [the docs](https://example.com/a_b).", "See the docs (https://example.com/a_b)."},
+		{"unmatched delimiters", "2 * 3 = 6 and file_name_", "2 * 3 = 6 and file_name_"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := stripMarkdown(tt.in); got != tt.want {
+				t.Errorf("stripMarkdown(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
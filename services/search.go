@@ -44,6 +44,7 @@ type SearchService struct {
 	baseURL    string
 	httpClient *http.Client
 	enabled    bool
+	keywords   *KeywordSearchDecider
 }
 
 // NewSearchService creates a new search service instance
@@ -57,7 +58,8 @@ func NewSearchService() *SearchService {
 		httpClient: &http.Client{
 			Timeout: 10 * time.Second,
 		},
-		enabled: apiKey != "",
+		enabled:  apiKey != "",
+		keywords: NewKeywordSearchDecider(),
 	}
 }
 
@@ -188,41 +190,9 @@ func (s *SearchService) QuickSearch(query string) (string, error) {
 	return summary, nil
 }
 
-// ShouldSearch determines if a query would benefit from web search
+// ShouldSearch determines if a query would benefit from web search, using the keyword heuristic
 func (s *SearchService) ShouldSearch(message string) bool {
-	if !s.IsEnabled() {
-		return false
-	}
-
-	message = strings.ToLower(message)
-
-	// Keywords that suggest current/recent information needs
-	searchKeywords := []string{
-		"latest", "recent", "current", "today", "news", "update", "2024", "2025",
-		"what's happening", "breaking", "trending", "now", "currently",
-		"this week", "this month", "this year", "status", "price",
-		"weather", "stock", "rate", "election", "event",
-	}
-
-	for _, keyword := range searchKeywords {
-		if strings.Contains(message, keyword) {
-			return true
-		}
-	}
-
-	// Question patterns that often need current info
-	questionPatterns := []string{
-		"what is the", "how much", "where is", "when did", "who won",
-		"what happened", "how to", "why is", "is there",
-	}
-
-	for _, pattern := range questionPatterns {
-		if strings.Contains(message, pattern) {
-			return true
-		}
-	}
-
-	return false
+	return s.IsEnabled() && s.keywords.matches(message)
 }
 
 // GetStatus returns the status of the search service
@@ -0,0 +1,189 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"chatbot/models"
+)
+
+// Search decider strategies, chosen by SEARCH_DECIDER
+const (
+	SearchDeciderKeyword = "keyword"
+	SearchDeciderLLM     = "llm"
+)
+
+// SearchMode is a request's choice of when to search the web
+type SearchMode string
+
+const (
+	SearchAuto   SearchMode = "auto"   // The search decider chooses
+	SearchAlways SearchMode = "always" // Search for every message
+	SearchNever  SearchMode = "never"  // Never search
+)
+
+// ErrInvalidSearchMode is returned for search modes other than auto, always and never
+var ErrInvalidSearchMode = errors.New("invalid search mode")
+
+// ParseSearchMode checks a request's search mode; empty means auto
+func ParseSearchMode(mode string) (SearchMode, error) {
+	switch SearchMode(strings.ToLower(strings.TrimSpace(mode))) {
+	case "", SearchAuto:
+		return SearchAuto, nil
+	case SearchAlways:
+		return SearchAlways, nil
+	case SearchNever:
+		return SearchNever, nil
+	}
+	return "", fmt.Errorf("%w: %q, expected auto, always or never", ErrInvalidSearchMode, mode)
+}
+
+// SearchDecision says whether to search the web for a message and what to search for
+type SearchDecision struct {
+	Search bool
+	Query  string // The message itself unless the decider rewrote it
+}
+
+// SearchDecider decides whether a message needs current information from the web
+type SearchDecider interface {
+	// Name identifies the strategy in status output
+	Name() string
+	// Decide looks at the message, and the conversation before it, and picks a search query
+	Decide(ctx context.Context, message string, history []models.ChatMessage) (SearchDecision, error)
+}
+
+// NewSearchDeciderFromEnv creates the decider selected by SEARCH_DECIDER, the keyword
+// heuristic by default
+func NewSearchDeciderFromEnv(generate GenerateFunc) (SearchDecider, error) {
+	switch name := strings.ToLower(os.Getenv("SEARCH_DECIDER")); name {
+	case "", SearchDeciderKeyword:
+		return NewKeywordSearchDecider(), nil
+	case SearchDeciderLLM:
+		if generate == nil {
+			return nil, fmt.Errorf("the llm search decider needs a language model")
+		}
+		return NewLLMSearchDecider(generate), nil
+	default:
+		return nil, fmt.Errorf("unknown search decider: %s", name)
+	}
+}
+
+// searchKeywords suggest a need for current information. Words that are just as common in
+// questions the model can answer itself, such as "now", "current" or "status", are left out
+// because every search is a paid API call.
+var searchKeywords = []string{
+	"latest", "recent", "today", "tonight", "yesterday", "this week",
+	"news", "headlines", "breaking", "trending",
+	"price", "prices", "stock", "exchange rate", "weather", "forecast", "election",
+}
+
+// searchQuestionPatterns are questions about recent events
+var searchQuestionPatterns = []string{
+	"what's happening", "what happened", "who won",
+}
+
+// KeywordSearchDecider searches when the message contains words that suggest current
+// information. Words are matched whole, so "news" doesn't match "newsletter".
+type KeywordSearchDecider struct {
+	pattern *regexp.Regexp
+}
+
+// NewKeywordSearchDecider creates the keyword heuristic decider
+func NewKeywordSearchDecider() *KeywordSearchDecider {
+	phrases := make([]string, 0, len(searchKeywords)+len(searchQuestionPatterns))
+	for _, phrase := range append(append([]string{}, searchKeywords...), searchQuestionPatterns...) {
+		phrases = append(phrases, regexp.QuoteMeta(phrase))
+	}
+	return &KeywordSearchDecider{
+		pattern: regexp.MustCompile(`(?i)\b(?:` + strings.Join(phrases, "|") + `)\b`),
+	}
+}
+
+// Name returns the strategy name
+func (d *KeywordSearchDecider) Name() string {
+	return SearchDeciderKeyword
+}
+
+// Decide searches for the message as it is when it contains a keyword
+func (d *KeywordSearchDecider) Decide(_ context.Context, message string, _ []models.ChatMessage) (SearchDecision, error) {
+	return SearchDecision{Search: d.matches(message), Query: message}, nil
+}
+
+// matches reports whether the message contains a keyword or question pattern
+func (d *KeywordSearchDecider) matches(message string) bool {
+	return d.pattern.MatchString(message)
+}
+
+// LLMSearchDecider asks the language model whether a message needs a web search and,
+// if so, for a focused query. History lets follow-ups such as "and tomorrow?" become
+// complete queries.
+type LLMSearchDecider struct {
+	generate GenerateFunc
+}
+
+// NewLLMSearchDecider creates a decider that classifies messages with a language model
+func NewLLMSearchDecider(generate GenerateFunc) *LLMSearchDecider {
+	return &LLMSearchDecider{generate: generate}
+}
+
+// Name returns the strategy name
+func (d *LLMSearchDecider) Name() string {
+	return SearchDeciderLLM
+}
+
+// llmSearchHistory is how many earlier messages the model sees when deciding
+const llmSearchHistory = 4
+
+// llmSearchPattern matches the "SEARCH: <query>" line of the model's reply
+var llmSearchPattern = regexp.MustCompile(`(?im)^\W*search\W*?:(.*)$`)
+
+// llmNoSearchPattern matches a "NO_SEARCH" reply
+var llmNoSearchPattern = regexp.MustCompile(`(?i)\bno[_ ]?search\b`)
+
+// Decide sends a short classification prompt and parses the model's verdict
+func (d *LLMSearchDecider) Decide(ctx context.Context, message string, history []models.ChatMessage) (SearchDecision, error) {
+	var prompt strings.Builder
+	prompt.WriteString("Decide whether answering the last message needs a web search for current or external information, ")
+	prompt.WriteString("such as news, prices, weather, sports results or recent events. ")
+	prompt.WriteString("General knowledge, coding, maths, opinions and small talk do not.\n")
+	prompt.WriteString("Reply with exactly one line and nothing else:\n")
+	prompt.WriteString("SEARCH: <short web search query with the key terms of the question>\n")
+	prompt.WriteString("or\nNO_SEARCH\n\n")
+
+	if len(history) > llmSearchHistory {
+		history = history[len(history)-llmSearchHistory:]
+	}
+	if len(history) > 0 {
+		prompt.WriteString("Conversation so far:\n")
+		for _, msg := range history {
+			fmt.Fprintf(&prompt, "%s: %s\n", msg.Role, truncateText(strings.Join(strings.Fields(msg.Content), " "), 300))
+		}
+		prompt.WriteString("\n")
+	}
+	fmt.Fprintf(&prompt, "Last message: %s\n", message)
+
+	reply, err := d.generate(ctx, GenerateRequest{Message: prompt.String()})
+	if err != nil {
+		return SearchDecision{}, err
+	}
+	return parseSearchVerdict(reply, message)
+}
+
+// parseSearchVerdict reads the model's verdict, using the message when no query was given
+func parseSearchVerdict(reply string, message string) (SearchDecision, error) {
+	if match := llmSearchPattern.FindStringSubmatch(reply); match != nil {
+		query := strings.TrimSpace(strings.Trim(strings.TrimSpace(match[1]), "\"'`<>*"))
+		if query == "" {
+			query = message
+		}
+		return SearchDecision{Search: true, Query: query}, nil
+	}
+	if llmNoSearchPattern.MatchString(reply) {
+		return SearchDecision{Query: message}, nil
+	}
+	return SearchDecision{}, fmt.Errorf("no search verdict in model reply %q", reply)
+}
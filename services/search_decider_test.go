@@ -0,0 +1,135 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"chatbot/models"
+)
+
+func TestParseSearchMode(t *testing.T) {
+	for input, want := range map[string]SearchMode{"": SearchAuto, "auto": SearchAuto, " Always ": SearchAlways, "NEVER": SearchNever} {
+		got, err := ParseSearchMode(input)
+		if err != nil || got != want {
+			t.Errorf("ParseSearchMode(%q) = %q, %v, want %q", input, got, err, want)
+		}
+	}
+	if _, err := ParseSearchMode("sometimes"); !errors.Is(err, ErrInvalidSearchMode) {
+		t.Errorf("err = %v, want ErrInvalidSearchMode", err)
+	}
+}
+
+func TestKeywordSearchDeciderMatchesWholeWords(t *testing.T) {
+	decider := NewKeywordSearchDecider()
+	tests := map[string]bool{
+		"What's the latest news?":        true,
+		"Bitcoin PRICE today":            true,
+		"What happened in the election?": true,
+		"I know how this works":          false,
+		"Tell me a joke":                 false,
+		"Operate the generator":          false,
+		"Subscribe to our newsletter":    false,
+		"How to write a for loop in Go?": false,
+		"What is the status code for OK": false,
+		"Is there a map type in Go 2025": false,
+	}
+	for message, want := range tests {
+		if got := decider.matches(message); got != want {
+			t.Errorf("matches(%q) = %v, want %v", message, got, want)
+		}
+	}
+}
+
+func TestParseSearchVerdict(t *testing.T) {
+	tests := []struct {
+		reply      string
+		wantSearch bool
+		wantQuery  string
+	}{
+		{"SEARCH: bitcoin price usd", true, "bitcoin price usd"},
+		{"search: \"weather berlin tomorrow\"", true, "weather berlin tomorrow"},
+		{"Sure.\n**SEARCH:** champions league final result", true, "champions league final result"},
+		{"SEARCH:", true, "the message"},
+		{"NO_SEARCH", false, "the message"},
+		{"No search needed.", false, "the message"},
+	}
+
+	for _, tt := range tests {
+		decision, err := parseSearchVerdict(tt.reply, "the message")
+		if err != nil {
+			t.Errorf("%q: %v", tt.reply, err)
+			continue
+		}
+		if decision.Search != tt.wantSearch || decision.Query != tt.wantQuery {
+			t.Errorf("%q: got %+v", tt.reply, decision)
+		}
+	}
+
+	if _, err := parseSearchVerdict("I think so", "the message"); err == nil {
+		t.Error("expected an error for a reply without a verdict")
+	}
+}
+
+func TestLLMSearchDeciderPrompt(t *testing.T) {
+	type key struct{}
+	ctx := context.WithValue(context.Background(), key{}, "request")
+	var prompt string
+
+	decider := NewLLMSearchDecider(func(ctx context.Context, request GenerateRequest) (string, error) {
+		if ctx.Value(key{}) != "request" {
+			t.Error("the request context was not passed to the model")
+		}
+		prompt = request.Message
+		return "SEARCH: weather berlin tomorrow", nil
+	})
+
+	history := []models.ChatMessage{
+		{Role: "user", Content: "first"},
+		{Role: "assistant", Content: "second"},
+		{Role: "user", Content: "What's the weather in Berlin?"},
+		{Role: "assistant", Content: "Sunny."},
+		{Role: "user", Content: "fifth"},
+	}
+	decision, err := decider.Decide(ctx, "and tomorrow?", history)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !decision.Search || decision.Query != "weather berlin tomorrow" {
+		t.Errorf("decision = %+v", decision)
+	}
+	if strings.Contains(prompt, "first") || !strings.Contains(prompt, "Berlin") || !strings.Contains(prompt, "Last message: and tomorrow?") {
+		t.Errorf("the prompt should hold the last %d messages and the new one:\n%s", llmSearchHistory, prompt)
+	}
+}
+
+func TestSearchQuery(t *testing.T) {
+	newChatbot := func() *Chatbot {
+		c := newTestChatbot()
+		c.search = &SearchService{apiKey: "key", enabled: true, keywords: NewKeywordSearchDecider()}
+		c.searchDecider = NewLLMSearchDecider(func(context.Context, GenerateRequest) (string, error) {
+			return "", errors.New("model unavailable")
+		})
+		return c
+	}
+
+	c := newChatbot()
+	if query, ok := c.searchQuery(context.Background(), "latest news", nil, SearchAuto); !ok || query != "latest news" {
+		t.Errorf("a failing decider should fall back to keywords, got %q, %v", query, ok)
+	}
+	if _, ok := c.searchQuery(context.Background(), "tell me a joke", nil, SearchAlways); !ok {
+		t.Error("always should search")
+	}
+	if _, ok := c.searchQuery(context.Background(), "latest news", nil, SearchNever); ok {
+		t.Error("never should not search")
+	}
+
+	c.RegisterTool(NewWebSearchTool(c.search))
+	if _, ok := c.searchQuery(context.Background(), "latest news", nil, SearchAuto); ok {
+		t.Error("with the web_search tool the model should search for itself")
+	}
+	if _, ok := c.searchQuery(context.Background(), "latest news", nil, SearchAlways); !ok {
+		t.Error("always should search even with the web_search tool")
+	}
+}
@@ -0,0 +1,311 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"chatbot/models"
+	"chatbot/utils"
+)
+
+// ErrSessionNotFound is returned when a session does not exist or has expired
+var ErrSessionNotFound = errors.New("session not found")
+
+// SessionStore keeps conversation history per session ID
+type SessionStore interface {
+	// Get returns the session, or ErrSessionNotFound if it is missing or expired
+	Get(id string) (*models.Session, error)
+	// Append adds messages to the session, creating it if needed
+	Append(id string, messages ...models.ChatMessage) error
+	// Delete removes the session, or returns ErrSessionNotFound
+	Delete(id string) error
+	// PruneExpired removes idle sessions and returns how many were removed
+	PruneExpired() int
+	// GetStatus returns store details for the health endpoint
+	GetStatus() map[string]interface{}
+}
+
+// NewSessionStoreFromEnv creates the session store selected by SESSION_STORE ("memory" or "file")
+func NewSessionStoreFromEnv() (SessionStore, error) {
+	ttl := utils.GetEnvDuration("SESSION_TTL", 30*time.Minute)
+	maxMessages := utils.GetEnvInt("SESSION_MAX_MESSAGES", 50)
+
+	switch storeType := strings.ToLower(os.Getenv("SESSION_STORE")); storeType {
+	case "", "memory":
+		return NewMemorySessionStore(ttl, maxMessages), nil
+	case "file":
+		dir := os.Getenv("SESSION_DIR")
+		if dir == "" {
+			dir = "./sessions"
+		}
+		return NewFileSessionStore(dir, ttl, maxMessages)
+	default:
+		return nil, fmt.Errorf("unknown SESSION_STORE: %s", storeType)
+	}
+}
+
+// appendMessages adds messages to the session and keeps only the most recent maxMessages
+func appendMessages(session *models.Session, messages []models.ChatMessage, maxMessages int) {
+	session.Messages = append(session.Messages, messages...)
+	if maxMessages > 0 && len(session.Messages) > maxMessages {
+		session.Messages = session.Messages[len(session.Messages)-maxMessages:]
+	}
+	session.UpdatedAt = time.Now()
+}
+
+// isExpired checks whether a session has been idle longer than ttl
+func isExpired(session *models.Session, ttl time.Duration) bool {
+	return ttl > 0 && time.Since(session.UpdatedAt) > ttl
+}
+
+// copySession returns a copy that callers can modify safely
+func copySession(session *models.Session) *models.Session {
+	clone := *session
+	clone.Messages = make([]models.ChatMessage, len(session.Messages))
+	copy(clone.Messages, session.Messages)
+	return &clone
+}
+
+// MemorySessionStore keeps sessions in memory; they are lost on restart
+type MemorySessionStore struct {
+	mu          sync.RWMutex
+	sessions    map[string]*models.Session
+	ttl         time.Duration
+	maxMessages int
+}
+
+// NewMemorySessionStore creates an in-memory session store
+func NewMemorySessionStore(ttl time.Duration, maxMessages int) *MemorySessionStore {
+	return &MemorySessionStore{
+		sessions:    make(map[string]*models.Session),
+		ttl:         ttl,
+		maxMessages: maxMessages,
+	}
+}
+
+// Get returns a copy of the session
+func (m *MemorySessionStore) Get(id string) (*models.Session, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	session, exists := m.sessions[id]
+	if !exists || isExpired(session, m.ttl) {
+		return nil, ErrSessionNotFound
+	}
+	return copySession(session), nil
+}
+
+// Append adds messages to the session, starting a new one if it is missing or expired
+func (m *MemorySessionStore) Append(id string, messages ...models.ChatMessage) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session, exists := m.sessions[id]
+	if !exists || isExpired(session, m.ttl) {
+		session = &models.Session{ID: id, CreatedAt: time.Now()}
+		m.sessions[id] = session
+	}
+
+	appendMessages(session, messages, m.maxMessages)
+	return nil
+}
+
+// Delete removes the session
+func (m *MemorySessionStore) Delete(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.sessions[id]; !exists {
+		return ErrSessionNotFound
+	}
+	delete(m.sessions, id)
+	return nil
+}
+
+// PruneExpired removes idle sessions
+func (m *MemorySessionStore) PruneExpired() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	removed := 0
+	for id, session := range m.sessions {
+		if isExpired(session, m.ttl) {
+			delete(m.sessions, id)
+			removed++
+		}
+	}
+	return removed
+}
+
+// GetStatus returns the store details
+func (m *MemorySessionStore) GetStatus() map[string]interface{} {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return map[string]interface{}{
+		"type":         "memory",
+		"ttl":          m.ttl.String(),
+		"max_messages": m.maxMessages,
+		"sessions":     len(m.sessions),
+	}
+}
+
+// FileSessionStore keeps each session as a JSON file so history survives restarts
+type FileSessionStore struct {
+	mu          sync.Mutex
+	dir         string
+	ttl         time.Duration
+	maxMessages int
+}
+
+// NewFileSessionStore creates an on-disk session store in dir
+func NewFileSessionStore(dir string, ttl time.Duration, maxMessages int) (*FileSessionStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create session directory: %w", err)
+	}
+
+	return &FileSessionStore{
+		dir:         dir,
+		ttl:         ttl,
+		maxMessages: maxMessages,
+	}, nil
+}
+
+// sessionPath returns the file for a session; IDs are hashed since clients choose them
+func (f *FileSessionStore) sessionPath(id string) string {
+	sum := sha256.Sum256([]byte(id))
+	return filepath.Join(f.dir, hex.EncodeToString(sum[:])+".json")
+}
+
+// load reads a session file
+func (f *FileSessionStore) load(path string) (*models.Session, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read session: %w", err)
+	}
+
+	var session models.Session
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, fmt.Errorf("failed to decode session: %w", err)
+	}
+	return &session, nil
+}
+
+// save writes a session file atomically
+func (f *FileSessionStore) save(session *models.Session) error {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return fmt.Errorf("failed to encode session: %w", err)
+	}
+
+	path := f.sessionPath(session.ID)
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
+		return fmt.Errorf("failed to write session: %w", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("failed to save session: %w", err)
+	}
+	return nil
+}
+
+// Get returns the session stored on disk
+func (f *FileSessionStore) Get(id string) (*models.Session, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	session, err := f.load(f.sessionPath(id))
+	if err != nil {
+		return nil, err
+	}
+	if isExpired(session, f.ttl) {
+		return nil, ErrSessionNotFound
+	}
+	return session, nil
+}
+
+// Append adds messages to the session file, starting a new session if it is missing or expired
+func (f *FileSessionStore) Append(id string, messages ...models.ChatMessage) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	session, err := f.load(f.sessionPath(id))
+	if err != nil && !errors.Is(err, ErrSessionNotFound) {
+		return err
+	}
+	if session == nil || isExpired(session, f.ttl) {
+		session = &models.Session{ID: id, CreatedAt: time.Now()}
+	}
+
+	appendMessages(session, messages, f.maxMessages)
+	return f.save(session)
+}
+
+// Delete removes the session file
+func (f *FileSessionStore) Delete(id string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	err := os.Remove(f.sessionPath(id))
+	if os.IsNotExist(err) {
+		return ErrSessionNotFound
+	}
+	return err
+}
+
+// PruneExpired removes session files that have been idle longer than the TTL
+func (f *FileSessionStore) PruneExpired() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	paths, err := filepath.Glob(filepath.Join(f.dir, "*.json"))
+	if err != nil {
+		log.Printf("Failed to list sessions: %v", err)
+		return 0
+	}
+
+	removed := 0
+	for _, path := range paths {
+		session, err := f.load(path)
+		if err != nil {
+			log.Printf("Skipping unreadable session %s: %v", path, err)
+			continue
+		}
+		if isExpired(session, f.ttl) {
+			if err := os.Remove(path); err != nil {
+				log.Printf("Failed to remove expired session %s: %v", path, err)
+				continue
+			}
+			removed++
+		}
+	}
+	return removed
+}
+
+// GetStatus returns the store details
+func (f *FileSessionStore) GetStatus() map[string]interface{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	paths, _ := filepath.Glob(filepath.Join(f.dir, "*.json"))
+
+	return map[string]interface{}{
+		"type":         "file",
+		"dir":          f.dir,
+		"ttl":          f.ttl.String(),
+		"max_messages": f.maxMessages,
+		"sessions":     len(paths),
+	}
+}
@@ -0,0 +1,36 @@
+package services
+
+import "unicode"
+
+// TokenEstimator counts the tokens a text uses with a particular model's tokenizer
+type TokenEstimator func(text string) int
+
+// EstimateTokens approximates how many model tokens a text uses without a tokenizer.
+// Words count as roughly four characters per token and punctuation as one token each,
+// which tracks BPE tokenizers closely enough for sizing chunks and prompts.
+func EstimateTokens(text string) int {
+	tokens := 0
+	wordLength := 0
+
+	flushWord := func() {
+		if wordLength > 0 {
+			tokens += (wordLength + 3) / 4
+			wordLength = 0
+		}
+	}
+
+	for _, r := range text {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			wordLength++
+		case unicode.IsSpace(r):
+			flushWord()
+		default:
+			flushWord()
+			tokens++
+		}
+	}
+	flushWord()
+
+	return tokens
+}
@@ -0,0 +1,241 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"chatbot/models"
+	"chatbot/utils"
+)
+
+// Built-in tool names, as listed in AGENT_TOOLS
+const (
+	ToolRAGLookup   = "rag_lookup"
+	ToolWebSearch   = "web_search"
+	ToolCalculator  = "calculator"
+	ToolCurrentTime = "current_time"
+)
+
+// Tool call limits used unless AGENT_TOOL_TIMEOUT and AGENT_TOOL_RESULT_CHARS are set
+const (
+	defaultToolTimeout     = 15 * time.Second
+	defaultToolResultChars = 2000
+)
+
+var (
+	// ErrUnknownTool is returned when the model calls a tool that isn't registered
+	ErrUnknownTool = errors.New("unknown tool")
+	// ErrToolsUnsupported is returned by backends whose model can't call tools
+	ErrToolsUnsupported = errors.New("model does not support tool calling")
+)
+
+// Tool is a function the model can call while answering
+type Tool interface {
+	// Name identifies the tool to the model; letters, digits and underscores only
+	Name() string
+	// Description tells the model what the tool does and when to use it
+	Description() string
+	// Parameters returns the JSON schema of the tool's arguments
+	Parameters() json.RawMessage
+	// Execute runs the tool with the model's arguments and returns text for the model
+	Execute(ctx context.Context, arguments json.RawMessage) (string, error)
+}
+
+// ToolSpec declares a tool to a model, in the shape the OpenAI and Ollama APIs share
+type ToolSpec struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Parameters  json.RawMessage `json:"parameters"`
+}
+
+// ToolCall is a request from the model to run a tool
+type ToolCall struct {
+	ID        string // Set by providers that match results to calls by ID
+	Name      string
+	Arguments json.RawMessage
+}
+
+// ToolResult is the output of a tool call, sent back to the model
+type ToolResult struct {
+	CallID  string
+	Name    string
+	Content string
+}
+
+// ToolStep is one round of tool calls made by the model and their results
+type ToolStep struct {
+	Content string // Text the model sent along with the calls, if any
+	Calls   []ToolCall
+	Results []ToolResult
+}
+
+// ToolSet holds the tools available to the model
+type ToolSet struct {
+	tools          map[string]Tool
+	order          []string
+	timeout        time.Duration // Limit for a single tool call
+	maxResultChars int           // Longer results are cut before they reach the model
+}
+
+// NewToolSet creates an empty tool set
+func NewToolSet(timeout time.Duration, maxResultChars int) *ToolSet {
+	return &ToolSet{
+		tools:          make(map[string]Tool),
+		timeout:        timeout,
+		maxResultChars: maxResultChars,
+	}
+}
+
+// NewToolSetFromEnv creates the built-in tools listed in AGENT_TOOLS, or all of them for
+// "all". Tools whose service isn't enabled are left out. It returns nil when no tools are listed.
+func NewToolSetFromEnv(rag *RAGService, search *SearchService) (*ToolSet, error) {
+	names := utils.GetEnvList("AGENT_TOOLS")
+	if len(names) == 0 {
+		return nil, nil
+	}
+	if len(names) == 1 && strings.EqualFold(names[0], "all") {
+		names = []string{ToolRAGLookup, ToolWebSearch, ToolCalculator, ToolCurrentTime}
+	}
+
+	set := NewToolSet(
+		utils.GetEnvDuration("AGENT_TOOL_TIMEOUT", defaultToolTimeout),
+		utils.GetEnvInt("AGENT_TOOL_RESULT_CHARS", defaultToolResultChars))
+
+	for _, name := range names {
+		switch strings.ToLower(name) {
+		case ToolRAGLookup:
+			if rag == nil {
+				log.Printf("Skipping tool %s: RAG not enabled", ToolRAGLookup)
+				continue
+			}
+			set.Register(NewRAGLookupTool(rag))
+		case ToolWebSearch:
+			if search == nil || !search.IsEnabled() {
+				log.Printf("Skipping tool %s: search not enabled", ToolWebSearch)
+				continue
+			}
+			set.Register(NewWebSearchTool(search))
+		case ToolCalculator:
+			set.Register(NewCalculatorTool())
+		case ToolCurrentTime:
+			set.Register(NewCurrentTimeTool())
+		default:
+			return nil, fmt.Errorf("%w: %s", ErrUnknownTool, name)
+		}
+	}
+
+	if len(set.order) == 0 {
+		return nil, nil
+	}
+	return set, nil
+}
+
+// Register adds a tool, replacing any tool with the same name. Tools should be
+// registered before the chatbot serves requests.
+func (s *ToolSet) Register(tool Tool) {
+	if _, exists := s.tools[tool.Name()]; !exists {
+		s.order = append(s.order, tool.Name())
+	}
+	s.tools[tool.Name()] = tool
+}
+
+// Names returns the tool names in registration order
+func (s *ToolSet) Names() []string {
+	names := make([]string, len(s.order))
+	copy(names, s.order)
+	return names
+}
+
+// Has reports whether a tool with the given name is registered
+func (s *ToolSet) Has(name string) bool {
+	_, exists := s.tools[name]
+	return exists
+}
+
+// Specs returns the declarations of every tool for the model
+func (s *ToolSet) Specs() []ToolSpec {
+	specs := make([]ToolSpec, 0, len(s.order))
+	for _, name := range s.order {
+		tool := s.tools[name]
+		specs = append(specs, ToolSpec{
+			Name:        tool.Name(),
+			Description: tool.Description(),
+			Parameters:  tool.Parameters(),
+		})
+	}
+	return specs
+}
+
+// Invoke runs a tool call and returns the result for the model along with a record of the
+// call. Failures are reported to the model as the result so it can correct itself.
+func (s *ToolSet) Invoke(ctx context.Context, call ToolCall) (ToolResult, models.ToolInvocation) {
+	invocation := models.ToolInvocation{Name: call.Name, Arguments: call.Arguments}
+	start := time.Now()
+
+	var output string
+	var err error
+	if tool, exists := s.tools[call.Name]; exists {
+		ctx, cancel := context.WithTimeout(ctx, s.timeout)
+		output, err = tool.Execute(ctx, call.Arguments)
+		cancel()
+	} else {
+		err = fmt.Errorf("%w: %s", ErrUnknownTool, call.Name)
+	}
+	invocation.DurationMs = time.Since(start).Milliseconds()
+
+	if err != nil {
+		log.Printf("Tool %s failed: %v", call.Name, err)
+		invocation.Error = err.Error()
+		output = "Error: " + err.Error()
+	} else {
+		output = truncateText(output, s.maxResultChars)
+		invocation.Result = output
+	}
+
+	return ToolResult{CallID: call.ID, Name: call.Name, Content: output}, invocation
+}
+
+// GetStatus returns the registered tools and their limits
+func (s *ToolSet) GetStatus() map[string]interface{} {
+	return map[string]interface{}{
+		"tools":            s.Names(),
+		"timeout":          s.timeout.String(),
+		"max_result_chars": s.maxResultChars,
+	}
+}
+
+// toolArguments makes the model's arguments valid JSON. Missing arguments become an empty
+// object and malformed ones a JSON string, which tools reject with a useful error.
+func toolArguments(raw []byte) json.RawMessage {
+	trimmed := strings.TrimSpace(string(raw))
+	if trimmed == "" || trimmed == "null" {
+		return json.RawMessage("{}")
+	}
+	if json.Valid([]byte(trimmed)) {
+		return json.RawMessage(trimmed)
+	}
+	quoted, _ := json.Marshal(trimmed)
+	return quoted
+}
+
+// decodeArguments parses a tool's arguments into args
+func decodeArguments(arguments json.RawMessage, args interface{}) error {
+	if err := json.Unmarshal(arguments, args); err != nil {
+		return fmt.Errorf("invalid arguments: %w", err)
+	}
+	return nil
+}
+
+// truncateText cuts text to at most maxChars characters, marking the cut
+func truncateText(text string, maxChars int) string {
+	runes := []rune(text)
+	if maxChars <= 0 || len(runes) <= maxChars {
+		return text
+	}
+	return string(runes[:maxChars]) + "..."
+}
@@ -0,0 +1,499 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"chatbot/models"
+)
+
+// RAGLookupTool searches the indexed documents
+type RAGLookupTool struct {
+	rag *RAGService
+}
+
+// NewRAGLookupTool creates a document search tool backed by the RAG index
+func NewRAGLookupTool(rag *RAGService) *RAGLookupTool {
+	return &RAGLookupTool{rag: rag}
+}
+
+// Name returns the tool name
+func (t *RAGLookupTool) Name() string { return ToolRAGLookup }
+
+// Description tells the model when to search the documents
+func (t *RAGLookupTool) Description() string {
+	return "Search the user's indexed documents and return the most relevant passages with their file names."
+}
+
+// Parameters returns the argument schema
+func (t *RAGLookupTool) Parameters() json.RawMessage {
+	return json.RawMessage(`{
+		"type": "object",
+		"properties": {
+			"query": {"type": "string", "description": "What to look for in the documents"},
+			"limit": {"type": "integer", "description": "Number of passages to return, 1 to 10", "minimum": 1, "maximum": 10}
+		},
+		"required": ["query"]
+	}`)
+}
+
+// Execute searches the documents and lists the matching passages
+func (t *RAGLookupTool) Execute(ctx context.Context, arguments json.RawMessage) (string, error) {
+	var args struct {
+		Query string `json:"query"`
+		Limit int    `json:"limit"`
+	}
+	if err := decodeArguments(arguments, &args); err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(args.Query) == "" {
+		return "", fmt.Errorf("query is required")
+	}
+	if args.Limit < 1 || args.Limit > 10 {
+		args.Limit = 3
+	}
+
+	response, err := t.rag.Query(ctx, models.RAGQuery{Query: args.Query, Limit: args.Limit})
+	if err != nil {
+		return "", fmt.Errorf("document search failed: %w", err)
+	}
+	if len(response.Documents) == 0 {
+		return "No matching documents found.", nil
+	}
+
+	var result strings.Builder
+	for i, doc := range response.Documents {
+		citation := documentCitation(i+1, doc)
+		fmt.Fprintf(&result, "%d. %s\n%s\n\n", i+1, citation.File, strings.TrimSpace(doc.Content))
+	}
+	return strings.TrimSpace(result.String()), nil
+}
+
+// WebSearchTool searches the web with Brave Search
+type WebSearchTool struct {
+	search *SearchService
+}
+
+// NewWebSearchTool creates a web search tool
+func NewWebSearchTool(search *SearchService) *WebSearchTool {
+	return &WebSearchTool{search: search}
+}
+
+// Name returns the tool name
+func (t *WebSearchTool) Name() string { return ToolWebSearch }
+
+// Description tells the model when to search the web
+func (t *WebSearchTool) Description() string {
+	return "Search the web for current information such as news, prices or recent events. Returns titles, URLs and snippets."
+}
+
+// Parameters returns the argument schema
+func (t *WebSearchTool) Parameters() json.RawMessage {
+	return json.RawMessage(`{
+		"type": "object",
+		"properties": {
+			"query": {"type": "string", "description": "A focused search query"},
+			"count": {"type": "integer", "description": "Number of results, 1 to 10", "minimum": 1, "maximum": 10}
+		},
+		"required": ["query"]
+	}`)
+}
+
+// Execute runs the search and lists the results
+func (t *WebSearchTool) Execute(ctx context.Context, arguments json.RawMessage) (string, error) {
+	var args struct {
+		Query string `json:"query"`
+		Count int    `json:"count"`
+	}
+	if err := decodeArguments(arguments, &args); err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(args.Query) == "" {
+		return "", fmt.Errorf("query is required")
+	}
+	if args.Count < 1 || args.Count > 10 {
+		args.Count = 3
+	}
+
+	response, err := t.search.Search(args.Query, args.Count)
+	if err != nil {
+		return "", err
+	}
+	if len(response.Results) == 0 {
+		return "No results found.", nil
+	}
+
+	var result strings.Builder
+	for i, item := range response.Results {
+		fmt.Fprintf(&result, "%d. %s (%s)\n%s\n\n", i+1, item.Title, item.URL, item.Description)
+	}
+	return strings.TrimSpace(result.String()), nil
+}
+
+// CalculatorTool evaluates arithmetic expressions, which small models often get wrong
+type CalculatorTool struct{}
+
+// NewCalculatorTool creates a calculator tool
+func NewCalculatorTool() *CalculatorTool {
+	return &CalculatorTool{}
+}
+
+// Name returns the tool name
+func (t *CalculatorTool) Name() string { return ToolCalculator }
+
+// Description tells the model which expressions it can evaluate
+func (t *CalculatorTool) Description() string {
+	return "Evaluate an arithmetic expression. Supports + - * / % ^, parentheses, the constants pi and e, " +
+		"and the functions sqrt, abs, round, floor, ceil, ln, log10, sin, cos, tan, min and max."
+}
+
+// Parameters returns the argument schema
+func (t *CalculatorTool) Parameters() json.RawMessage {
+	return json.RawMessage(`{
+		"type": "object",
+		"properties": {
+			"expression": {"type": "string", "description": "The expression to evaluate, e.g. (12.5 * 4) ^ 2"}
+		},
+		"required": ["expression"]
+	}`)
+}
+
+// Execute evaluates the expression
+func (t *CalculatorTool) Execute(ctx context.Context, arguments json.RawMessage) (string, error) {
+	var args struct {
+		Expression string `json:"expression"`
+	}
+	if err := decodeArguments(arguments, &args); err != nil {
+		return "", err
+	}
+
+	value, err := evaluateExpression(args.Expression)
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatFloat(value, 'g', 12, 64), nil
+}
+
+// CurrentTimeTool reports the current date and time
+type CurrentTimeTool struct {
+	now func() time.Time
+}
+
+// NewCurrentTimeTool creates a clock tool
+func NewCurrentTimeTool() *CurrentTimeTool {
+	return &CurrentTimeTool{now: time.Now}
+}
+
+// Name returns the tool name
+func (t *CurrentTimeTool) Name() string { return ToolCurrentTime }
+
+// Description tells the model what the clock reports
+func (t *CurrentTimeTool) Description() string {
+	return "Get the current date, weekday and time, optionally in an IANA time zone such as Europe/Berlin."
+}
+
+// Parameters returns the argument schema
+func (t *CurrentTimeTool) Parameters() json.RawMessage {
+	return json.RawMessage(`{
+		"type": "object",
+		"properties": {
+			"timezone": {"type": "string", "description": "IANA time zone name; the server's zone if omitted"}
+		}
+	}`)
+}
+
+// Execute returns the current time in the requested zone
+func (t *CurrentTimeTool) Execute(ctx context.Context, arguments json.RawMessage) (string, error) {
+	var args struct {
+		Timezone string `json:"timezone"`
+	}
+	if err := decodeArguments(arguments, &args); err != nil {
+		return "", err
+	}
+
+	now := t.now()
+	if args.Timezone != "" {
+		location, err := time.LoadLocation(args.Timezone)
+		if err != nil {
+			return "", fmt.Errorf("unknown time zone: %s", args.Timezone)
+		}
+		now = now.In(location)
+	}
+
+	return fmt.Sprintf("%s (%s, %s)", now.Format("Monday, 2 January 2006 15:04:05 MST"),
+		now.Location(), now.Format(time.RFC3339)), nil
+}
+
+// calculatorFunctions are the functions the calculator accepts, by name
+var calculatorFunctions = map[string]func(args []float64) (float64, error){
+	"sqrt":  unaryFunction(math.Sqrt),
+	"abs":   unaryFunction(math.Abs),
+	"round": unaryFunction(math.Round),
+	"floor": unaryFunction(math.Floor),
+	"ceil":  unaryFunction(math.Ceil),
+	"ln":    unaryFunction(math.Log),
+	"log10": unaryFunction(math.Log10),
+	"sin":   unaryFunction(math.Sin),
+	"cos":   unaryFunction(math.Cos),
+	"tan":   unaryFunction(math.Tan),
+	"min":   variadicFunction(math.Min),
+	"max":   variadicFunction(math.Max),
+}
+
+// unaryFunction adapts a one-argument math function for the calculator
+func unaryFunction(fn func(float64) float64) func(args []float64) (float64, error) {
+	return func(args []float64) (float64, error) {
+		if len(args) != 1 {
+			return 0, fmt.Errorf("expected 1 argument, got %d", len(args))
+		}
+		return fn(args[0]), nil
+	}
+}
+
+// variadicFunction adapts a two-argument math function to fold over any number of arguments
+func variadicFunction(fn func(float64, float64) float64) func(args []float64) (float64, error) {
+	return func(args []float64) (float64, error) {
+		if len(args) == 0 {
+			return 0, fmt.Errorf("expected at least 1 argument")
+		}
+		result := args[0]
+		for _, arg := range args[1:] {
+			result = fn(result, arg)
+		}
+		return result, nil
+	}
+}
+
+// evaluateExpression computes an arithmetic expression. ^ is exponentiation and binds
+// tighter than unary minus, so -2^2 is -4.
+func evaluateExpression(expression string) (float64, error) {
+	parser := &expressionParser{input: []rune(strings.TrimSpace(expression))}
+	if len(parser.input) == 0 {
+		return 0, fmt.Errorf("expression is required")
+	}
+
+	value, err := parser.parseSum()
+	if err != nil {
+		return 0, err
+	}
+	parser.skipSpace()
+	if parser.pos < len(parser.input) {
+		return 0, fmt.Errorf("unexpected %q at position %d", parser.input[parser.pos], parser.pos+1)
+	}
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return 0, fmt.Errorf("result is not a finite number")
+	}
+	return value, nil
+}
+
+// expressionParser is a recursive descent parser over an arithmetic expression
+type expressionParser struct {
+	input []rune
+	pos   int
+}
+
+// skipSpace moves past whitespace
+func (p *expressionParser) skipSpace() {
+	for p.pos < len(p.input) && unicode.IsSpace(p.input[p.pos]) {
+		p.pos++
+	}
+}
+
+// accept consumes r if it is the next character
+func (p *expressionParser) accept(r rune) bool {
+	p.skipSpace()
+	if p.pos < len(p.input) && p.input[p.pos] == r {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+// parseSum parses terms joined by + and -
+func (p *expressionParser) parseSum() (float64, error) {
+	value, err := p.parseProduct()
+	if err != nil {
+		return 0, err
+	}
+	for {
+		switch {
+		case p.accept('+'):
+			right, err := p.parseProduct()
+			if err != nil {
+				return 0, err
+			}
+			value += right
+		case p.accept('-'):
+			right, err := p.parseProduct()
+			if err != nil {
+				return 0, err
+			}
+			value -= right
+		default:
+			return value, nil
+		}
+	}
+}
+
+// parseProduct parses factors joined by *, / and %
+func (p *expressionParser) parseProduct() (float64, error) {
+	value, err := p.parseUnary()
+	if err != nil {
+		return 0, err
+	}
+	for {
+		var op rune
+		switch {
+		case p.accept('*'):
+			op = '*'
+		case p.accept('/'):
+			op = '/'
+		case p.accept('%'):
+			op = '%'
+		default:
+			return value, nil
+		}
+
+		right, err := p.parseUnary()
+		if err != nil {
+			return 0, err
+		}
+		switch op {
+		case '*':
+			value *= right
+		case '/':
+			if right == 0 {
+				return 0, fmt.Errorf("division by zero")
+			}
+			value /= right
+		case '%':
+			if right == 0 {
+				return 0, fmt.Errorf("division by zero")
+			}
+			value = math.Mod(value, right)
+		}
+	}
+}
+
+// parseUnary parses a signed power
+func (p *expressionParser) parseUnary() (float64, error) {
+	if p.accept('-') {
+		value, err := p.parseUnary()
+		return -value, err
+	}
+	if p.accept('+') {
+		return p.parseUnary()
+	}
+	return p.parsePower()
+}
+
+// parsePower parses a right-associative exponentiation
+func (p *expressionParser) parsePower() (float64, error) {
+	base, err := p.parsePrimary()
+	if err != nil {
+		return 0, err
+	}
+	if !p.accept('^') {
+		return base, nil
+	}
+	exponent, err := p.parseUnary()
+	if err != nil {
+		return 0, err
+	}
+	return math.Pow(base, exponent), nil
+}
+
+// parsePrimary parses a number, constant, function call or parenthesized expression
+func (p *expressionParser) parsePrimary() (float64, error) {
+	p.skipSpace()
+	if p.pos >= len(p.input) {
+		return 0, fmt.Errorf("unexpected end of expression")
+	}
+
+	if p.accept('(') {
+		value, err := p.parseSum()
+		if err != nil {
+			return 0, err
+		}
+		if !p.accept(')') {
+			return 0, fmt.Errorf("missing closing parenthesis")
+		}
+		return value, nil
+	}
+
+	start := p.pos
+	r := p.input[p.pos]
+	switch {
+	case unicode.IsDigit(r) || r == '.':
+		for p.pos < len(p.input) && (unicode.IsDigit(p.input[p.pos]) || p.input[p.pos] == '.') {
+			p.pos++
+		}
+		// Exponent notation such as 1.5e3
+		if p.pos < len(p.input) && (p.input[p.pos] == 'e' || p.input[p.pos] == 'E') {
+			next := p.pos + 1
+			if next < len(p.input) && (p.input[next] == '+' || p.input[next] == '-') {
+				next++
+			}
+			if next < len(p.input) && unicode.IsDigit(p.input[next]) {
+				p.pos = next
+				for p.pos < len(p.input) && unicode.IsDigit(p.input[p.pos]) {
+					p.pos++
+				}
+			}
+		}
+		value, err := strconv.ParseFloat(string(p.input[start:p.pos]), 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid number %q", string(p.input[start:p.pos]))
+		}
+		return value, nil
+
+	case unicode.IsLetter(r):
+		for p.pos < len(p.input) && (unicode.IsLetter(p.input[p.pos]) || unicode.IsDigit(p.input[p.pos])) {
+			p.pos++
+		}
+		name := strings.ToLower(string(p.input[start:p.pos]))
+		switch name {
+		case "pi":
+			return math.Pi, nil
+		case "e":
+			return math.E, nil
+		}
+
+		fn, exists := calculatorFunctions[name]
+		if !exists {
+			return 0, fmt.Errorf("unknown function or constant %q", name)
+		}
+		if !p.accept('(') {
+			return 0, fmt.Errorf("%s needs arguments in parentheses", name)
+		}
+		var args []float64
+		if !p.accept(')') {
+			for {
+				arg, err := p.parseSum()
+				if err != nil {
+					return 0, err
+				}
+				args = append(args, arg)
+				if p.accept(')') {
+					break
+				}
+				if !p.accept(',') {
+					return 0, fmt.Errorf("expected , or ) in call to %s", name)
+				}
+			}
+		}
+		value, err := fn(args)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", name, err)
+		}
+		return value, nil
+	}
+
+	return 0, fmt.Errorf("unexpected %q at position %d", r, p.pos+1)
+}
@@ -0,0 +1,153 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEvaluateExpression(t *testing.T) {
+	tests := []struct {
+		expression string
+		want       float64
+	}{
+		{"2+3*4^2", 50},
+		{"-2^2", -4},
+		{"2^3^2", 512},
+		{"(1 + 2) * 3", 9},
+		{"10 % 4", 2},
+		{"sqrt(16) + abs(-3)", 7},
+		{"max(1, 7, 3) - min(4, 2)", 5},
+		{"round(2 * pi)", 6},
+		{"ln(e)", 1},
+	}
+
+	for _, tt := range tests {
+		got, err := evaluateExpression(tt.expression)
+		if err != nil {
+			t.Errorf("%s: %v", tt.expression, err)
+			continue
+		}
+		if math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%s = %v, want %v", tt.expression, got, tt.want)
+		}
+	}
+}
+
+func TestEvaluateExpressionErrors(t *testing.T) {
+	for _, expression := range []string{"", "1 / 0", "2 +", "(1 + 2", "sqrt(1, 2)", "unknown(1)", "1 2", "sqrt(-1)"} {
+		if _, err := evaluateExpression(expression); err == nil {
+			t.Errorf("%q: expected an error", expression)
+		}
+	}
+}
+
+func TestCurrentTimeToolTimezone(t *testing.T) {
+	tool := NewCurrentTimeTool()
+	tool.now = func() time.Time { return time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC) }
+
+	got, err := tool.Execute(context.Background(), json.RawMessage(`{"timezone": "Asia/Tokyo"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(got, "Friday, 1 March 2024 21:00:00") {
+		t.Errorf("got %q", got)
+	}
+
+	if _, err := tool.Execute(context.Background(), json.RawMessage(`{"timezone": "Mars/Base"}`)); err == nil {
+		t.Error("expected an error for an unknown time zone")
+	}
+}
+
+func TestToolArguments(t *testing.T) {
+	tests := map[string]string{
+		"":                 "{}",
+		"null":             "{}",
+		` {"a": 1} `:       `{"a": 1}`,
+		`{"a": 1`:          `"{\"a\": 1"`,
+		`"already quoted"`: `"already quoted"`,
+	}
+	for raw, want := range tests {
+		if got := string(toolArguments([]byte(raw))); got != want {
+			t.Errorf("toolArguments(%q) = %s, want %s", raw, got, want)
+		}
+	}
+}
+
+func TestToolSetInvoke(t *testing.T) {
+	set := NewToolSet(time.Second, 5)
+	set.Register(NewCalculatorTool())
+
+	result, invocation := set.Invoke(context.Background(), ToolCall{ID: "1", Name: ToolCalculator, Arguments: json.RawMessage(`{"expression": "1/3"}`)})
+	if result.Content != "0.333..." || invocation.Result != "0.333..." || result.CallID != "1" {
+		t.Errorf("long results should be cut, got %q", result.Content)
+	}
+
+	result, invocation = set.Invoke(context.Background(), ToolCall{Name: "shell", Arguments: json.RawMessage(`{}`)})
+	if !strings.HasPrefix(result.Content, "Error: unknown tool") || invocation.Error == "" {
+		t.Errorf("unknown tools should be reported to the model, got %q", result.Content)
+	}
+
+	result, _ = set.Invoke(context.Background(), ToolCall{Name: ToolCalculator, Arguments: json.RawMessage(`"not an object"`)})
+	if !strings.HasPrefix(result.Content, "Error: invalid arguments") {
+		t.Errorf("bad arguments should be reported to the model, got %q", result.Content)
+	}
+}
+
+// scriptedToolBackend calls the calculator for a number of rounds, then answers
+type scriptedToolBackend struct {
+	fakeBackend
+	toolRounds int
+	requests   []GenerateRequest
+}
+
+func (f *scriptedToolBackend) GenerateToolTurn(_ context.Context, request GenerateRequest) (string, []ToolCall, error) {
+	f.requests = append(f.requests, request)
+	if len(request.Steps) < f.toolRounds {
+		return "", []ToolCall{{ID: "call_1", Name: ToolCalculator, Arguments: json.RawMessage(`{"expression": "6*7"}`)}}, nil
+	}
+	return "The answer is 42.", nil, nil
+}
+
+func TestAgentLoopRunsTools(t *testing.T) {
+	backend := &scriptedToolBackend{fakeBackend: fakeBackend{name: ProviderLocal}, toolRounds: 1}
+	c := newTestChatbot(backend)
+	c.RegisterTool(NewCalculatorTool())
+
+	response, _, _, invocations, err := c.runAgent(context.Background(), newTestTurn("what is 6 times 7?"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response != "The answer is 42." {
+		t.Errorf("response = %q", response)
+	}
+	if len(invocations) != 1 || invocations[0].Result != "42" || invocations[0].Round != 1 {
+		t.Fatalf("invocations = %+v", invocations)
+	}
+
+	second := backend.requests[1]
+	if len(second.Steps) != 1 || second.Steps[0].Results[0].Content != "42" {
+		t.Errorf("the tool result should be sent back to the model, got %+v", second.Steps)
+	}
+}
+
+func TestAgentLoopStopsAfterMaxRounds(t *testing.T) {
+	backend := &scriptedToolBackend{fakeBackend: fakeBackend{name: ProviderLocal}, toolRounds: 10}
+	c := newTestChatbot(backend)
+	c.RegisterTool(NewCalculatorTool())
+
+	_, _, _, invocations, err := c.runAgent(context.Background(), newTestTurn("loop"))
+	if err == nil || errors.Is(err, errNoToolBackend) {
+		t.Fatalf("expected the loop to give up, got %v", err)
+	}
+	if len(invocations) != c.maxToolRounds {
+		t.Errorf("ran %d tool calls, want %d", len(invocations), c.maxToolRounds)
+	}
+	if last := backend.requests[len(backend.requests)-1]; last.Tools != nil {
+		t.Error("the final request should offer no tools")
+	}
+}
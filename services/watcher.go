@@ -0,0 +1,292 @@
+package services
+
+import (
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"chatbot/models"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Watch modes for the document watcher
+const (
+	WatchModeAuto     = "auto"
+	WatchModeFSNotify = "fsnotify"
+	WatchModePoll     = "poll"
+)
+
+// Watcher timings used unless RAG_WATCH_DEBOUNCE and RAG_WATCH_POLL_INTERVAL are set
+const (
+	defaultWatchDebounce     = 2 * time.Second
+	defaultWatchPollInterval = 10 * time.Second
+)
+
+// DocumentWatcher watches the RAG data folder and re-indexes files as they change.
+// Changes are collected for a debounce period so that a burst of writes leads to a single pass.
+type DocumentWatcher struct {
+	rag          *RAGService
+	mode         string
+	activeMode   string
+	debounce     time.Duration
+	pollInterval time.Duration
+	mu           sync.Mutex
+	pending      map[string]bool
+	timer        *time.Timer
+	lastResult   *models.DocumentIndexResponse
+	passes       int
+	stop         chan struct{}
+	wg           sync.WaitGroup
+}
+
+// NewDocumentWatcher creates a watcher for the RAG service's data folder
+func NewDocumentWatcher(rag *RAGService, mode string, debounce time.Duration, pollInterval time.Duration) *DocumentWatcher {
+	if mode == "" {
+		mode = WatchModeAuto
+	}
+	if pollInterval <= 0 {
+		log.Printf("Invalid document watcher poll interval %s, using %s", pollInterval, defaultWatchPollInterval)
+		pollInterval = defaultWatchPollInterval
+	}
+	if debounce < 0 {
+		debounce = 0
+	}
+
+	return &DocumentWatcher{
+		rag:          rag,
+		mode:         mode,
+		debounce:     debounce,
+		pollInterval: pollInterval,
+		pending:      make(map[string]bool),
+		stop:         make(chan struct{}),
+	}
+}
+
+// Start begins watching, falling back to polling in auto mode when inotify is unavailable
+func (w *DocumentWatcher) Start() error {
+	switch w.mode {
+	case WatchModeFSNotify, WatchModeAuto:
+		err := w.startFSNotify()
+		if err == nil {
+			return nil
+		}
+		if w.mode == WatchModeFSNotify {
+			return err
+		}
+		log.Printf("fsnotify unavailable (%v), falling back to polling", err)
+		return w.startPolling()
+	case WatchModePoll:
+		return w.startPolling()
+	default:
+		return fmt.Errorf("unknown watch mode: %s", w.mode)
+	}
+}
+
+// Stop ends watching and waits for the watch loop to exit
+func (w *DocumentWatcher) Stop() {
+	close(w.stop)
+	w.wg.Wait()
+
+	w.mu.Lock()
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+	w.mu.Unlock()
+}
+
+// startFSNotify watches every directory under the data folder with inotify
+func (w *DocumentWatcher) startFSNotify() error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+
+	if err := w.addWatchDirs(watcher, w.rag.dataPath); err != nil {
+		watcher.Close()
+		return err
+	}
+
+	w.activeMode = WatchModeFSNotify
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		defer watcher.Close()
+
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				// Watch directories created after startup; their files are indexed on flush
+				if event.Has(fsnotify.Create) {
+					if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+						if err := w.addWatchDirs(watcher, event.Name); err != nil {
+							log.Printf("Failed to watch %s: %v", event.Name, err)
+						}
+					}
+				}
+				if event.Has(fsnotify.Chmod) && !event.Has(fsnotify.Write) {
+					continue
+				}
+				w.schedule(event.Name)
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Printf("Document watcher error: %v", err)
+			case <-w.stop:
+				return
+			}
+		}
+	}()
+
+	log.Printf("Watching %s for document changes (fsnotify, %s debounce)", w.rag.dataPath, w.debounce)
+	return nil
+}
+
+// addWatchDirs adds root and its visible subdirectories to the watcher
+func (w *DocumentWatcher) addWatchDirs(watcher *fsnotify.Watcher, root string) error {
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if path != root && strings.HasPrefix(d.Name(), ".") {
+			return filepath.SkipDir
+		}
+		return watcher.Add(path)
+	})
+}
+
+// startPolling compares file modification times every poll interval
+func (w *DocumentWatcher) startPolling() error {
+	previous, err := w.snapshot()
+	if err != nil {
+		return err
+	}
+
+	w.activeMode = WatchModePoll
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+
+		ticker := time.NewTicker(w.pollInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				current, err := w.snapshot()
+				if err != nil {
+					log.Printf("Document watcher failed to scan %s: %v", w.rag.dataPath, err)
+					continue
+				}
+
+				for path, modTime := range current {
+					if previousModTime, exists := previous[path]; !exists || !previousModTime.Equal(modTime) {
+						w.schedule(path)
+					}
+				}
+				for path := range previous {
+					if _, exists := current[path]; !exists {
+						w.schedule(path)
+					}
+				}
+				previous = current
+			case <-w.stop:
+				return
+			}
+		}
+	}()
+
+	log.Printf("Watching %s for document changes (polling every %s)", w.rag.dataPath, w.pollInterval)
+	return nil
+}
+
+// snapshot returns the modification time of every indexable file in the data folder
+func (w *DocumentWatcher) snapshot() (map[string]time.Time, error) {
+	files, err := w.rag.collectFiles(w.rag.dataPath, true)
+	if err != nil {
+		return nil, err
+	}
+
+	modTimes := make(map[string]time.Time, len(files))
+	for _, path := range files {
+		if info, err := os.Stat(path); err == nil {
+			modTimes[path] = info.ModTime()
+		}
+	}
+	return modTimes, nil
+}
+
+// schedule queues a changed path and restarts the debounce timer
+func (w *DocumentWatcher) schedule(path string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.pending[path] = true
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+	w.timer = time.AfterFunc(w.debounce, w.flush)
+}
+
+// flush re-indexes every queued path in a single pass
+func (w *DocumentWatcher) flush() {
+	w.mu.Lock()
+	paths := make([]string, 0, len(w.pending))
+	for path := range w.pending {
+		paths = append(paths, path)
+	}
+	w.pending = make(map[string]bool)
+	w.mu.Unlock()
+
+	if len(paths) == 0 {
+		return
+	}
+
+	result, err := w.rag.IndexFiles(paths, true, false)
+	if err != nil {
+		log.Printf("Document watcher failed to re-index %d paths: %v", len(paths), err)
+		return
+	}
+
+	w.mu.Lock()
+	w.lastResult = result
+	w.passes++
+	w.mu.Unlock()
+
+	log.Printf("Document watcher pass: indexed=%d skipped=%d deleted=%d errors=%d duration=%s files=%v",
+		result.IndexedCount, result.SkippedCount, result.DeletedCount, result.ErrorCount, result.Duration, result.Files)
+}
+
+// GetStatus returns the watcher details for the health endpoint
+func (w *DocumentWatcher) GetStatus() map[string]interface{} {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	status := map[string]interface{}{
+		"mode":     w.activeMode,
+		"debounce": w.debounce.String(),
+		"passes":   w.passes,
+		"pending":  len(w.pending),
+	}
+
+	if w.activeMode == WatchModePoll {
+		status["poll_interval"] = w.pollInterval.String()
+	}
+	if w.lastResult != nil {
+		status["last_pass"] = w.lastResult
+	}
+
+	return status
+}
@@ -0,0 +1,17 @@
+package services
+
+import "testing"
+
+func TestNewDocumentWatcherDefaultsInvalidIntervals(t *testing.T) {
+	watcher := NewDocumentWatcher(nil, "", -1, 0)
+
+	if watcher.mode != WatchModeAuto {
+		t.Errorf("mode = %q, want %q", watcher.mode, WatchModeAuto)
+	}
+	if watcher.pollInterval != defaultWatchPollInterval {
+		t.Errorf("pollInterval = %s, want %s", watcher.pollInterval, defaultWatchPollInterval)
+	}
+	if watcher.debounce != 0 {
+		t.Errorf("debounce = %s, want 0", watcher.debounce)
+	}
+}
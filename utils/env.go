@@ -5,7 +5,9 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // LoadEnv loads environment variables from a .env file
@@ -92,3 +94,60 @@ func LoadEnvWithFallback() error {
 	log.Printf("No .env files found in standard locations, using system environment only")
 	return nil
 }
+
+// GetEnvInt returns the integer value of an environment variable, or fallback if unset or invalid
+func GetEnvInt(key string, fallback int) int {
+	value := strings.TrimSpace(os.Getenv(key))
+	if value == "" {
+		return fallback
+	}
+
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("Warning: Invalid integer for %s: %q, using default %d", key, value, fallback)
+		return fallback
+	}
+	return parsed
+}
+
+// GetEnvFloat returns the float value of an environment variable, or fallback if unset or invalid
+func GetEnvFloat(key string, fallback float64) float64 {
+	value := strings.TrimSpace(os.Getenv(key))
+	if value == "" {
+		return fallback
+	}
+
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		log.Printf("Warning: Invalid number for %s: %q, using default %g", key, value, fallback)
+		return fallback
+	}
+	return parsed
+}
+
+// GetEnvDuration returns the duration value of an environment variable, or fallback if unset or invalid
+func GetEnvDuration(key string, fallback time.Duration) time.Duration {
+	value := strings.TrimSpace(os.Getenv(key))
+	if value == "" {
+		return fallback
+	}
+
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("Warning: Invalid duration for %s: %q, using default %s", key, value, fallback)
+		return fallback
+	}
+	return parsed
+}
+
+// GetEnvList returns the comma-separated values of an environment variable with blanks removed
+func GetEnvList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		value = strings.TrimSpace(value)
+		if value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}